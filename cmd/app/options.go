@@ -1,18 +1,28 @@
 package app
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/spf13/pflag"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 
+	"github.com/whypro/dxinkube/pkg/bridge"
 	"github.com/whypro/dxinkube/pkg/controller"
 	"github.com/whypro/dxinkube/pkg/converter"
+	"github.com/whypro/dxinkube/pkg/dubbo"
+	"github.com/whypro/dxinkube/pkg/provisioner"
 	"github.com/whypro/dxinkube/pkg/registry"
 )
 
@@ -28,20 +38,104 @@ const (
 	zkConnectionTimeout       = 10 * time.Second
 	resyncPeriod              = 5 * time.Minute
 	tlbLabelName              = "ke-tlb/owner"
+	defaultRemoteRegistryName = "default"
+
+	defaultHostnameResolveInterval = time.Minute
+
+	defaultUnregisterGracePeriod    = 30 * time.Second
+	defaultDeletionGuardMaxPercent  = 50
+	defaultDeletionGuardMinCount    = 10
+	defaultDeletionGuardGracePeriod = 10 * time.Minute
 )
 
+type RemoteRegistryOptions struct {
+	Name            string   `json:"name"`
+	Backend         string   `json:"backend"`
+	ZKAddrs         []string `json:"zk_addrs"`
+	AuthScheme      string   `json:"auth_scheme"`
+	AuthCredential  string   `json:"auth_credential"`
+	IncludeServices []string `json:"include_services"`
+	ExcludeServices []string `json:"exclude_services"`
+}
+
+type remoteRegistriesFile struct {
+	RemoteRegistries []RemoteRegistryOptions `json:"remote_registries"`
+}
+
+type ClusterOptions struct {
+	ID             string   `json:"id"`
+	KubeConfigPath string   `json:"kubeconfig"`
+	KubeContext    string   `json:"context"`
+	LocalZKAddrs   []string `json:"local_zk_addrs"`
+	Namespace      string   `json:"namespace"`
+	// Namespaces and NamespaceSelector select the namespaces watched by the
+	// tlb converter, along with Namespace
+	Namespaces        []string `json:"namespaces"`
+	NamespaceSelector string   `json:"namespace_selector"`
+}
+
+type clustersFile struct {
+	Clusters []ClusterOptions `json:"clusters"`
+}
+
 type ZKControllerOptions struct {
 	ServerAddr      string `json:"addr"`
 	ServerPort      int32  `json:"port"`
 	KubeConfigPath  string `json:"kubeconfig"`
+	KubeContext     string `json:"context"`
 	GlogV           int32  `json:"glog_v"`
 	GlogLogtostderr bool   `json:"glog_logtostderr"`
 	Version         bool   `json:"version"`
 
 	LocalZKAddrs  []string `json:"local_zk_addrs"`
 	RemoteZKAddrs []string `json:"remote_zk_addrs"`
+	// RemoteRegistriesFile is a json file holding a list of remote
+	// registries, it is used together with RemoteZKAddrs
+	RemoteRegistriesFile string `json:"remote_registries_file"`
+
+	Namespace         string   `json:"namespace"`
+	Namespaces        []string `json:"namespaces"`
+	NamespaceSelector string   `json:"namespace_selector"`
+
+	TLBSelector                string        `json:"tlb_selector"`
+	TLBAnnotation              string        `json:"tlb_annotation"`
+	TLBResolvePods             bool          `json:"tlb_resolve_pods"`
+	TLBHostnamePolicy          string        `json:"tlb_hostname_policy"`
+	TLBHostnameResolveInterval time.Duration `json:"tlb_hostname_resolve_interval"`
+
+	AddrConverter        string   `json:"addr_converter"`
+	NodePortAddressType  string   `json:"nodeport_address_type"`
+	NodePortNodeSelector string   `json:"nodeport_node_selector"`
+	HostPort             bool     `json:"hostport"`
+	DirectNamespaces     []string `json:"direct_namespaces"`
+	ServiceExpose        bool     `json:"service_expose"`
+	ProvisionTLBServices bool     `json:"provision_tlb_services"`
+	DubboBridges         bool     `json:"dubbo_bridges"`
+	RecordEvents         bool     `json:"record_events"`
+	ServiceStatus        bool     `json:"service_status"`
 
-	Namespace string `json:"namespace"`
+	ClusterID string `json:"cluster_id"`
+	// ClustersFile is a json file holding a list of local clusters, when set
+	// KubeConfigPath, KubeContext, LocalZKAddrs, the namespaces and ClusterID
+	// are ignored
+	ClustersFile string `json:"clusters_file"`
+	// AdoptUnmarked marks the unmarked remote providers of each cluster with
+	// its id, once after the start
+	AdoptUnmarked bool `json:"adopt_unmarked"`
+
+	DryRun bool `json:"dry_run"`
+
+	UnregisterGracePeriod time.Duration `json:"unregister_grace_period"`
+	// SnapshotDir and SnapshotConfigMap, as namespace/name, persist the
+	// remote providers registered by each cluster
+	SnapshotDir       string `json:"snapshot_dir"`
+	SnapshotConfigMap string `json:"snapshot_configmap"`
+
+	DeletionGuard            bool          `json:"deletion_guard"`
+	DeletionGuardMaxPercent  int           `json:"deletion_guard_max_percent"`
+	DeletionGuardMaxCount    int           `json:"deletion_guard_max_count"`
+	DeletionGuardMinCount    int           `json:"deletion_guard_min_count"`
+	DeletionGuardGracePeriod time.Duration `json:"deletion_guard_grace_period"`
 }
 
 func NewZKControllerOptions() *ZKControllerOptions {
@@ -50,6 +144,20 @@ func NewZKControllerOptions() *ZKControllerOptions {
 		ServerPort:      defaultServerPort,
 		GlogV:           0,
 		GlogLogtostderr: true,
+
+		TLBHostnamePolicy:          converter.IngressHostnamePublish,
+		TLBHostnameResolveInterval: defaultHostnameResolveInterval,
+
+		AddrConverter:       controller.AddrConverterTLB,
+		NodePortAddressType: string(v1.NodeInternalIP),
+		RecordEvents:        true,
+
+		UnregisterGracePeriod: defaultUnregisterGracePeriod,
+
+		DeletionGuard:            true,
+		DeletionGuardMaxPercent:  defaultDeletionGuardMaxPercent,
+		DeletionGuardMinCount:    defaultDeletionGuardMinCount,
+		DeletionGuardGracePeriod: defaultDeletionGuardGracePeriod,
 	}
 }
 
@@ -57,6 +165,7 @@ func (o *ZKControllerOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVarP(&o.ServerAddr, "addr", "h", o.ServerAddr, "")
 	fs.Int32VarP(&o.ServerPort, "port", "p", o.ServerPort, "")
 	fs.StringVar(&o.KubeConfigPath, "kubeconfig", o.KubeConfigPath, "")
+	fs.StringVar(&o.KubeContext, "context", o.KubeContext, "kubeconfig context to use")
 
 	fs.Int32Var(&o.GlogV, "glog-v", o.GlogV, "")
 	fs.BoolVar(&o.GlogLogtostderr, "glog-logtostderr", o.GlogLogtostderr, "")
@@ -64,50 +173,345 @@ func (o *ZKControllerOptions) AddFlags(fs *pflag.FlagSet) {
 
 	fs.StringSliceVar(&o.LocalZKAddrs, "local-zk-addrs", o.LocalZKAddrs, "")
 	fs.StringSliceVar(&o.RemoteZKAddrs, "remote-zk-addrs", o.RemoteZKAddrs, "")
+	fs.StringVar(&o.RemoteRegistriesFile, "remote-registries-file", o.RemoteRegistriesFile, "json file listing remote registries, each with its own name, backend, credentials and service filter")
 
 	fs.StringVar(&o.Namespace, "namespace", o.Namespace, "")
+	fs.StringSliceVar(&o.Namespaces, "namespaces", o.Namespaces, "namespaces watched by the tlb converter, along with --namespace, every namespace when neither is set")
+	fs.StringVar(&o.NamespaceSelector, "namespace-selector", o.NamespaceSelector, "label selector of the namespaces watched by the tlb converter, exclusive with --namespace and --namespaces")
+
+	fs.StringVar(&o.TLBSelector, "tlb-selector", o.TLBSelector, "label selector of the tlb services, services labelled "+tlbLabelName+" by default")
+	fs.StringVar(&o.TLBAnnotation, "tlb-annotation", o.TLBAnnotation, "annotation the tlb services must also carry, as key or key=value")
+	fs.BoolVar(&o.TLBResolvePods, "tlb-resolve-pods", o.TLBResolvePods, "convert the pod addresses missing from the tlb endpoints through their pod and the tlb services selecting it, at the cost of watching pods")
+	fs.StringVar(&o.TLBHostnamePolicy, "tlb-hostname-policy", o.TLBHostnamePolicy, "how load balancer ingress hostnames are published, publish as-is or resolve to ips")
+	fs.DurationVar(&o.TLBHostnameResolveInterval, "tlb-hostname-resolve-interval", o.TLBHostnameResolveInterval, "interval to refresh resolved load balancer hostnames")
+
+	fs.StringVar(&o.AddrConverter, "addr-converter", o.AddrConverter, "how pod addresses are exposed, tlb (LoadBalancer ingress), nodeport (nodeIP:nodePort) or direct (routable pod ip)")
+	fs.StringVar(&o.NodePortAddressType, "nodeport-address-type", o.NodePortAddressType, "node address type published by the nodeport converter, InternalIP or ExternalIP")
+	fs.StringVar(&o.NodePortNodeSelector, "nodeport-node-selector", o.NodePortNodeSelector, "label selector of the nodes published by the nodeport converter")
+	fs.BoolVar(&o.HostPort, "hostport", o.HostPort, "bridge pods labelled or annotated dxinkube/expose=hostport through their host ip and host port")
+	fs.StringSliceVar(&o.DirectNamespaces, "direct-namespaces", o.DirectNamespaces, "namespaces whose pod ips are routable and published unchanged, whatever the addr converter")
+	fs.BoolVar(&o.ProvisionTLBServices, "provision-tlb-services", o.ProvisionTLBServices, "create the tlb services of deployments and services annotated with dxinkube/provision-tlb=true")
+	fs.BoolVar(&o.RecordEvents, "record-events", o.RecordEvents, "record events of registrations, unregistrations and failures on the related Service or DubboBridge")
+	fs.BoolVar(&o.ServiceStatus, "service-status", o.ServiceStatus, "annotate the services with the dubbo interfaces published through them, their remote registries and the last sync time")
+	fs.BoolVar(&o.DubboBridges, "dubbo-bridges", o.DubboBridges, "also bridge the providers selected by the DubboBridge objects of their namespace, see example/crd")
+	fs.BoolVar(&o.ServiceExpose, "service-expose", o.ServiceExpose, "choose the addr converter per service from its dxinkube/expose annotation, loadbalancer, nodeport, hostport or direct, --addr-converter is the default")
+
+	fs.StringVar(&o.ClusterID, "cluster-id", o.ClusterID, "id marking the providers registered from this cluster, required when several controllers share a remote registry, a provider registered by another cluster is left to it")
+	fs.StringVar(&o.ClustersFile, "clusters-file", o.ClustersFile, "json file listing local clusters, each with its own kubeconfig, context and local registry")
+	fs.BoolVar(&o.AdoptUnmarked, "adopt-unmarked", o.AdoptUnmarked, "once after the start, register again with the cluster id the remote providers a cluster provides which carry no cluster id, as registered before --cluster-id was set")
+
+	fs.BoolVar(&o.DryRun, "dry-run", o.DryRun, "only log and expose through the admin api the remote registry mutations, without applying them")
+
+	fs.DurationVar(&o.UnregisterGracePeriod, "unregister-grace-period", o.UnregisterGracePeriod, "how long remote providers gone locally stay registered, so flapping pods and short local registry outages do not unregister them, providers of not ready pods are unregistered right away")
+	fs.StringVar(&o.SnapshotDir, "snapshot-dir", o.SnapshotDir, "directory of the snapshots of the remote providers registered, one file per cluster, so a restart only reconciles its own providers and detects their changes by other writers")
+	fs.StringVar(&o.SnapshotConfigMap, "snapshot-configmap", o.SnapshotConfigMap, "namespace/name of a ConfigMap of each cluster keeping its snapshot, instead of --snapshot-dir")
+
+	fs.BoolVar(&o.DeletionGuard, "deletion-guard", o.DeletionGuard, "pause the deletions from a remote registry when a refresh would unregister too many providers or no local provider is listed")
+	fs.IntVar(&o.DeletionGuardMaxPercent, "deletion-guard-max-percent", o.DeletionGuardMaxPercent, "largest share of the providers of a remote registry unregistered in one refresh, 0 for no limit")
+	fs.IntVar(&o.DeletionGuardMaxCount, "deletion-guard-max-count", o.DeletionGuardMaxCount, "most providers of a remote registry unregistered in one refresh, 0 for no limit")
+	fs.IntVar(&o.DeletionGuardMinCount, "deletion-guard-min-count", o.DeletionGuardMinCount, "most deletions of one refresh never paused by the max percent, an empty local listing pauses anyway")
+	fs.DurationVar(&o.DeletionGuardGracePeriod, "deletion-guard-grace-period", o.DeletionGuardGracePeriod, "how long deletions stay paused before they proceed anyway, 0 to wait for a confirmation through the admin api")
+}
+
+// Validate checks the options and fills in the defaults derived from them,
+// so the effective config is shown.
+func (o *ZKControllerOptions) Validate() error {
+	tlbSelector, err := converter.NewTLBSelector(tlbLabelName, o.TLBSelector, o.TLBAnnotation)
+	if err != nil {
+		return err
+	}
+	o.TLBSelector = tlbSelector.Labels.String()
+	if o.AdoptUnmarked && o.ClusterID == "" && o.ClustersFile == "" {
+		return fmt.Errorf("adopting unmarked providers requires a cluster id")
+	}
+	if o.SnapshotDir != "" && o.SnapshotConfigMap != "" {
+		return fmt.Errorf("snapshot dir and snapshot configmap are exclusive")
+	}
+	if o.SnapshotConfigMap != "" {
+		parts := strings.SplitN(o.SnapshotConfigMap, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid snapshot configmap %q, namespace/name is expected", o.SnapshotConfigMap)
+		}
+	}
+	if o.DryRun && (o.SnapshotDir != "" || o.SnapshotConfigMap != "") {
+		glog.Warningf("snapshots are neither loaded nor saved in a dry run")
+	}
+	return nil
+}
+
+func (o *ZKControllerOptions) loadClusters() ([]ClusterOptions, error) {
+	if o.ClustersFile == "" {
+		return []ClusterOptions{{
+			ID:             o.ClusterID,
+			KubeConfigPath: o.KubeConfigPath,
+			KubeContext:    o.KubeContext,
+			LocalZKAddrs:   o.LocalZKAddrs,
+			Namespace:      o.Namespace,
+
+			Namespaces:        o.Namespaces,
+			NamespaceSelector: o.NamespaceSelector,
+		}}, nil
+	}
+
+	data, err := ioutil.ReadFile(o.ClustersFile)
+	if err != nil {
+		return nil, err
+	}
+	file := clustersFile{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse %s error, %v", o.ClustersFile, err)
+	}
+	if len(file.Clusters) == 0 {
+		return nil, fmt.Errorf("no cluster configured in %s", o.ClustersFile)
+	}
+	ids := make(map[string]bool)
+	for _, c := range file.Clusters {
+		// clusters sharing remote registries must be told apart
+		if c.ID == "" {
+			return nil, fmt.Errorf("cluster id is required")
+		}
+		if ids[c.ID] {
+			return nil, fmt.Errorf("duplicated cluster id %q", c.ID)
+		}
+		ids[c.ID] = true
+		if len(c.LocalZKAddrs) == 0 {
+			return nil, fmt.Errorf("local zk addrs of cluster %q is required", c.ID)
+		}
+	}
+	return file.Clusters, nil
+}
+
+func (o *ZKControllerOptions) loadRemoteRegistries() ([]RemoteRegistryOptions, error) {
+	remoteRegistries := make([]RemoteRegistryOptions, 0)
+	if len(o.RemoteZKAddrs) > 0 {
+		remoteRegistries = append(remoteRegistries, RemoteRegistryOptions{
+			Name:    defaultRemoteRegistryName,
+			Backend: controller.BackendZookeeper,
+			ZKAddrs: o.RemoteZKAddrs,
+		})
+	}
+	if o.RemoteRegistriesFile != "" {
+		data, err := ioutil.ReadFile(o.RemoteRegistriesFile)
+		if err != nil {
+			return nil, err
+		}
+		file := remoteRegistriesFile{}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("parse %s error, %v", o.RemoteRegistriesFile, err)
+		}
+		remoteRegistries = append(remoteRegistries, file.RemoteRegistries...)
+	}
+
+	if len(remoteRegistries) == 0 {
+		return nil, fmt.Errorf("no remote registry configured")
+	}
+	names := make(map[string]bool)
+	for _, r := range remoteRegistries {
+		if r.Name == "" {
+			return nil, fmt.Errorf("remote registry name is required")
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("duplicated remote registry name %q", r.Name)
+		}
+		names[r.Name] = true
+		if r.Backend != "" && r.Backend != controller.BackendZookeeper {
+			return nil, fmt.Errorf("unsupported backend %q of remote registry %q", r.Backend, r.Name)
+		}
+		if len(r.ZKAddrs) == 0 {
+			return nil, fmt.Errorf("zk addrs of remote registry %q is required", r.Name)
+		}
+		filter := &dubbo.ServiceFilter{Include: r.IncludeServices, Exclude: r.ExcludeServices}
+		if err := filter.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid service filter of remote registry %q, %v", r.Name, err)
+		}
+	}
+	return remoteRegistries, nil
+}
+
+func createKubeClientConfig(kubeConfigPath string, kubeContext string) (*rest.Config, error) {
+	if kubeConfigPath == "" && kubeContext == "" {
+		return rest.InClusterConfig()
+	}
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	// if you want to change the loading rules (which files in which order), you can do so here
+	loadingRules.ExplicitPath = kubeConfigPath
+	configOverrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+	// if you want to change override values or bind them to flags, there are methods to help you
+	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
+	return kubeConfig.ClientConfig()
 }
 
 func createZKControllerConfig(o *ZKControllerOptions) *controller.Config {
-	var err error
-
-	var kubeClientConfig *rest.Config
-	if o.KubeConfigPath != "" {
-		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-		// if you want to change the loading rules (which files in which order), you can do so here
-		loadingRules.ExplicitPath = o.KubeConfigPath
-		configOverrides := &clientcmd.ConfigOverrides{}
-		// if you want to change override values or bind them to flags, there are methods to help you
-		kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
-		kubeClientConfig, err = kubeConfig.ClientConfig()
-	} else {
-		kubeClientConfig, err = rest.InClusterConfig()
+	clusters, err := o.loadClusters()
+	if err != nil {
+		glog.Fatalf("failed to load clusters: %v", err)
+	}
+	tlbSelector, err := converter.NewTLBSelector(tlbLabelName, o.TLBSelector, o.TLBAnnotation)
+	if err != nil {
+		glog.Fatalf("failed to parse tlb selector: %v", err)
+	}
+	clusterConfigs := make([]*controller.ClusterConfig, 0, len(clusters))
+	for _, c := range clusters {
+		kubeClientConfig, err := createKubeClientConfig(c.KubeConfigPath, c.KubeContext)
+		if err != nil {
+			glog.Fatalf("failed to get kubernetes cluster config of cluster %q: %v", c.ID, err)
+		}
+		var hostPortConfig *converter.HostPortControllerConfig
+		if o.HostPort {
+			hostPortConfig = &converter.HostPortControllerConfig{
+				KubeConfig:   kubeClientConfig,
+				ResyncPeriod: resyncPeriod,
+				Namespace:    c.Namespace,
+			}
+		}
+		var serviceExposeConfig *converter.ServiceExposeControllerConfig
+		if o.ServiceExpose {
+			serviceExposeConfig = &converter.ServiceExposeControllerConfig{
+				KubeConfig:   kubeClientConfig,
+				ResyncPeriod: resyncPeriod,
+				Namespace:    c.Namespace,
+			}
+		}
+		var provisionerConfig *provisioner.ProvisionerConfig
+		if o.ProvisionTLBServices {
+			provisionerConfig = &provisioner.ProvisionerConfig{
+				KubeConfig:   kubeClientConfig,
+				ResyncPeriod: resyncPeriod,
+				Namespace:    c.Namespace,
+				TLBLabelName: tlbLabelName,
+				TLBSelector:  tlbSelector,
+			}
+		}
+		var eventRecorder record.EventRecorder
+		if o.RecordEvents {
+			kubeClient, err := kubernetes.NewForConfig(kubeClientConfig)
+			if err != nil {
+				glog.Fatalf("failed to create kubernetes client of cluster %q: %v", c.ID, err)
+			}
+			eventRecorder = controller.NewEventRecorder(kubeClient)
+		}
+		var serviceStatusConfig *controller.ServiceStatusConfig
+		if o.ServiceStatus {
+			serviceStatusConfig = &controller.ServiceStatusConfig{
+				KubeConfig: kubeClientConfig,
+			}
+		}
+		var snapshotStore controller.SnapshotStore
+		snapshotKey := c.ID
+		if snapshotKey == "" {
+			snapshotKey = "default"
+		}
+		snapshotKey += ".json"
+		switch {
+		case o.SnapshotDir != "":
+			snapshotStore = controller.NewFileSnapshotStore(filepath.Join(o.SnapshotDir, snapshotKey))
+		case o.SnapshotConfigMap != "":
+			kubeClient, err := kubernetes.NewForConfig(kubeClientConfig)
+			if err != nil {
+				glog.Fatalf("failed to create kubernetes client of cluster %q: %v", c.ID, err)
+			}
+			parts := strings.SplitN(o.SnapshotConfigMap, "/", 2)
+			snapshotStore = controller.NewConfigMapSnapshotStore(kubeClient, parts[0], parts[1], snapshotKey)
+		}
+		var bridgeConfig *bridge.BridgeControllerConfig
+		if o.DubboBridges {
+			bridgeConfig = &bridge.BridgeControllerConfig{
+				KubeConfig:   kubeClientConfig,
+				ResyncPeriod: resyncPeriod,
+				Namespace:    c.Namespace,
+			}
+		}
+		clusterConfigs = append(clusterConfigs, &controller.ClusterConfig{
+			ID:            c.ID,
+			AddrConverter: o.AddrConverter,
+			TLBConfig: &converter.TLBControllerConfig{
+				KubeConfig:    kubeClientConfig,
+				TLBLabelName:  tlbLabelName,
+				TLBSelector:   o.TLBSelector,
+				TLBAnnotation: o.TLBAnnotation,
+				ResyncPeriod:  resyncPeriod,
+				Namespace:     c.Namespace,
+
+				Namespaces:        c.Namespaces,
+				NamespaceSelector: c.NamespaceSelector,
+
+				ResolvePods:             o.TLBResolvePods,
+				IngressHostnamePolicy:   o.TLBHostnamePolicy,
+				HostnameResolveInterval: o.TLBHostnameResolveInterval,
+			},
+			NodePortConfig: &converter.NodePortControllerConfig{
+				KubeConfig:       kubeClientConfig,
+				ServiceLabelName: tlbLabelName,
+				TLBSelector:      tlbSelector,
+				ResyncPeriod:     resyncPeriod,
+				Namespace:        c.Namespace,
+				NodeAddressType:  v1.NodeAddressType(o.NodePortAddressType),
+				NodeSelector:     o.NodePortNodeSelector,
+			},
+			HostPortConfig: hostPortConfig,
+			DirectConfig: &converter.DirectControllerConfig{
+				KubeConfig:   kubeClientConfig,
+				ResyncPeriod: resyncPeriod,
+				Namespaces:   o.DirectNamespaces,
+			},
+			ServiceExposeConfig: serviceExposeConfig,
+			ProvisionerConfig:   provisionerConfig,
+			BridgeConfig:        bridgeConfig,
+			EventRecorder:       eventRecorder,
+			ServiceStatusConfig: serviceStatusConfig,
+			SnapshotStore:       snapshotStore,
+			LocalZKConfig: &registry.ZookeeperConfig{
+				ServerAddrs:               c.LocalZKAddrs,
+				DubboRootPath:             dubboRootPath,
+				DubboProviderCategory:     dubboProviderCategory,
+				DubboConfiguratorCategory: dubboConfiguratorCategory,
+				ConnectionTimeout:         zkConnectionTimeout,
+			},
+		})
 	}
+
+	remoteRegistries, err := o.loadRemoteRegistries()
 	if err != nil {
-		glog.Fatalf("failed to get kubernetes cluster config: %v", err)
+		glog.Fatalf("failed to load remote registries: %v", err)
+	}
+	remoteRegistryConfigs := make([]*controller.RemoteRegistryConfig, 0, len(remoteRegistries))
+	for _, r := range remoteRegistries {
+		remoteRegistryConfigs = append(remoteRegistryConfigs, &controller.RemoteRegistryConfig{
+			Name:    r.Name,
+			Backend: r.Backend,
+			ZKConfig: &registry.ZookeeperConfig{
+				ServerAddrs:               r.ZKAddrs,
+				DubboRootPath:             dubboRootPath,
+				DubboProviderCategory:     dubboProviderCategory,
+				DubboConfiguratorCategory: dubboConfiguratorCategory,
+				ConnectionTimeout:         zkConnectionTimeout,
+				AuthScheme:                r.AuthScheme,
+				AuthCredential:            r.AuthCredential,
+			},
+			ServiceFilter: &dubbo.ServiceFilter{
+				Include: r.IncludeServices,
+				Exclude: r.ExcludeServices,
+			},
+		})
+	}
+
+	var deletionGuardConfig *controller.DeletionGuardConfig
+	if o.DeletionGuard {
+		deletionGuardConfig = &controller.DeletionGuardConfig{
+			MaxPercent:  o.DeletionGuardMaxPercent,
+			MaxCount:    o.DeletionGuardMaxCount,
+			MinCount:    o.DeletionGuardMinCount,
+			GracePeriod: o.DeletionGuardGracePeriod,
+		}
 	}
 
 	return &controller.Config{
-		TLBConfig: &converter.TLBControllerConfig{
-			KubeConfig:   kubeClientConfig,
-			TLBLabelName: tlbLabelName,
-			ResyncPeriod: resyncPeriod,
-			Namespace:    o.Namespace,
-		},
-		LocalZKConfig: &registry.ZookeeperConfig{
-			ServerAddrs:               o.LocalZKAddrs,
-			DubboRootPath:             dubboRootPath,
-			DubboProviderCategory:     dubboProviderCategory,
-			DubboConfiguratorCategory: dubboConfiguratorCategory,
-			ConnectionTimeout:         zkConnectionTimeout,
-		},
-		RemoteZKConfig: &registry.ZookeeperConfig{
-			ServerAddrs:               o.RemoteZKAddrs,
-			DubboRootPath:             dubboRootPath,
-			DubboProviderCategory:     dubboProviderCategory,
-			DubboConfiguratorCategory: dubboConfiguratorCategory,
-			ConnectionTimeout:         zkConnectionTimeout,
-		},
+		Clusters:              clusterConfigs,
+		RemoteRegistryConfigs: remoteRegistryConfigs,
+		DryRun:                o.DryRun,
+		DeletionGuardConfig:   deletionGuardConfig,
+		UnregisterGracePeriod: o.UnregisterGracePeriod,
+		AdoptUnmarked:         o.AdoptUnmarked,
 	}
 }
 
@@ -1,15 +1,26 @@
 package app
 
 import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+
 	"github.com/golang/glog"
 	"k8s.io/apiserver/pkg/server"
 
+	"github.com/whypro/dxinkube/pkg/admin"
 	"github.com/whypro/dxinkube/pkg/controller"
 )
 
 func Run(zkControllerOptions *ZKControllerOptions) (err error) {
-
-	// router := gin.Default()
+	if err := zkControllerOptions.Validate(); err != nil {
+		glog.Errorf("invalid options, err: %v", err)
+		return err
+	}
+	if effective, err := json.Marshal(zkControllerOptions); err == nil {
+		glog.Infof("effective config: %s", effective)
+	}
 
 	zkControllerConfig := createZKControllerConfig(zkControllerOptions)
 	zkController, err := controller.NewZKController(zkControllerConfig)
@@ -18,12 +29,53 @@ func Run(zkControllerOptions *ZKControllerOptions) (err error) {
 		return err
 	}
 
+	adminServer := admin.NewServer(fmt.Sprintf("%s:%d", zkControllerOptions.ServerAddr, zkControllerOptions.ServerPort))
+	adminServer.HandleJSON("/config", func() (interface{}, error) {
+		return zkControllerOptions, nil
+	})
+	adminServer.HandleJSON("/dryrun", func() (interface{}, error) {
+		return zkController.DryRunSummary(), nil
+	})
+	adminServer.HandleJSON("/deletions", func() (interface{}, error) {
+		return zkController.PausedDeletions(), nil
+	})
+	adminServer.HandleJSON("/snapshot", func() (interface{}, error) {
+		return zkController.SnapshotStatuses(), nil
+	})
+	adminServer.HandleJSON("/deletions/pending", func() (interface{}, error) {
+		return zkController.PendingDeletions(), nil
+	})
+	// POST /deletions/confirm?cluster=<id>&registry=<name> lets the paused
+	// deletions proceed
+	adminServer.Handle("/deletions/confirm", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		if err := zkController.ConfirmDeletions(query.Get("cluster"), query.Get("registry")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		glog.Infof("deletions from %s of cluster %q confirmed", query.Get("registry"), query.Get("cluster"))
+		admin.WriteJSON(w, http.StatusOK, zkController.PausedDeletions())
+	}))
+	adminServer.Handle("/debug/vars", expvar.Handler())
+	// ready once every cluster synced, remote providers are not unregistered
+	// before
+	adminServer.Handle("/readyz", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !zkController.HasSynced() {
+			http.Error(w, "not synced", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+
 	stopCh := server.SetupSignalHandler()
 
 	zkController.Run(stopCh)
 
-	<-stopCh
-	glog.Infof("shutting down http server")
+	adminServer.Run(stopCh)
 
 	glog.Infof("zk controller shutdown success")
 
@@ -0,0 +1,16 @@
+#!/usr/bin/env bash
+
+set -o errexit
+set -o nounset
+set -o pipefail
+
+ROOT=$(unset CDPATH && cd $(dirname "${BASH_SOURCE[0]}")/.. && pwd)
+CODEGEN_PKG=${CODEGEN_PKG:-${GOPATH%%:*}/src/k8s.io/code-generator}
+
+# generates the deepcopy functions, the clientset, listers and informers of
+# the dxinkube api group
+${CODEGEN_PKG}/generate-groups.sh "deepcopy,client,informer,lister" \
+    github.com/whypro/dxinkube/pkg/client \
+    github.com/whypro/dxinkube/pkg/apis \
+    dxinkube:v1alpha1 \
+    --output-base "${GOPATH%%:*}/src"
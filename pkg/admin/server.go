@@ -0,0 +1,74 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// Server is the admin http server exposing controller state.
+type Server struct {
+	server *http.Server
+	mux    *http.ServeMux
+}
+
+func NewServer(addr string) *Server {
+	mux := http.NewServeMux()
+	return &Server{
+		server: &http.Server{Addr: addr, Handler: mux},
+		mux:    mux,
+	}
+}
+
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleJSON serves the value returned by f as json on GET requests.
+func (s *Server) HandleJSON(pattern string, f func() (interface{}, error)) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		v, err := f()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, http.StatusOK, v)
+	})
+}
+
+func WriteJSON(w http.ResponseWriter, code int, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+// Run serves until stopCh is closed.
+func (s *Server) Run(stopCh <-chan struct{}) {
+	go func() {
+		glog.Infof("admin server listening on %s", s.server.Addr)
+		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			glog.Errorf("admin server error, err: %v", err)
+		}
+	}()
+	<-stopCh
+	glog.Infof("shutting down admin server")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		glog.Warningf("shutdown admin server error, err: %v", err)
+	}
+}
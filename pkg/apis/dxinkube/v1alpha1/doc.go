@@ -0,0 +1,5 @@
+// +k8s:deepcopy-gen=package
+// +groupName=dxinkube.whypro.github.io
+
+// Package v1alpha1 is the v1alpha1 version of the dxinkube api.
+package v1alpha1
@@ -0,0 +1,55 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// DubboBridge selects the dubbo providers of its namespace bridged to the
+// remote registries, and how.
+type DubboBridge struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DubboBridgeSpec   `json:"spec"`
+	Status DubboBridgeStatus `json:"status,omitempty"`
+}
+
+type DubboBridgeSpec struct {
+	// Interfaces are the glob patterns of the dubbo interfaces bridged
+	Interfaces []string `json:"interfaces"`
+	// Registries names the remote registries published to, every one when
+	// empty
+	Registries []string `json:"registries,omitempty"`
+	// Expose is the exposure strategy of the providers, loadbalancer,
+	// nodeport, hostport or direct. The controller default when empty.
+	Expose string `json:"expose,omitempty"`
+	// Parameters override the provider url parameters
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+type DubboBridgeStatus struct {
+	// ObservedGeneration is the generation of the spec last synced
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// BridgedProviders counts the providers published, all registries
+	// included
+	BridgedProviders int `json:"bridgedProviders"`
+	// Registries counts the providers published per remote registry
+	Registries map[string]int `json:"registries,omitempty"`
+	// LastSyncTime is the time of the last sync
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// Errors of the last sync
+	Errors []string `json:"errors,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// DubboBridgeList is a list of DubboBridges.
+type DubboBridgeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []DubboBridge `json:"items"`
+}
@@ -0,0 +1,342 @@
+package bridge
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	informersv1 "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/whypro/dxinkube/pkg/apis/dxinkube/v1alpha1"
+	"github.com/whypro/dxinkube/pkg/client/clientset/versioned"
+	informersv1alpha1 "github.com/whypro/dxinkube/pkg/client/informers/externalversions/dxinkube/v1alpha1"
+	listersv1alpha1 "github.com/whypro/dxinkube/pkg/client/listers/dxinkube/v1alpha1"
+	"github.com/whypro/dxinkube/pkg/converter"
+	"github.com/whypro/dxinkube/pkg/dubbo"
+)
+
+const (
+	// statusSyncPeriod is the longest a bridge status goes without a sync
+	statusSyncPeriod = time.Minute
+	// maxStatusErrors bounds the errors reported in a bridge status
+	maxStatusErrors = 10
+)
+
+var validExposes = sets.NewString(
+	converter.ExposeLoadBalancer,
+	converter.ExposeNodePort,
+	converter.ExposeHostPort,
+	converter.ExposeDirect,
+)
+
+// Bridge is the bridging policy of the providers selected by a DubboBridge.
+type Bridge struct {
+	// Key is the namespace/name of the DubboBridge
+	Key string
+	// Ref refers to the DubboBridge, the events of its providers are
+	// recorded on it
+	Ref *v1.ObjectReference
+	// Registries are the remote registries published to, every one when empty
+	Registries sets.String
+	// Expose is the expose strategy of the providers, the converter default
+	// when empty
+	Expose     string
+	Parameters map[string]string
+}
+
+// Targets tells whether the providers are published to the remote registry.
+func (b *Bridge) Targets(registry string) bool {
+	return b.Registries.Len() == 0 || b.Registries.Has(registry)
+}
+
+// Report is the outcome of a refresh for one bridge.
+type Report struct {
+	// Registries counts the providers published per remote registry
+	Registries map[string]int
+	Errors     []string
+}
+
+func NewReport() *Report {
+	return &Report{
+		Registries: make(map[string]int),
+	}
+}
+
+func (r *Report) AddError(err error) {
+	if len(r.Errors) < maxStatusErrors {
+		r.Errors = append(r.Errors, err.Error())
+	}
+}
+
+type BridgeControllerConfig struct {
+	KubeConfig *rest.Config
+	// KubeClient and Client are used instead of creating clients from
+	// KubeConfig when set
+	KubeClient   kubernetes.Interface
+	Client       versioned.Interface
+	ResyncPeriod time.Duration
+	Namespace    string
+	// Registries are the names of the remote registries, filled in by the
+	// controller
+	Registries []string
+}
+
+// BridgeController selects the bridge of the local providers from the
+// DubboBridge objects of their pod namespace, and reports the providers
+// bridged in the status of the objects.
+type BridgeController struct {
+	config     *BridgeControllerConfig
+	kubeClient kubernetes.Interface
+	client     versioned.Interface
+
+	bridgeInformer cache.SharedIndexInformer
+	bridgeLister   listersv1alpha1.DubboBridgeLister
+	podInformer    cache.SharedIndexInformer
+
+	lock sync.Mutex
+	// reports is nil until the first refresh is reported
+	reports map[string]*Report
+	queue   chan struct{}
+}
+
+func NewBridgeController(config *BridgeControllerConfig) (*BridgeController, error) {
+	kubeClient := config.KubeClient
+	if kubeClient == nil {
+		var err error
+		kubeClient, err = kubernetes.NewForConfig(config.KubeConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create kubernetes client")
+		}
+	}
+	client := config.Client
+	if client == nil {
+		var err error
+		client, err = versioned.NewForConfig(config.KubeConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create dxinkube client")
+		}
+	}
+
+	bridgeInformer := informersv1alpha1.NewDubboBridgeInformer(client, config.Namespace, config.ResyncPeriod, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+	podInformer := informersv1.NewPodInformer(kubeClient, config.Namespace, config.ResyncPeriod, cache.Indexers{
+		converter.PodIPIndex: converter.PodIPIndexFunc,
+	})
+
+	c := &BridgeController{
+		config:         config,
+		kubeClient:     kubeClient,
+		client:         client,
+		bridgeInformer: bridgeInformer,
+		bridgeLister:   listersv1alpha1.NewDubboBridgeLister(bridgeInformer.GetIndexer()),
+		podInformer:    podInformer,
+		queue:          make(chan struct{}, 1),
+	}
+	// new and changed bridges get their status without waiting for the
+	// periodic sync
+	bridgeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) { c.enqueue() },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if !reflect.DeepEqual(oldObj.(*v1alpha1.DubboBridge).Spec, newObj.(*v1alpha1.DubboBridge).Spec) {
+				c.enqueue()
+			}
+		},
+	})
+	return c, nil
+}
+
+func (c *BridgeController) enqueue() {
+	select {
+	case c.queue <- struct{}{}:
+	default:
+	}
+}
+
+func (c *BridgeController) Run(stopCh <-chan struct{}) {
+	go c.bridgeInformer.Run(stopCh)
+	go c.podInformer.Run(stopCh)
+	go func() {
+		for {
+			select {
+			case <-c.queue:
+				c.syncStatus()
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	go wait.Until(c.syncStatus, statusSyncPeriod, stopCh)
+}
+
+func (c *BridgeController) HasSynced() bool {
+	return c.bridgeInformer.HasSynced() && c.podInformer.HasSynced()
+}
+
+// validate returns the errors of a bridge spec, a bridge with errors selects
+// no provider.
+func (c *BridgeController) validate(b *v1alpha1.DubboBridge) []string {
+	errs := make([]string, 0)
+	if len(b.Spec.Interfaces) == 0 {
+		errs = append(errs, "no interface pattern")
+	}
+	for _, pattern := range b.Spec.Interfaces {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid interface pattern %q", pattern))
+		}
+	}
+	registries := sets.NewString(c.config.Registries...)
+	for _, name := range b.Spec.Registries {
+		if !registries.Has(name) {
+			errs = append(errs, fmt.Sprintf("unknown remote registry %q", name))
+		}
+	}
+	if b.Spec.Expose != "" && !validExposes.Has(b.Spec.Expose) {
+		errs = append(errs, fmt.Sprintf("unsupported expose %q", b.Spec.Expose))
+	}
+	return errs
+}
+
+// namespacesOfAddr returns the namespaces of the pods with the ip of podAddr,
+// several for host network pods.
+func (c *BridgeController) namespacesOfAddr(podAddr string) ([]string, error) {
+	ip, _, err := net.SplitHostPort(podAddr)
+	if err != nil {
+		ip = podAddr
+	}
+	objs, err := c.podInformer.GetIndexer().ByIndex(converter.PodIPIndex, ip)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := sets.NewString()
+	for _, obj := range objs {
+		namespaces.Insert(obj.(*v1.Pod).Namespace)
+	}
+	return namespaces.List(), nil
+}
+
+// Bridge returns the bridge of a provider, nil when no valid DubboBridge of
+// the pod namespace selects its interface. Bridges are tried by
+// namespace/name so the choice is stable.
+func (c *BridgeController) Bridge(podAddr string, service string) *Bridge {
+	namespaces, err := c.namespacesOfAddr(podAddr)
+	if err != nil {
+		glog.Errorf("get namespaces of %s error, err: %v", podAddr, err)
+		return nil
+	}
+	for _, ns := range namespaces {
+		bridges, err := c.bridgeLister.DubboBridges(ns).List(labels.Everything())
+		if err != nil {
+			glog.Errorf("list dubbo bridges error, err: %v", err)
+			return nil
+		}
+		sort.Slice(bridges, func(i, j int) bool { return bridges[i].Name < bridges[j].Name })
+		for _, b := range bridges {
+			if !dubbo.MatchAny(b.Spec.Interfaces, service) || len(c.validate(b)) > 0 {
+				continue
+			}
+			return &Bridge{
+				Key:        b.Namespace + "/" + b.Name,
+				Ref:        referenceOf(b),
+				Registries: sets.NewString(b.Spec.Registries...),
+				Expose:     b.Spec.Expose,
+				Parameters: b.Spec.Parameters,
+			}
+		}
+	}
+	return nil
+}
+
+func referenceOf(b *v1alpha1.DubboBridge) *v1.ObjectReference {
+	return &v1.ObjectReference{
+		APIVersion:      v1alpha1.SchemeGroupVersion.String(),
+		Kind:            "DubboBridge",
+		Namespace:       b.Namespace,
+		Name:            b.Name,
+		UID:             b.UID,
+		ResourceVersion: b.ResourceVersion,
+	}
+}
+
+// Report records the outcome of a refresh, keyed by bridge key. Bridges
+// missing from reports bridged no provider.
+func (c *BridgeController) Report(reports map[string]*Report) {
+	if reports == nil {
+		reports = make(map[string]*Report)
+	}
+	c.lock.Lock()
+	c.reports = reports
+	c.lock.Unlock()
+	c.enqueue()
+}
+
+func (c *BridgeController) syncStatus() {
+	bridges, err := c.bridgeLister.List(labels.Everything())
+	if err != nil {
+		glog.Errorf("list dubbo bridges error, err: %v", err)
+		return
+	}
+	c.lock.Lock()
+	reports := c.reports
+	c.lock.Unlock()
+	// before the first refresh every bridge would report no provider
+	if reports == nil {
+		return
+	}
+
+	for _, b := range bridges {
+		report, ok := reports[b.Namespace+"/"+b.Name]
+		if !ok {
+			report = NewReport()
+		}
+		status := v1alpha1.DubboBridgeStatus{
+			ObservedGeneration: b.Generation,
+			Registries:         report.Registries,
+			Errors:             append(c.validate(b), report.Errors...),
+		}
+		for _, count := range report.Registries {
+			status.BridgedProviders += count
+		}
+		if len(status.Registries) == 0 {
+			status.Registries = nil
+		}
+		if len(status.Errors) == 0 {
+			status.Errors = nil
+		}
+		if err := c.updateStatus(b, status); err != nil {
+			glog.Errorf("update dubbo bridge status error, ns: %s, name: %s, err: %v", b.Namespace, b.Name, err)
+		}
+	}
+}
+
+// updateStatus writes status when it changed or its last sync is older than
+// statusSyncPeriod.
+func (c *BridgeController) updateStatus(b *v1alpha1.DubboBridge, status v1alpha1.DubboBridgeStatus) error {
+	current := b.Status
+	lastSyncTime := current.LastSyncTime
+	current.LastSyncTime = nil
+	if reflect.DeepEqual(current, status) && lastSyncTime != nil && time.Since(lastSyncTime.Time) < statusSyncPeriod {
+		return nil
+	}
+	now := metav1.Now()
+	status.LastSyncTime = &now
+
+	updated := b.DeepCopy()
+	updated.Status = status
+	_, err := c.client.DxinkubeV1alpha1().DubboBridges(b.Namespace).Update(updated)
+	return err
+}
@@ -0,0 +1,104 @@
+package bridge
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	kubetesting "k8s.io/client-go/testing"
+
+	"github.com/whypro/dxinkube/pkg/apis/dxinkube/v1alpha1"
+	dxfake "github.com/whypro/dxinkube/pkg/client/clientset/versioned/fake"
+)
+
+func newBridgeTestController(t *testing.T, client *dxfake.Clientset, kubeClient *fake.Clientset, stopCh <-chan struct{}) *BridgeController {
+	c, err := NewBridgeController(&BridgeControllerConfig{
+		KubeClient: kubeClient,
+		Client:     client,
+		Registries: []string{"remote"},
+	})
+	if err != nil {
+		t.Fatalf("new bridge controller error, err: %v", err)
+	}
+	go c.bridgeInformer.Run(stopCh)
+	go c.podInformer.Run(stopCh)
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return c.HasSynced(), nil
+	}); err != nil {
+		t.Fatalf("wait for caches to sync error, err: %v", err)
+	}
+	return c
+}
+
+func TestBridgeOfReusedPodIP(t *testing.T) {
+	newBridge := func(ns string) *v1alpha1.DubboBridge {
+		return &v1alpha1.DubboBridge{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "demo"},
+			Spec:       v1alpha1.DubboBridgeSpec{Interfaces: []string{"com.example.*"}},
+		}
+	}
+	newPod := func(ns string, phase v1.PodPhase) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "demo"},
+			Status:     v1.PodStatus{Phase: phase, PodIP: "10.0.0.1"},
+		}
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c := newBridgeTestController(t,
+		dxfake.NewSimpleClientset(newBridge("done"), newBridge("live")),
+		fake.NewSimpleClientset(newPod("done", v1.PodSucceeded), newPod("live", v1.PodRunning)),
+		stopCh)
+
+	// the completed pod gave its ip to the running one
+	b := c.Bridge("10.0.0.1:20880", "com.example.Demo")
+	if b == nil || b.Key != "live/demo" {
+		t.Errorf("expected the bridge live/demo, got %+v", b)
+	}
+	if b := c.Bridge("10.0.0.1:20880", "com.other.Demo"); b != nil {
+		t.Errorf("expected no bridge of an unselected interface, got %+v", b)
+	}
+}
+
+func TestSyncStatusWaitsForReport(t *testing.T) {
+	bridge := &v1alpha1.DubboBridge{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "demo", Generation: 2},
+		Spec:       v1alpha1.DubboBridgeSpec{Interfaces: []string{"com.example.*"}},
+	}
+	client := dxfake.NewSimpleClientset(bridge)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c := newBridgeTestController(t, client, fake.NewSimpleClientset(), stopCh)
+
+	client.ClearActions()
+	c.syncStatus()
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" {
+			t.Fatalf("expected no status write before the first report, got %v", action)
+		}
+	}
+
+	report := NewReport()
+	report.Registries["remote"] = 2
+	c.lock.Lock()
+	c.reports = map[string]*Report{"ns/demo": report}
+	c.lock.Unlock()
+	c.syncStatus()
+
+	var updated *v1alpha1.DubboBridge
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" {
+			updated = action.(kubetesting.UpdateAction).GetObject().(*v1alpha1.DubboBridge)
+		}
+	}
+	if updated == nil {
+		t.Fatal("expected the status written after the first report")
+	}
+	status := updated.Status
+	if status.ObservedGeneration != 2 || status.BridgedProviders != 2 || status.Registries["remote"] != 2 || status.LastSyncTime == nil {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
@@ -0,0 +1,83 @@
+package versioned
+
+import (
+	glog "github.com/golang/glog"
+	discovery "k8s.io/client-go/discovery"
+	rest "k8s.io/client-go/rest"
+	flowcontrol "k8s.io/client-go/util/flowcontrol"
+
+	dxinkubev1alpha1 "github.com/whypro/dxinkube/pkg/client/clientset/versioned/typed/dxinkube/v1alpha1"
+)
+
+type Interface interface {
+	Discovery() discovery.DiscoveryInterface
+	DxinkubeV1alpha1() dxinkubev1alpha1.DxinkubeV1alpha1Interface
+	// Deprecated: please explicitly pick a version if possible.
+	Dxinkube() dxinkubev1alpha1.DxinkubeV1alpha1Interface
+}
+
+// Clientset contains the clients for groups. Each group has exactly one
+// version included in a Clientset.
+type Clientset struct {
+	*discovery.DiscoveryClient
+	dxinkubeV1alpha1 *dxinkubev1alpha1.DxinkubeV1alpha1Client
+}
+
+// DxinkubeV1alpha1 retrieves the DxinkubeV1alpha1Client
+func (c *Clientset) DxinkubeV1alpha1() dxinkubev1alpha1.DxinkubeV1alpha1Interface {
+	return c.dxinkubeV1alpha1
+}
+
+// Deprecated: Dxinkube retrieves the default version of DxinkubeClient.
+// Please explicitly pick a version.
+func (c *Clientset) Dxinkube() dxinkubev1alpha1.DxinkubeV1alpha1Interface {
+	return c.dxinkubeV1alpha1
+}
+
+// Discovery retrieves the DiscoveryClient
+func (c *Clientset) Discovery() discovery.DiscoveryInterface {
+	if c == nil {
+		return nil
+	}
+	return c.DiscoveryClient
+}
+
+// NewForConfig creates a new Clientset for the given config.
+func NewForConfig(c *rest.Config) (*Clientset, error) {
+	configShallowCopy := *c
+	if configShallowCopy.RateLimiter == nil && configShallowCopy.QPS > 0 {
+		configShallowCopy.RateLimiter = flowcontrol.NewTokenBucketRateLimiter(configShallowCopy.QPS, configShallowCopy.Burst)
+	}
+	var cs Clientset
+	var err error
+	cs.dxinkubeV1alpha1, err = dxinkubev1alpha1.NewForConfig(&configShallowCopy)
+	if err != nil {
+		return nil, err
+	}
+
+	cs.DiscoveryClient, err = discovery.NewDiscoveryClientForConfig(&configShallowCopy)
+	if err != nil {
+		glog.Errorf("failed to create the DiscoveryClient: %v", err)
+		return nil, err
+	}
+	return &cs, nil
+}
+
+// NewForConfigOrDie creates a new Clientset for the given config and
+// panics if there is an error in the config.
+func NewForConfigOrDie(c *rest.Config) *Clientset {
+	var cs Clientset
+	cs.dxinkubeV1alpha1 = dxinkubev1alpha1.NewForConfigOrDie(c)
+
+	cs.DiscoveryClient = discovery.NewDiscoveryClientForConfigOrDie(c)
+	return &cs
+}
+
+// New creates a new Clientset for the given RESTClient.
+func New(c rest.Interface) *Clientset {
+	var cs Clientset
+	cs.dxinkubeV1alpha1 = dxinkubev1alpha1.New(c)
+
+	cs.DiscoveryClient = discovery.NewDiscoveryClient(c)
+	return &cs
+}
@@ -0,0 +1,4 @@
+// This package is generated by client-gen with custom arguments.
+
+// This package has the automatically generated clientset.
+package versioned
@@ -0,0 +1,57 @@
+package fake
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/testing"
+
+	clientset "github.com/whypro/dxinkube/pkg/client/clientset/versioned"
+	dxinkubev1alpha1 "github.com/whypro/dxinkube/pkg/client/clientset/versioned/typed/dxinkube/v1alpha1"
+	fakedxinkubev1alpha1 "github.com/whypro/dxinkube/pkg/client/clientset/versioned/typed/dxinkube/v1alpha1/fake"
+)
+
+// NewSimpleClientset returns a clientset that will respond with the provided objects.
+// It's backed by a very simple object tracker that processes creates, updates and deletions as-is,
+// without applying any validations and/or defaults. It shouldn't be considered a replacement
+// for a real clientset and is mostly useful in simple unit tests.
+func NewSimpleClientset(objects ...runtime.Object) *Clientset {
+	o := testing.NewObjectTracker(scheme, codecs.UniversalDecoder())
+	for _, obj := range objects {
+		if err := o.Add(obj); err != nil {
+			panic(err)
+		}
+	}
+
+	cs := &Clientset{}
+	cs.discovery = &fakediscovery.FakeDiscovery{Fake: &cs.Fake}
+	cs.AddReactor("*", "*", testing.ObjectReaction(o))
+	cs.AddWatchReactor("*", testing.DefaultWatchReactor(watch.NewFake(), nil))
+
+	return cs
+}
+
+// Clientset implements clientset.Interface. Meant to be embedded into a
+// struct to get a default implementation. This makes faking out just the method
+// you want to test easier.
+type Clientset struct {
+	testing.Fake
+	discovery *fakediscovery.FakeDiscovery
+}
+
+func (c *Clientset) Discovery() discovery.DiscoveryInterface {
+	return c.discovery
+}
+
+var _ clientset.Interface = &Clientset{}
+
+// DxinkubeV1alpha1 retrieves the DxinkubeV1alpha1Client
+func (c *Clientset) DxinkubeV1alpha1() dxinkubev1alpha1.DxinkubeV1alpha1Interface {
+	return &fakedxinkubev1alpha1.FakeDxinkubeV1alpha1{Fake: &c.Fake}
+}
+
+// Dxinkube retrieves the DxinkubeV1alpha1Client
+func (c *Clientset) Dxinkube() dxinkubev1alpha1.DxinkubeV1alpha1Interface {
+	return &fakedxinkubev1alpha1.FakeDxinkubeV1alpha1{Fake: &c.Fake}
+}
@@ -0,0 +1,139 @@
+package v1alpha1
+
+import (
+	v1alpha1 "github.com/whypro/dxinkube/pkg/apis/dxinkube/v1alpha1"
+	scheme "github.com/whypro/dxinkube/pkg/client/clientset/versioned/scheme"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// DubboBridgesGetter has a method to return a DubboBridgeInterface.
+// A group's client should implement this interface.
+type DubboBridgesGetter interface {
+	DubboBridges(namespace string) DubboBridgeInterface
+}
+
+// DubboBridgeInterface has methods to work with DubboBridge resources.
+type DubboBridgeInterface interface {
+	Create(*v1alpha1.DubboBridge) (*v1alpha1.DubboBridge, error)
+	Update(*v1alpha1.DubboBridge) (*v1alpha1.DubboBridge, error)
+	Delete(name string, options *meta_v1.DeleteOptions) error
+	DeleteCollection(options *meta_v1.DeleteOptions, listOptions meta_v1.ListOptions) error
+	Get(name string, options meta_v1.GetOptions) (*v1alpha1.DubboBridge, error)
+	List(opts meta_v1.ListOptions) (*v1alpha1.DubboBridgeList, error)
+	Watch(opts meta_v1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.DubboBridge, err error)
+	DubboBridgeExpansion
+}
+
+// dubboBridges implements DubboBridgeInterface
+type dubboBridges struct {
+	client rest.Interface
+	ns     string
+}
+
+// newDubboBridges returns a DubboBridges
+func newDubboBridges(c *DxinkubeV1alpha1Client, namespace string) *dubboBridges {
+	return &dubboBridges{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the dubboBridge, and returns the corresponding dubboBridge object, and an error if there is any.
+func (c *dubboBridges) Get(name string, options meta_v1.GetOptions) (result *v1alpha1.DubboBridge, err error) {
+	result = &v1alpha1.DubboBridge{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("dubbobridges").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of DubboBridges that match those selectors.
+func (c *dubboBridges) List(opts meta_v1.ListOptions) (result *v1alpha1.DubboBridgeList, err error) {
+	result = &v1alpha1.DubboBridgeList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("dubbobridges").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested dubboBridges.
+func (c *dubboBridges) Watch(opts meta_v1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("dubbobridges").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Watch()
+}
+
+// Create takes the representation of a dubboBridge and creates it.  Returns the server's representation of the dubboBridge, and an error, if there is any.
+func (c *dubboBridges) Create(dubboBridge *v1alpha1.DubboBridge) (result *v1alpha1.DubboBridge, err error) {
+	result = &v1alpha1.DubboBridge{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("dubbobridges").
+		Body(dubboBridge).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a dubboBridge and updates it. Returns the server's representation of the dubboBridge, and an error, if there is any.
+func (c *dubboBridges) Update(dubboBridge *v1alpha1.DubboBridge) (result *v1alpha1.DubboBridge, err error) {
+	result = &v1alpha1.DubboBridge{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("dubbobridges").
+		Name(dubboBridge.Name).
+		Body(dubboBridge).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the dubboBridge and deletes it. Returns an error if one occurs.
+func (c *dubboBridges) Delete(name string, options *meta_v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("dubbobridges").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *dubboBridges) DeleteCollection(options *meta_v1.DeleteOptions, listOptions meta_v1.ListOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("dubbobridges").
+		VersionedParams(&listOptions, scheme.ParameterCodec).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Patch applies the patch and returns the patched dubboBridge.
+func (c *dubboBridges) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.DubboBridge, err error) {
+	result = &v1alpha1.DubboBridge{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("dubbobridges").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
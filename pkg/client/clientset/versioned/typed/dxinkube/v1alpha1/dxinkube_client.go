@@ -0,0 +1,73 @@
+package v1alpha1
+
+import (
+	serializer "k8s.io/apimachinery/pkg/runtime/serializer"
+	rest "k8s.io/client-go/rest"
+
+	v1alpha1 "github.com/whypro/dxinkube/pkg/apis/dxinkube/v1alpha1"
+	"github.com/whypro/dxinkube/pkg/client/clientset/versioned/scheme"
+)
+
+type DxinkubeV1alpha1Interface interface {
+	RESTClient() rest.Interface
+	DubboBridgesGetter
+}
+
+// DxinkubeV1alpha1Client is used to interact with features provided by the dxinkube.whypro.github.io group.
+type DxinkubeV1alpha1Client struct {
+	restClient rest.Interface
+}
+
+func (c *DxinkubeV1alpha1Client) DubboBridges(namespace string) DubboBridgeInterface {
+	return newDubboBridges(c, namespace)
+}
+
+// NewForConfig creates a new DxinkubeV1alpha1Client for the given config.
+func NewForConfig(c *rest.Config) (*DxinkubeV1alpha1Client, error) {
+	config := *c
+	if err := setConfigDefaults(&config); err != nil {
+		return nil, err
+	}
+	client, err := rest.RESTClientFor(&config)
+	if err != nil {
+		return nil, err
+	}
+	return &DxinkubeV1alpha1Client{client}, nil
+}
+
+// NewForConfigOrDie creates a new DxinkubeV1alpha1Client for the given config and
+// panics if there is an error in the config.
+func NewForConfigOrDie(c *rest.Config) *DxinkubeV1alpha1Client {
+	client, err := NewForConfig(c)
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
+
+// New creates a new DxinkubeV1alpha1Client for the given RESTClient.
+func New(c rest.Interface) *DxinkubeV1alpha1Client {
+	return &DxinkubeV1alpha1Client{c}
+}
+
+func setConfigDefaults(config *rest.Config) error {
+	gv := v1alpha1.SchemeGroupVersion
+	config.GroupVersion = &gv
+	config.APIPath = "/apis"
+	config.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: scheme.Codecs}
+
+	if config.UserAgent == "" {
+		config.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+
+	return nil
+}
+
+// RESTClient returns a RESTClient that is used to communicate
+// with API server by this client implementation.
+func (c *DxinkubeV1alpha1Client) RESTClient() rest.Interface {
+	if c == nil {
+		return nil
+	}
+	return c.restClient
+}
@@ -0,0 +1,4 @@
+// This package is generated by client-gen with custom arguments.
+
+// Package fake has the automatically generated clients.
+package fake
@@ -0,0 +1,110 @@
+package fake
+
+import (
+	v1alpha1 "github.com/whypro/dxinkube/pkg/apis/dxinkube/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeDubboBridges implements DubboBridgeInterface
+type FakeDubboBridges struct {
+	Fake *FakeDxinkubeV1alpha1
+	ns   string
+}
+
+var dubbobridgesResource = schema.GroupVersionResource{Group: "dxinkube.whypro.github.io", Version: "v1alpha1", Resource: "dubbobridges"}
+
+var dubbobridgesKind = schema.GroupVersionKind{Group: "dxinkube.whypro.github.io", Version: "v1alpha1", Kind: "DubboBridge"}
+
+// Get takes name of the dubboBridge, and returns the corresponding dubboBridge object, and an error if there is any.
+func (c *FakeDubboBridges) Get(name string, options v1.GetOptions) (result *v1alpha1.DubboBridge, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(dubbobridgesResource, c.ns, name), &v1alpha1.DubboBridge{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.DubboBridge), err
+}
+
+// List takes label and field selectors, and returns the list of DubboBridges that match those selectors.
+func (c *FakeDubboBridges) List(opts v1.ListOptions) (result *v1alpha1.DubboBridgeList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(dubbobridgesResource, dubbobridgesKind, c.ns, opts), &v1alpha1.DubboBridgeList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha1.DubboBridgeList{}
+	for _, item := range obj.(*v1alpha1.DubboBridgeList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested dubboBridges.
+func (c *FakeDubboBridges) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(dubbobridgesResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a dubboBridge and creates it.  Returns the server's representation of the dubboBridge, and an error, if there is any.
+func (c *FakeDubboBridges) Create(dubboBridge *v1alpha1.DubboBridge) (result *v1alpha1.DubboBridge, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(dubbobridgesResource, c.ns, dubboBridge), &v1alpha1.DubboBridge{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.DubboBridge), err
+}
+
+// Update takes the representation of a dubboBridge and updates it. Returns the server's representation of the dubboBridge, and an error, if there is any.
+func (c *FakeDubboBridges) Update(dubboBridge *v1alpha1.DubboBridge) (result *v1alpha1.DubboBridge, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(dubbobridgesResource, c.ns, dubboBridge), &v1alpha1.DubboBridge{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.DubboBridge), err
+}
+
+// Delete takes name of the dubboBridge and deletes it. Returns an error if one occurs.
+func (c *FakeDubboBridges) Delete(name string, options *v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(dubbobridgesResource, c.ns, name), &v1alpha1.DubboBridge{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeDubboBridges) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(dubbobridgesResource, c.ns, listOptions)
+
+	_, err := c.Fake.Invokes(action, &v1alpha1.DubboBridgeList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched dubboBridge.
+func (c *FakeDubboBridges) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.DubboBridge, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(dubbobridgesResource, c.ns, name, data, subresources...), &v1alpha1.DubboBridge{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.DubboBridge), err
+}
@@ -0,0 +1,23 @@
+package fake
+
+import (
+	rest "k8s.io/client-go/rest"
+	testing "k8s.io/client-go/testing"
+
+	v1alpha1 "github.com/whypro/dxinkube/pkg/client/clientset/versioned/typed/dxinkube/v1alpha1"
+)
+
+type FakeDxinkubeV1alpha1 struct {
+	*testing.Fake
+}
+
+func (c *FakeDxinkubeV1alpha1) DubboBridges(namespace string) v1alpha1.DubboBridgeInterface {
+	return &FakeDubboBridges{c, namespace}
+}
+
+// RESTClient returns a RESTClient that is used to communicate
+// with API server by this client implementation.
+func (c *FakeDxinkubeV1alpha1) RESTClient() rest.Interface {
+	var ret *rest.RESTClient
+	return ret
+}
@@ -0,0 +1,28 @@
+// This file was automatically generated by informer-gen
+
+package dxinkube
+
+import (
+	v1alpha1 "github.com/whypro/dxinkube/pkg/client/informers/externalversions/dxinkube/v1alpha1"
+	internalinterfaces "github.com/whypro/dxinkube/pkg/client/informers/externalversions/internalinterfaces"
+)
+
+// Interface provides access to each of this group's versions.
+type Interface interface {
+	// V1alpha1 provides access to shared informers for resources in V1alpha1.
+	V1alpha1() v1alpha1.Interface
+}
+
+type group struct {
+	internalinterfaces.SharedInformerFactory
+}
+
+// New returns a new Interface.
+func New(f internalinterfaces.SharedInformerFactory) Interface {
+	return &group{f}
+}
+
+// V1alpha1 returns a new v1alpha1.Interface.
+func (g *group) V1alpha1() v1alpha1.Interface {
+	return v1alpha1.New(g.SharedInformerFactory)
+}
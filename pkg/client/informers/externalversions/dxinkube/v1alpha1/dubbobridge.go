@@ -0,0 +1,59 @@
+// This file was automatically generated by informer-gen
+
+package v1alpha1
+
+import (
+	time "time"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	watch "k8s.io/apimachinery/pkg/watch"
+	cache "k8s.io/client-go/tools/cache"
+
+	dxinkube_v1alpha1 "github.com/whypro/dxinkube/pkg/apis/dxinkube/v1alpha1"
+	versioned "github.com/whypro/dxinkube/pkg/client/clientset/versioned"
+	internalinterfaces "github.com/whypro/dxinkube/pkg/client/informers/externalversions/internalinterfaces"
+	v1alpha1 "github.com/whypro/dxinkube/pkg/client/listers/dxinkube/v1alpha1"
+)
+
+// DubboBridgeInformer provides access to a shared informer and lister for
+// DubboBridges.
+type DubboBridgeInformer interface {
+	Informer() cache.SharedIndexInformer
+	Lister() v1alpha1.DubboBridgeLister
+}
+
+type dubboBridgeInformer struct {
+	factory internalinterfaces.SharedInformerFactory
+}
+
+// NewDubboBridgeInformer constructs a new informer for DubboBridge type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewDubboBridgeInformer(client versioned.Interface, namespace string, resyncPeriod time.Duration, indexers cache.Indexers) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
+				return client.DxinkubeV1alpha1().DubboBridges(namespace).List(options)
+			},
+			WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
+				return client.DxinkubeV1alpha1().DubboBridges(namespace).Watch(options)
+			},
+		},
+		&dxinkube_v1alpha1.DubboBridge{},
+		resyncPeriod,
+		indexers,
+	)
+}
+
+func defaultDubboBridgeInformer(client versioned.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	return NewDubboBridgeInformer(client, v1.NamespaceAll, resyncPeriod, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+}
+
+func (f *dubboBridgeInformer) Informer() cache.SharedIndexInformer {
+	return f.factory.InformerFor(&dxinkube_v1alpha1.DubboBridge{}, defaultDubboBridgeInformer)
+}
+
+func (f *dubboBridgeInformer) Lister() v1alpha1.DubboBridgeLister {
+	return v1alpha1.NewDubboBridgeLister(f.Informer().GetIndexer())
+}
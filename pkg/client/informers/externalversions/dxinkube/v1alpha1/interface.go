@@ -0,0 +1,27 @@
+// This file was automatically generated by informer-gen
+
+package v1alpha1
+
+import (
+	internalinterfaces "github.com/whypro/dxinkube/pkg/client/informers/externalversions/internalinterfaces"
+)
+
+// Interface provides access to all the informers in this group version.
+type Interface interface {
+	// DubboBridges returns a DubboBridgeInformer.
+	DubboBridges() DubboBridgeInformer
+}
+
+type version struct {
+	internalinterfaces.SharedInformerFactory
+}
+
+// New returns a new Interface.
+func New(f internalinterfaces.SharedInformerFactory) Interface {
+	return &version{f}
+}
+
+// DubboBridges returns a DubboBridgeInformer.
+func (v *version) DubboBridges() DubboBridgeInformer {
+	return &dubboBridgeInformer{factory: v.SharedInformerFactory}
+}
@@ -0,0 +1,20 @@
+// This file was automatically generated by informer-gen
+
+package internalinterfaces
+
+import (
+	time "time"
+
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	cache "k8s.io/client-go/tools/cache"
+
+	versioned "github.com/whypro/dxinkube/pkg/client/clientset/versioned"
+)
+
+type NewInformerFunc func(versioned.Interface, time.Duration) cache.SharedIndexInformer
+
+// SharedInformerFactory a small interface to allow for adding an informer without an import cycle
+type SharedInformerFactory interface {
+	Start(stopCh <-chan struct{})
+	InformerFor(obj runtime.Object, newFunc NewInformerFunc) cache.SharedIndexInformer
+}
@@ -0,0 +1,78 @@
+// This file was automatically generated by lister-gen
+
+package v1alpha1
+
+import (
+	v1alpha1 "github.com/whypro/dxinkube/pkg/apis/dxinkube/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DubboBridgeLister helps list DubboBridges.
+type DubboBridgeLister interface {
+	// List lists all DubboBridges in the indexer.
+	List(selector labels.Selector) (ret []*v1alpha1.DubboBridge, err error)
+	// DubboBridges returns an object that can list and get DubboBridges.
+	DubboBridges(namespace string) DubboBridgeNamespaceLister
+	DubboBridgeListerExpansion
+}
+
+// dubboBridgeLister implements the DubboBridgeLister interface.
+type dubboBridgeLister struct {
+	indexer cache.Indexer
+}
+
+// NewDubboBridgeLister returns a new DubboBridgeLister.
+func NewDubboBridgeLister(indexer cache.Indexer) DubboBridgeLister {
+	return &dubboBridgeLister{indexer: indexer}
+}
+
+// List lists all DubboBridges in the indexer.
+func (s *dubboBridgeLister) List(selector labels.Selector) (ret []*v1alpha1.DubboBridge, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1alpha1.DubboBridge))
+	})
+	return ret, err
+}
+
+// DubboBridges returns an object that can list and get DubboBridges.
+func (s *dubboBridgeLister) DubboBridges(namespace string) DubboBridgeNamespaceLister {
+	return dubboBridgeNamespaceLister{indexer: s.indexer, namespace: namespace}
+}
+
+// DubboBridgeNamespaceLister helps list and get DubboBridges.
+type DubboBridgeNamespaceLister interface {
+	// List lists all DubboBridges in the indexer for a given namespace.
+	List(selector labels.Selector) (ret []*v1alpha1.DubboBridge, err error)
+	// Get retrieves the DubboBridge from the indexer for a given namespace and name.
+	Get(name string) (*v1alpha1.DubboBridge, error)
+	DubboBridgeNamespaceListerExpansion
+}
+
+// dubboBridgeNamespaceLister implements the DubboBridgeNamespaceLister
+// interface.
+type dubboBridgeNamespaceLister struct {
+	indexer   cache.Indexer
+	namespace string
+}
+
+// List lists all DubboBridges in the indexer for a given namespace.
+func (s dubboBridgeNamespaceLister) List(selector labels.Selector) (ret []*v1alpha1.DubboBridge, err error) {
+	err = cache.ListAllByNamespace(s.indexer, s.namespace, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1alpha1.DubboBridge))
+	})
+	return ret, err
+}
+
+// Get retrieves the DubboBridge from the indexer for a given namespace and name.
+func (s dubboBridgeNamespaceLister) Get(name string) (*v1alpha1.DubboBridge, error) {
+	obj, exists, err := s.indexer.GetByKey(s.namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(v1alpha1.Resource("dubbobridge"), name)
+	}
+	return obj.(*v1alpha1.DubboBridge), nil
+}
@@ -0,0 +1,11 @@
+// This file was automatically generated by lister-gen
+
+package v1alpha1
+
+// DubboBridgeListerExpansion allows custom methods to be added to
+// DubboBridgeLister.
+type DubboBridgeListerExpansion interface{}
+
+// DubboBridgeNamespaceListerExpansion allows custom methods to be added to
+// DubboBridgeNamespaceLister.
+type DubboBridgeNamespaceListerExpansion interface{}
@@ -1,54 +1,402 @@
 package controller
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/record"
 
+	"github.com/whypro/dxinkube/pkg/bridge"
 	"github.com/whypro/dxinkube/pkg/converter"
+	"github.com/whypro/dxinkube/pkg/dubbo"
+	"github.com/whypro/dxinkube/pkg/provisioner"
 	"github.com/whypro/dxinkube/pkg/registry"
 )
 
-type Config struct {
-	LocalZKConfig  *registry.ZookeeperConfig
-	RemoteZKConfig *registry.ZookeeperConfig
+const (
+	BackendZookeeper = "zookeeper"
+
+	AddrConverterTLB      = "tlb"
+	AddrConverterNodePort = "nodeport"
+	AddrConverterDirect   = "direct"
+
+	dryRunSummaryPeriod = time.Minute
+)
+
+// exposeOfAddrConverter maps the addr converters to their dxinkube/expose
+// annotation values.
+var exposeOfAddrConverter = map[string]string{
+	"":                    converter.ExposeLoadBalancer,
+	AddrConverterTLB:      converter.ExposeLoadBalancer,
+	AddrConverterNodePort: converter.ExposeNodePort,
+	AddrConverterDirect:   converter.ExposeDirect,
+}
+
+type RemoteRegistryConfig struct {
+	Name          string
+	Backend       string
+	ZKConfig      *registry.ZookeeperConfig
+	ServiceFilter *dubbo.ServiceFilter
+}
+
+// ClusterConfig describes one local kubernetes cluster and its local registry.
+type ClusterConfig struct {
+	ID            string
+	LocalZKConfig *registry.ZookeeperConfig
+	// AddrConverter selects how pod addresses are exposed, AddrConverterTLB
+	// by default
+	AddrConverter  string
 	TLBConfig      *converter.TLBControllerConfig
-	Namespace      string
+	NodePortConfig *converter.NodePortControllerConfig
+	// HostPortConfig enables bridging pods marked with dxinkube/expose=hostport
+	// through their host ports, other pods fall back to AddrConverter
+	HostPortConfig *converter.HostPortControllerConfig
+	// DirectConfig is used by AddrConverterDirect, or when it lists
+	// namespaces, for the pods of those namespaces ahead of AddrConverter
+	DirectConfig *converter.DirectControllerConfig
+	// ServiceExposeConfig enables choosing the converter per service from
+	// its dxinkube/expose annotation, AddrConverter is the default. Its
+	// Converters and Default are filled in by the controller.
+	ServiceExposeConfig *converter.ServiceExposeControllerConfig
+	// ProvisionerConfig enables provisioning the tlb services of annotated
+	// Deployments and Services
+	ProvisionerConfig *provisioner.ProvisionerConfig
+	// BridgeConfig enables bridging the providers selected by DubboBridge
+	// objects, its Registries are filled in by the controller
+	BridgeConfig *bridge.BridgeControllerConfig
+	// EventRecorder records the events of the providers on their DubboBridge
+	// or Service when set
+	EventRecorder record.EventRecorder
+	// ServiceStatusConfig enables annotating the services with what is
+	// published through them
+	ServiceStatusConfig *ServiceStatusConfig
+	// SnapshotStore persists the remote providers registered when set
+	SnapshotStore SnapshotStore
+}
+
+type Config struct {
+	Clusters              []*ClusterConfig
+	RemoteRegistryConfigs []*RemoteRegistryConfig
+	// DryRun records the remote registry mutations instead of applying them
+	DryRun bool
+	// DeletionGuardConfig enables pausing mass deletions from the remote
+	// registries, per cluster
+	DeletionGuardConfig *DeletionGuardConfig
+	// UnregisterGracePeriod keeps the remote providers gone locally
+	// registered for a while, they are unregistered right away when 0
+	UnregisterGracePeriod time.Duration
+	// AdoptUnmarked marks the unmarked remote providers a cluster desires
+	// with its id, once after the start
+	AdoptUnmarked bool
 }
 
 type ZKController struct {
-	config          *Config
-	providerManager *ProviderManager
+	config           *Config
+	providerManagers []*ProviderManager
+	provisioners     []*provisioner.Provisioner
+	bridges          []*bridge.BridgeController
+	dryRunRegistries map[string]*registry.DryRunRegistry
 }
 
 func NewZKController(config *Config) (*ZKController, error) {
 
-	tlbController, err := converter.NewTLBController(config.TLBConfig)
+	// remote registries are shared by every cluster, ownership markers keep
+	// the clusters from deleting each other's providers
+	remoteRegistries := make([]registry.Interface, 0, len(config.RemoteRegistryConfigs))
+	dryRunRegistries := make(map[string]*registry.DryRunRegistry)
+	for _, remoteConfig := range config.RemoteRegistryConfigs {
+		remoteRegistry, err := newRemoteRegistry(remoteConfig)
+		if err != nil {
+			glog.Errorf("create remote registry %s error, err: %v", remoteConfig.Name, err)
+			return nil, err
+		}
+		if config.DryRun {
+			dryRunRegistry := registry.NewDryRunRegistry(remoteRegistry, 3*refreshPeriod)
+			dryRunRegistries[remoteConfig.Name] = dryRunRegistry
+			remoteRegistry = dryRunRegistry
+		}
+		remoteRegistries = append(remoteRegistries, remoteRegistry)
+	}
+
+	providerManagers := make([]*ProviderManager, 0, len(config.Clusters))
+	provisioners := make([]*provisioner.Provisioner, 0)
+	bridges := make([]*bridge.BridgeController, 0)
+	for _, cluster := range config.Clusters {
+		if cluster.ProvisionerConfig != nil {
+			p, err := provisioner.NewProvisioner(cluster.ProvisionerConfig)
+			if err != nil {
+				glog.Errorf("create provisioner of cluster %s error, err: %v", cluster.ID, err)
+				return nil, err
+			}
+			provisioners = append(provisioners, p)
+		}
+
+		addrConverter, err := newAddrConverter(cluster)
+		if err != nil {
+			glog.Errorf("create %s addr converter of cluster %s error, err: %v", cluster.AddrConverter, cluster.ID, err)
+			return nil, err
+		}
+
+		localRegistry, err := registry.NewZookeeperRegistry(cluster.LocalZKConfig)
+		if err != nil {
+			glog.Errorf("create local zk registry of cluster %s error, err: %v", cluster.ID, err)
+			return nil, err
+		}
+
+		remotes := make([]*RemoteRegistry, 0, len(remoteRegistries))
+		for i, remoteConfig := range config.RemoteRegistryConfigs {
+			remotes = append(remotes, NewRemoteRegistry(remoteConfig.Name, remoteRegistries[i], remoteConfig.ServiceFilter))
+		}
+
+		providerManager := NewProviderManager(cluster.ID, addrConverter, localRegistry, remotes...)
+		if cluster.EventRecorder != nil {
+			providerManager.SetEventRecorder(cluster.EventRecorder)
+		}
+		providerManager.SetUnregisterGracePeriod(config.UnregisterGracePeriod)
+		providerManager.SetAdoptUnmarked(config.AdoptUnmarked)
+		// the providers recorded by a dry run are not registered, they are
+		// kept out of the snapshot
+		if cluster.SnapshotStore != nil && !config.DryRun {
+			providerManager.SetSnapshotStore(cluster.SnapshotStore)
+		}
+		if config.DeletionGuardConfig != nil {
+			guard, err := NewDeletionGuard(cluster.ID, config.DeletionGuardConfig)
+			if err != nil {
+				glog.Errorf("create deletion guard of cluster %s error, err: %v", cluster.ID, err)
+				return nil, err
+			}
+			providerManager.SetDeletionGuard(guard)
+		}
+		if cluster.ServiceStatusConfig != nil {
+			statusWriter, err := NewServiceStatusWriter(cluster.ServiceStatusConfig)
+			if err != nil {
+				glog.Errorf("create service status writer of cluster %s error, err: %v", cluster.ID, err)
+				return nil, err
+			}
+			providerManager.SetServiceStatusWriter(statusWriter)
+		}
+		if cluster.BridgeConfig != nil {
+			bridgeConfig := *cluster.BridgeConfig
+			bridgeConfig.Registries = make([]string, 0, len(config.RemoteRegistryConfigs))
+			for _, remoteConfig := range config.RemoteRegistryConfigs {
+				bridgeConfig.Registries = append(bridgeConfig.Registries, remoteConfig.Name)
+			}
+			bridgeController, err := bridge.NewBridgeController(&bridgeConfig)
+			if err != nil {
+				glog.Errorf("create bridge controller of cluster %s error, err: %v", cluster.ID, err)
+				return nil, err
+			}
+			providerManager.SetBridgePolicy(bridgeController)
+			bridges = append(bridges, bridgeController)
+		}
+		providerManagers = append(providerManagers, providerManager)
+	}
+
+	zkController := &ZKController{
+		config:           config,
+		providerManagers: providerManagers,
+		provisioners:     provisioners,
+		bridges:          bridges,
+		dryRunRegistries: dryRunRegistries,
+	}
+
+	return zkController, nil
+}
+
+// newBaseAddrConverter returns the converter name, sharing the informers of
+// informerFactory when it is not nil.
+func newBaseAddrConverter(cluster *ClusterConfig, name string, informerFactory informers.SharedInformerFactory) (converter.AddrConverterInterface, error) {
+	switch name {
+	case "", AddrConverterTLB:
+		tlbConfig := *cluster.TLBConfig
+		tlbConfig.InformerFactory = informerFactory
+		return converter.NewTLBController(&tlbConfig)
+	case AddrConverterNodePort:
+		nodePortConfig := *cluster.NodePortConfig
+		nodePortConfig.InformerFactory = informerFactory
+		return converter.NewNodePortController(&nodePortConfig)
+	case AddrConverterDirect:
+		// every namespace is passed through
+		directConfig := *cluster.DirectConfig
+		directConfig.Namespaces = nil
+		directConfig.InformerFactory = informerFactory
+		return converter.NewDirectController(&directConfig)
+	default:
+		return nil, fmt.Errorf("unsupported addr converter %q", name)
+	}
+}
+
+// newServiceExposeConverter returns a converter choosing one of every
+// converter from the dxinkube/expose annotation of the services.
+func newServiceExposeConverter(cluster *ClusterConfig) (converter.AddrConverterInterface, error) {
+	defaultExpose, ok := exposeOfAddrConverter[cluster.AddrConverter]
+	if !ok {
+		return nil, fmt.Errorf("unsupported addr converter %q", cluster.AddrConverter)
+	}
+
+	config := *cluster.ServiceExposeConfig
+	informerFactory, err := converter.NewInformerFactory(config.KubeConfig, config.KubeClient, config.ResyncPeriod)
 	if err != nil {
-		glog.Errorf("create tlb controller error, err: %v", err)
 		return nil, err
 	}
-
-	localRegistry, err := registry.NewZookeeperRegistry(config.LocalZKConfig)
+	config.InformerFactory = informerFactory
+	config.Default = defaultExpose
+	config.Converters = make(map[string]converter.AddrConverterInterface)
+	for _, name := range []string{AddrConverterTLB, AddrConverterNodePort, AddrConverterDirect} {
+		addrConverter, err := newBaseAddrConverter(cluster, name, informerFactory)
+		if err != nil {
+			return nil, err
+		}
+		config.Converters[exposeOfAddrConverter[name]] = addrConverter
+	}
+	hostPortController, err := converter.NewHostPortController(&converter.HostPortControllerConfig{
+		KubeConfig:      config.KubeConfig,
+		KubeClient:      config.KubeClient,
+		ResyncPeriod:    config.ResyncPeriod,
+		Namespace:       config.Namespace,
+		AllPods:         true,
+		InformerFactory: informerFactory,
+	})
 	if err != nil {
-		glog.Errorf("create local zk registry error, err: %v", err)
 		return nil, err
 	}
+	config.Converters[converter.ExposeHostPort] = hostPortController
 
-	remoteRegistry, err := registry.NewZookeeperRegistry(config.RemoteZKConfig)
+	return converter.NewServiceExposeController(&config)
+}
+
+func newAddrConverter(cluster *ClusterConfig) (converter.AddrConverterInterface, error) {
+	var addrConverter converter.AddrConverterInterface
+	var err error
+	if cluster.ServiceExposeConfig != nil {
+		addrConverter, err = newServiceExposeConverter(cluster)
+	} else {
+		addrConverter, err = newBaseAddrConverter(cluster, cluster.AddrConverter, nil)
+	}
 	if err != nil {
-		glog.Errorf("create remote zk registry error, err: %v", err)
 		return nil, err
 	}
 
-	dubboProviderManager := NewProviderManager(tlbController, localRegistry, remoteRegistry)
+	chain := converter.NewChain()
+	if cluster.HostPortConfig != nil {
+		hostPortController, err := converter.NewHostPortController(cluster.HostPortConfig)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, hostPortController)
+	}
+	if cluster.AddrConverter != AddrConverterDirect && cluster.DirectConfig != nil && len(cluster.DirectConfig.Namespaces) > 0 {
+		directController, err := converter.NewDirectController(cluster.DirectConfig)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, directController)
+	}
+	if len(chain) == 0 {
+		return addrConverter, nil
+	}
+	return append(chain, addrConverter), nil
+}
 
-	zkController := &ZKController{
-		config:          config,
-		providerManager: dubboProviderManager,
+func newRemoteRegistry(config *RemoteRegistryConfig) (registry.Interface, error) {
+	switch config.Backend {
+	case "", BackendZookeeper:
+		return registry.NewZookeeperRegistry(config.ZKConfig)
+	default:
+		return nil, fmt.Errorf("unsupported registry backend %q", config.Backend)
 	}
+}
 
-	return zkController, nil
+// DryRunSummary returns the mutations recorded per remote registry, it is
+// empty unless running in dry-run mode.
+func (c *ZKController) DryRunSummary() map[string]registry.DryRunSummary {
+	summaries := make(map[string]registry.DryRunSummary)
+	for name, r := range c.dryRunRegistries {
+		summaries[name] = r.Summary()
+	}
+	return summaries
+}
+
+func (c *ZKController) logDryRunSummary() {
+	for name, summary := range c.DryRunSummary() {
+		glog.Infof("[dry-run] remote registry %s: %d providers would be created, %d would be deleted", name, len(summary.Created), len(summary.Deleted))
+		for _, record := range summary.Created {
+			glog.Infof("[dry-run] remote registry %s: would create %s", name, record.URL)
+		}
+		for _, record := range summary.Deleted {
+			glog.Infof("[dry-run] remote registry %s: would delete %s", name, record.URL)
+		}
+	}
+}
+
+// PausedDeletions returns the deletions held by the deletion guards, by
+// cluster id.
+func (c *ZKController) PausedDeletions() map[string][]PausedDeletions {
+	paused := make(map[string][]PausedDeletions)
+	for _, providerManager := range c.providerManagers {
+		paused[providerManager.clusterID] = providerManager.PausedDeletions()
+	}
+	return paused
+}
+
+// PendingDeletions returns the remote providers waiting for their grace
+// period to end, by cluster id.
+func (c *ZKController) PendingDeletions() map[string][]PendingDeletion {
+	pending := make(map[string][]PendingDeletion)
+	for _, providerManager := range c.providerManagers {
+		pending[providerManager.clusterID] = providerManager.PendingDeletions()
+	}
+	return pending
+}
+
+// ConfirmDeletions lets the deletions held from a remote registry in a
+// cluster proceed.
+func (c *ZKController) ConfirmDeletions(clusterID string, registry string) error {
+	for _, providerManager := range c.providerManagers {
+		if providerManager.clusterID == clusterID {
+			return providerManager.ConfirmDeletions(registry)
+		}
+	}
+	return fmt.Errorf("unknown cluster %q", clusterID)
+}
+
+// SnapshotStatuses returns the snapshot and the drift of the clusters
+// persisting one, by cluster id.
+func (c *ZKController) SnapshotStatuses() map[string]*SnapshotStatus {
+	statuses := make(map[string]*SnapshotStatus)
+	for _, providerManager := range c.providerManagers {
+		if providerManager.snapshots != nil {
+			statuses[providerManager.clusterID] = providerManager.SnapshotStatus()
+		}
+	}
+	return statuses
+}
+
+// HasSynced tells whether every cluster has synced its caches and listed its
+// local registry.
+func (c *ZKController) HasSynced() bool {
+	for _, providerManager := range c.providerManagers {
+		if !providerManager.HasSynced() {
+			return false
+		}
+	}
+	return true
 }
 
 func (c *ZKController) Run(stopCh <-chan struct{}) {
-	go c.providerManager.Run(stopCh)
+	for _, providerManager := range c.providerManagers {
+		go providerManager.Run(stopCh)
+	}
+	for _, p := range c.provisioners {
+		go p.Run(stopCh)
+	}
+	for _, b := range c.bridges {
+		go b.Run(stopCh)
+	}
+	if c.config.DryRun {
+		go wait.Until(c.logDryRunSummary, dryRunSummaryPeriod, stopCh)
+	}
 }
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/whypro/dxinkube/pkg/bridge"
+	"github.com/whypro/dxinkube/pkg/converter"
+)
+
+const (
+	eventComponent = "dxinkube"
+
+	EventReasonRegistered    = "Registered"
+	EventReasonUnregistered  = "Unregistered"
+	EventReasonConvertFailed = "ConvertFailed"
+	EventReasonRegistryError = "RegistryError"
+	// EventReasonDeletionsPaused is recorded once per pause on the objects
+	// of the providers held
+	EventReasonDeletionsPaused = "DeletionsPaused"
+)
+
+// NewEventRecorder returns a recorder sending events to the cluster of
+// kubeClient.
+func NewEventRecorder(kubeClient kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(glog.V(4).Infof)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: eventComponent})
+}
+
+func serviceReference(svc *v1.Service) *v1.ObjectReference {
+	return &v1.ObjectReference{
+		APIVersion:      "v1",
+		Kind:            "Service",
+		Namespace:       svc.Namespace,
+		Name:            svc.Name,
+		UID:             svc.UID,
+		ResourceVersion: svc.ResourceVersion,
+	}
+}
+
+// objectOf returns the object the events of a provider are recorded on, its
+// DubboBridge if any, otherwise the service its pod addr is exposed through.
+func (m *ProviderManager) objectOf(podAddr string, b *bridge.Bridge) *v1.ObjectReference {
+	if b != nil && b.Ref != nil {
+		return b.Ref
+	}
+	locator, ok := m.addrConverter.(converter.ServiceLocator)
+	if !ok {
+		return nil
+	}
+	svc, ok := locator.ServiceOfAddr(podAddr)
+	if !ok {
+		return nil
+	}
+	return serviceReference(svc)
+}
+
+// eventf records an event on ref, events of providers without a related
+// object are only logged.
+func (m *ProviderManager) eventf(ref *v1.ObjectReference, eventType, reason, messageFmt string, args ...interface{}) {
+	if m.recorder == nil || ref == nil {
+		return
+	}
+	m.recorder.Eventf(ref, eventType, reason, messageFmt, args...)
+}
+
+// localRegistryErrorEvents records a failure to list the local registry on
+// the objects of the providers held, once per object.
+func (m *ProviderManager) localRegistryErrorEvents(err error) {
+	refs := make(map[string]*v1.ObjectReference)
+	for _, ref := range m.providerRefs {
+		if ref != nil {
+			refs[ref.Kind+"/"+ref.Namespace+"/"+ref.Name] = ref
+		}
+	}
+	for _, ref := range refs {
+		m.eventf(ref, v1.EventTypeWarning, EventReasonRegistryError, "List providers of the local registry error: %v", err)
+	}
+}
+
+// deletionsPausedEvents records the pause of the deletions from remote on the
+// objects of the providers held, once per object.
+func (m *ProviderManager) deletionsPausedEvents(remote *RemoteRegistry, deleted sets.String) {
+	refs := make(map[string]*v1.ObjectReference)
+	for key := range deleted {
+		if ref := m.providerRefs[key]; ref != nil {
+			refs[ref.Kind+"/"+ref.Namespace+"/"+ref.Name] = ref
+		}
+	}
+	for _, ref := range refs {
+		m.eventf(ref, v1.EventTypeWarning, EventReasonDeletionsPaused, "Paused unregistering %d providers from %s, confirm through the admin api", deleted.Len(), remote.Name)
+	}
+}
@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/whypro/dxinkube/pkg/converter"
+	dxtesting "github.com/whypro/dxinkube/pkg/testing"
+)
+
+// locatingConverter locates the same service for every addr, and fails the
+// addrs of errs.
+type locatingConverter struct {
+	*dxtesting.FakeAddrConverter
+	svc  *v1.Service
+	errs map[string]error
+}
+
+func (c *locatingConverter) ConvertAddr(podAddr string) (string, error) {
+	if err, ok := c.errs[podAddr]; ok {
+		return "", err
+	}
+	return c.FakeAddrConverter.ConvertAddr(podAddr)
+}
+
+func (c *locatingConverter) ServiceOfAddr(podAddr string) (*v1.Service, bool) {
+	return c.svc, true
+}
+
+func drainEvents(recorder *record.FakeRecorder) []string {
+	events := make([]string, 0)
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func countReason(events []string, reason string) int {
+	count := 0
+	for _, event := range events {
+		if strings.Contains(event, " "+reason+" ") {
+			count++
+		}
+	}
+	return count
+}
+
+func TestConvertFailedEvents(t *testing.T) {
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "demo"}}
+	conv := &locatingConverter{
+		FakeAddrConverter: dxtesting.NewFakeAddrConverter(map[string]string{"10.0.0.1:20880": "2.2.2.1:20880"}),
+		svc:               svc,
+	}
+	local := dxtesting.NewFakeRegistry(
+		"dubbo://10.0.0.1:20880/com.foo.Bar?anyhost=true&timestamp=1",
+		"dubbo://10.0.0.2:20880/com.foo.Baz?anyhost=true&timestamp=1",
+	)
+	remote := dxtesting.NewFakeRegistry()
+	m := NewProviderManager("", conv, local, NewRemoteRegistry("remote", remote, nil))
+	recorder := record.NewFakeRecorder(100)
+	m.SetEventRecorder(recorder)
+
+	m.Refresh()
+	if n := countReason(drainEvents(recorder), EventReasonConvertFailed); n != 1 {
+		t.Errorf("expected 1 %s event on the first failure, got %d", EventReasonConvertFailed, n)
+	}
+	m.Refresh()
+	if n := countReason(drainEvents(recorder), EventReasonConvertFailed); n != 0 {
+		t.Errorf("expected no %s event while the failure lasts, got %d", EventReasonConvertFailed, n)
+	}
+
+	// the failure appears again once it was resolved
+	conv.Set("10.0.0.2:20880", "2.2.2.2:20880")
+	m.Refresh()
+	conv.Delete("10.0.0.2:20880")
+	m.Refresh()
+	if n := countReason(drainEvents(recorder), EventReasonConvertFailed); n != 1 {
+		t.Errorf("expected 1 %s event when the failure appears again, got %d", EventReasonConvertFailed, n)
+	}
+}
+
+func TestConvertFailedEventsReason(t *testing.T) {
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "demo"}}
+	conv := &locatingConverter{
+		FakeAddrConverter: dxtesting.NewFakeAddrConverter(nil),
+		svc:               svc,
+		errs: map[string]error{
+			"10.0.0.1:20880": &converter.ConvertError{Reason: converter.ReasonPodNotFound, Addr: "10.0.0.1:20880", Message: "no pod has the ip"},
+		},
+	}
+	local := dxtesting.NewFakeRegistry("dubbo://10.0.0.1:20880/com.foo.Bar?anyhost=true&timestamp=1")
+	m := NewProviderManager("", conv, local, NewRemoteRegistry("remote", dxtesting.NewFakeRegistry(), nil))
+	recorder := record.NewFakeRecorder(100)
+	m.SetEventRecorder(recorder)
+
+	m.Refresh()
+	m.Refresh()
+	if n := countReason(drainEvents(recorder), EventReasonConvertFailed); n != 1 {
+		t.Errorf("expected 1 %s event while the reason lasts, got %d", EventReasonConvertFailed, n)
+	}
+
+	conv.errs["10.0.0.1:20880"] = &converter.ConvertError{Reason: converter.ReasonTLBNotProvisioned, Addr: "10.0.0.1:20880", Message: "tlb service ns/demo has no load balancer ingress"}
+	m.Refresh()
+	events := drainEvents(recorder)
+	if n := countReason(events, EventReasonConvertFailed); n != 1 {
+		t.Fatalf("expected 1 %s event when the reason changes, got %d", EventReasonConvertFailed, n)
+	}
+	if !strings.Contains(events[0], converter.ReasonTLBNotProvisioned) {
+		t.Errorf("expected the event to tell the reason %s, got %q", converter.ReasonTLBNotProvisioned, events[0])
+	}
+}
+
+func TestLocalRegistryErrorEvents(t *testing.T) {
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "demo"}}
+	conv := &locatingConverter{
+		FakeAddrConverter: dxtesting.NewFakeAddrConverter(map[string]string{"10.0.0.1:20880": "2.2.2.1:20880"}),
+		svc:               svc,
+	}
+	local := dxtesting.NewFakeRegistry("dubbo://10.0.0.1:20880/com.foo.Bar?anyhost=true&timestamp=1")
+	remote := dxtesting.NewFakeRegistry()
+	m := NewProviderManager("", conv, local, NewRemoteRegistry("remote", remote, nil))
+	recorder := record.NewFakeRecorder(100)
+	m.SetEventRecorder(recorder)
+
+	m.Refresh()
+	drainEvents(recorder)
+
+	local.SetError(dxtesting.VerbList, errors.New("zk: connection closed"))
+	m.Refresh()
+	m.Refresh()
+	if n := countReason(drainEvents(recorder), EventReasonRegistryError); n != 1 {
+		t.Errorf("expected 1 %s event while listing fails, got %d", EventReasonRegistryError, n)
+	}
+
+	local.SetError(dxtesting.VerbList, nil)
+	m.Refresh()
+	local.SetError(dxtesting.VerbList, errors.New("zk: connection closed"))
+	m.Refresh()
+	if n := countReason(drainEvents(recorder), EventReasonRegistryError); n != 1 {
+		t.Errorf("expected 1 %s event when listing fails again, got %d", EventReasonRegistryError, n)
+	}
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// PendingDeletion is a remote provider gone locally and kept registered
+// until its grace period ends.
+type PendingDeletion struct {
+	Registry    string    `json:"registry"`
+	Provider    string    `json:"provider"`
+	URL         string    `json:"url"`
+	LastSeen    time.Time `json:"last_seen"`
+	DeleteAfter time.Time `json:"delete_after"`
+}
+
+// SetUnregisterGracePeriod keeps the remote providers gone locally
+// registered for gracePeriod after they were last seen, so pods flapping or
+// a short local registry outage do not unregister them.
+func (m *ProviderManager) SetUnregisterGracePeriod(gracePeriod time.Duration) {
+	m.unregisterGracePeriod = gracePeriod
+}
+
+// PendingDeletions returns the remote providers waiting for their grace
+// period to end, sorted by registry and provider.
+func (m *ProviderManager) PendingDeletions() []PendingDeletion {
+	m.pendingLock.Lock()
+	defer m.pendingLock.Unlock()
+	pending := make([]PendingDeletion, 0)
+	for _, deletions := range m.pending {
+		pending = append(pending, deletions...)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].Registry != pending[j].Registry {
+			return pending[i].Registry < pending[j].Registry
+		}
+		return pending[i].Provider < pending[j].Provider
+	})
+	return pending
+}
+
+// holdDisappeared returns the providers of deleted whose grace period
+// ended, and records when the desired ones were last seen. Providers of not
+// ready addrs are withdrawn on purpose and returned right away, providers
+// never seen since the start are seen for the first time now.
+func (m *ProviderManager) holdDisappeared(remote *RemoteRegistry, desired sets.String, deleted sets.String, now time.Time) sets.String {
+	for key := range desired {
+		remote.lastSeen[key] = now
+	}
+	for key := range remote.lastSeen {
+		if !desired.Has(key) && !remote.currentProviders.Has(key) {
+			delete(remote.lastSeen, key)
+		}
+	}
+
+	expired := sets.NewString()
+	pending := make([]PendingDeletion, 0)
+	for key := range deleted {
+		if podAddr, ok := m.podAddrs[key]; ok && m.notReadyAddrs.Has(podAddr) {
+			expired.Insert(key)
+			continue
+		}
+		lastSeen, ok := remote.lastSeen[key]
+		if !ok {
+			lastSeen = now
+			remote.lastSeen[key] = now
+		}
+		deleteAfter := lastSeen.Add(m.unregisterGracePeriod)
+		if !now.Before(deleteAfter) {
+			expired.Insert(key)
+			continue
+		}
+		pending = append(pending, PendingDeletion{
+			Registry:    remote.Name,
+			Provider:    key,
+			URL:         remote.remoteProvidersMapper[key].String(),
+			LastSeen:    lastSeen,
+			DeleteAfter: deleteAfter,
+		})
+	}
+	if len(pending) > 0 {
+		glog.V(4).Infof("[%s] %d providers gone locally are kept in %s for their grace period", m.clusterID, len(pending), remote.Name)
+	}
+
+	m.pendingLock.Lock()
+	m.pending[remote.Name] = pending
+	m.pendingLock.Unlock()
+	return expired
+}
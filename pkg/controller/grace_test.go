@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/whypro/dxinkube/pkg/converter"
+	"github.com/whypro/dxinkube/pkg/dubbo"
+	dxtesting "github.com/whypro/dxinkube/pkg/testing"
+)
+
+// notReadyAddrConverter is a fake converter withholding the not ready addrs.
+type notReadyAddrConverter struct {
+	*dxtesting.FakeAddrConverter
+	notReady sets.String
+}
+
+func (c *notReadyAddrConverter) ConvertAddr(podAddr string) (string, error) {
+	if c.notReady.Has(podAddr) {
+		return "", converter.ErrNotReady
+	}
+	return c.FakeAddrConverter.ConvertAddr(podAddr)
+}
+
+func unRegisterLocal(t *testing.T, local *dxtesting.FakeRegistry, url string) {
+	provider := dubbo.NewProvider()
+	if err := provider.Parse(url); err != nil {
+		t.Fatalf("parse provider error, err: %v", err)
+	}
+	if err := local.UnRegister(provider); err != nil {
+		t.Fatalf("unregister provider error, err: %v", err)
+	}
+}
+
+func TestRefreshUnregisterGracePeriod(t *testing.T) {
+	local := dxtesting.NewFakeRegistry(
+		"dubbo://10.0.0.1:20880/com.foo.Bar?anyhost=true&timestamp=1",
+		"dubbo://10.0.0.2:20880/com.foo.Baz?anyhost=true&timestamp=1",
+		"dubbo://10.0.0.3:20880/com.foo.Qux?anyhost=true&timestamp=1",
+	)
+	remote := dxtesting.NewFakeRegistry()
+	addrConverter := &notReadyAddrConverter{
+		FakeAddrConverter: dxtesting.NewFakeAddrConverter(map[string]string{
+			"10.0.0.1:20880": "2.2.2.1:20880",
+			"10.0.0.2:20880": "2.2.2.2:20880",
+			"10.0.0.3:20880": "2.2.2.3:20880",
+		}),
+		notReady: sets.NewString(),
+	}
+	m := NewProviderManager("", addrConverter, local, NewRemoteRegistry("remote", remote, nil))
+	m.SetUnregisterGracePeriod(time.Minute)
+	start := time.Date(2018, 5, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	m.now = func() time.Time { return now }
+
+	m.Refresh()
+	if keys := remote.Keys(); len(keys) != 3 {
+		t.Fatalf("expected 3 remote providers, got %v", keys)
+	}
+	bazURL := ""
+	for _, url := range remote.Providers() {
+		if dxtesting.ProviderKeys([]string{url})[0] == "dubbo://2.2.2.2:20880/com.foo.Baz" {
+			bazURL = url
+		}
+	}
+
+	// Baz is gone locally and kept for its grace period, Qux is not ready
+	// and withdrawn right away
+	unRegisterLocal(t, local, "dubbo://10.0.0.2:20880/com.foo.Baz?anyhost=true&timestamp=1")
+	addrConverter.notReady.Insert("10.0.0.3:20880")
+	now = start.Add(30 * time.Second)
+	m.Refresh()
+	expected := []string{
+		"dubbo://2.2.2.1:20880/com.foo.Bar",
+		"dubbo://2.2.2.2:20880/com.foo.Baz",
+	}
+	if keys := remote.Keys(); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected remote providers %v, got %v", expected, keys)
+	}
+	expectedPending := []PendingDeletion{{
+		Registry:    "remote",
+		Provider:    "dubbo://2.2.2.2:20880/com.foo.Baz",
+		URL:         bazURL,
+		LastSeen:    start,
+		DeleteAfter: start.Add(time.Minute),
+	}}
+	if pending := m.PendingDeletions(); !reflect.DeepEqual(pending, expectedPending) {
+		t.Errorf("expected pending deletions %+v, got %+v", expectedPending, pending)
+	}
+	// as served on /deletions/pending
+	data, err := json.Marshal(m.PendingDeletions())
+	if err != nil {
+		t.Fatalf("marshal pending deletions error, err: %v", err)
+	}
+	served := make([]map[string]string, 0)
+	if err := json.Unmarshal(data, &served); err != nil {
+		t.Fatalf("unmarshal pending deletions error, err: %v", err)
+	}
+	expectedServed := []map[string]string{{
+		"registry":     "remote",
+		"provider":     "dubbo://2.2.2.2:20880/com.foo.Baz",
+		"url":          bazURL,
+		"last_seen":    "2018-05-01T00:00:00Z",
+		"delete_after": "2018-05-01T00:01:00Z",
+	}}
+	if !reflect.DeepEqual(served, expectedServed) {
+		t.Errorf("expected %v served, got %v", expectedServed, served)
+	}
+
+	// it is unregistered once its grace period ends
+	now = start.Add(time.Minute)
+	m.Refresh()
+	expected = []string{"dubbo://2.2.2.1:20880/com.foo.Bar"}
+	if keys := remote.Keys(); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected remote providers %v, got %v", expected, keys)
+	}
+	if pending := m.PendingDeletions(); len(pending) != 0 {
+		t.Errorf("expected no pending deletion, got %+v", pending)
+	}
+}
+
+func TestRefreshGracePeriodReturning(t *testing.T) {
+	local := dxtesting.NewFakeRegistry("dubbo://10.0.0.1:20880/com.foo.Bar?anyhost=true&timestamp=1")
+	remote := dxtesting.NewFakeRegistry()
+	addrConverter := dxtesting.NewFakeAddrConverter(map[string]string{"10.0.0.1:20880": "2.2.2.1:20880"})
+	m := NewProviderManager("", addrConverter, local, NewRemoteRegistry("remote", remote, nil))
+	m.SetUnregisterGracePeriod(time.Minute)
+	start := time.Date(2018, 5, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	m.now = func() time.Time { return now }
+	m.Refresh()
+
+	// a provider flapping within its grace period is never unregistered
+	unRegisterLocal(t, local, "dubbo://10.0.0.1:20880/com.foo.Bar?anyhost=true&timestamp=1")
+	now = start.Add(30 * time.Second)
+	m.Refresh()
+	local.AddNodes("dubbo%3A%2F%2F10.0.0.1%3A20880%2Fcom.foo.Bar%3Fanyhost%3Dtrue%26timestamp%3D1")
+	now = start.Add(2 * time.Minute)
+	remote.ClearActions()
+	m.Refresh()
+	if actions := remote.Actions(); len(actions) != 1 {
+		t.Errorf("expected only the list action, got %+v", actions)
+	}
+	if pending := m.PendingDeletions(); len(pending) != 0 {
+		t.Errorf("expected no pending deletion, got %+v", pending)
+	}
+}
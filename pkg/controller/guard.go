@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"expvar"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// deletionsPaused counts the pauses of the deletions, by cluster and remote
+// registry. It is served with the other expvars.
+var deletionsPaused = expvar.NewMap("dxinkube_deletions_paused_total")
+
+type DeletionGuardConfig struct {
+	// MaxPercent is the largest share of the providers of a remote registry
+	// unregistered in one refresh, unlimited when 0
+	MaxPercent int
+	// MaxCount is the most providers of a remote registry unregistered in
+	// one refresh, unlimited when 0
+	MaxCount int
+	// MinCount is the most deletions never paused by MaxPercent, so small
+	// registries are not held. An empty local listing pauses whatever the
+	// count
+	MinCount int
+	// GracePeriod is how long a pause lasts before the deletions proceed
+	// anyway, they wait for a confirmation when 0
+	GracePeriod time.Duration
+}
+
+// PausedDeletions are the deletions from a remote registry held by the guard.
+type PausedDeletions struct {
+	Registry string `json:"registry"`
+	Reason   string `json:"reason"`
+	// Deletions and Providers are the providers to unregister and the
+	// providers owned in the remote registry, as of the last refresh
+	Deletions int       `json:"deletions"`
+	Providers int       `json:"providers"`
+	Since     time.Time `json:"since"`
+	Confirmed bool      `json:"confirmed"`
+
+	// deleted are the deletions paused, kept as they are once confirmed so
+	// more deletions pause again
+	deleted sets.String
+}
+
+// DeletionGuard pauses the deletions from a remote registry when a refresh
+// would unregister too many providers at once, or when no local provider is
+// listed, as after a local registry restarted empty. Paused deletions
+// proceed once confirmed, or when the condition lasted the grace period.
+type DeletionGuard struct {
+	config    *DeletionGuardConfig
+	clusterID string
+
+	lock   sync.Mutex
+	paused map[string]*PausedDeletions
+}
+
+func NewDeletionGuard(clusterID string, config *DeletionGuardConfig) (*DeletionGuard, error) {
+	if config.MaxPercent < 0 || config.MaxPercent > 100 {
+		return nil, fmt.Errorf("invalid deletion guard max percent %d", config.MaxPercent)
+	}
+	if config.MaxCount < 0 {
+		return nil, fmt.Errorf("invalid deletion guard max count %d", config.MaxCount)
+	}
+	if config.MinCount < 0 {
+		return nil, fmt.Errorf("invalid deletion guard min count %d", config.MinCount)
+	}
+	return &DeletionGuard{
+		config:    config,
+		clusterID: clusterID,
+		paused:    make(map[string]*PausedDeletions),
+	}, nil
+}
+
+// reasonOf returns why deleting deletions of the providers owned in a remote
+// registry is suspicious, empty when it is not.
+func (g *DeletionGuard) reasonOf(localProviders int, deletions int, providers int) string {
+	switch {
+	case g.config.MaxCount > 0 && deletions > g.config.MaxCount:
+		return fmt.Sprintf("%d deletions exceed the max count %d", deletions, g.config.MaxCount)
+	case localProviders == 0:
+		return "no local provider is listed"
+	case deletions <= g.config.MinCount:
+		return ""
+	case g.config.MaxPercent > 0 && deletions*100 > g.config.MaxPercent*providers:
+		return fmt.Sprintf("%d deletions of %d providers exceed %d%%", deletions, providers, g.config.MaxPercent)
+	}
+	return ""
+}
+
+// Allow tells whether deleting deleted of the providers owned in registry
+// may proceed, and whether they were just paused.
+func (g *DeletionGuard) Allow(registry string, localProviders int, deleted sets.String, providers int, now time.Time) (bool, bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	deletions := deleted.Len()
+	reason := ""
+	if deletions > 0 {
+		reason = g.reasonOf(localProviders, deletions, providers)
+	}
+	if reason == "" {
+		delete(g.paused, registry)
+		return true, false
+	}
+
+	p, ok := g.paused[registry]
+	if ok && p.Confirmed && !p.deleted.IsSuperset(deleted) {
+		glog.Warningf("[%s] deletions from %s grew past the %d confirmed, pause again", g.clusterID, registry, p.deleted.Len())
+		ok = false
+	}
+	if !ok {
+		p = &PausedDeletions{Registry: registry, Since: now}
+		g.paused[registry] = p
+		deletionsPaused.Add(g.clusterID+"/"+registry, 1)
+	}
+	p.Reason = reason
+	if !p.Confirmed {
+		p.deleted = sets.NewString(deleted.UnsortedList()...)
+	}
+	p.Deletions = deletions
+	p.Providers = providers
+
+	switch {
+	case p.Confirmed:
+		glog.Infof("[%s] confirmed deletions from %s proceed, %s", g.clusterID, registry, reason)
+	case g.config.GracePeriod > 0 && now.Sub(p.Since) >= g.config.GracePeriod:
+		glog.Infof("[%s] deletions from %s paused for %v proceed, %s", g.clusterID, registry, now.Sub(p.Since), reason)
+	default:
+		return false, !ok
+	}
+	delete(g.paused, registry)
+	return true, false
+}
+
+// Confirm lets the paused deletions from registry proceed on the next
+// refresh, as long as they are not more than those paused.
+func (g *DeletionGuard) Confirm(registry string) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	p, ok := g.paused[registry]
+	if !ok {
+		return fmt.Errorf("no paused deletions from %s", registry)
+	}
+	p.Confirmed = true
+	return nil
+}
+
+// Paused returns the paused deletions sorted by registry.
+func (g *DeletionGuard) Paused() []PausedDeletions {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	paused := make([]PausedDeletions, 0, len(g.paused))
+	for _, p := range g.paused {
+		paused = append(paused, *p)
+	}
+	sort.Slice(paused, func(i, j int) bool { return paused[i].Registry < paused[j].Registry })
+	return paused
+}
@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	dxtesting "github.com/whypro/dxinkube/pkg/testing"
+)
+
+func deletionKeys(n int) sets.String {
+	keys := sets.NewString()
+	for i := 0; i < n; i++ {
+		keys.Insert(fmt.Sprintf("dubbo://2.2.2.%d:20880/com.foo.Bar", i))
+	}
+	return keys
+}
+
+func TestDeletionGuardAllow(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         DeletionGuardConfig
+		localProviders int
+		deletions      int
+		providers      int
+		allowed        bool
+	}{
+		{
+			name:           "small registry",
+			config:         DeletionGuardConfig{MaxPercent: 50, MinCount: 10},
+			localProviders: 1,
+			deletions:      3,
+			providers:      4,
+			allowed:        true,
+		},
+		{
+			name:           "no local provider below the min count",
+			config:         DeletionGuardConfig{MaxPercent: 50, MinCount: 10},
+			localProviders: 0,
+			deletions:      2,
+			providers:      2,
+			allowed:        false,
+		},
+		{
+			name:           "no local provider",
+			config:         DeletionGuardConfig{MinCount: 10},
+			localProviders: 0,
+			deletions:      20,
+			providers:      20,
+			allowed:        false,
+		},
+		{
+			name:           "percent above the min count",
+			config:         DeletionGuardConfig{MaxPercent: 50, MinCount: 10},
+			localProviders: 5,
+			deletions:      15,
+			providers:      20,
+			allowed:        false,
+		},
+		{
+			name:           "percent within limits",
+			config:         DeletionGuardConfig{MaxPercent: 50, MinCount: 10},
+			localProviders: 50,
+			deletions:      15,
+			providers:      100,
+			allowed:        true,
+		},
+		{
+			name:           "max count below the min count",
+			config:         DeletionGuardConfig{MaxCount: 2, MinCount: 10},
+			localProviders: 5,
+			deletions:      3,
+			providers:      100,
+			allowed:        false,
+		},
+	}
+	for _, test := range tests {
+		config := test.config
+		guard, err := NewDeletionGuard("test", &config)
+		if err != nil {
+			t.Fatalf("%s: new deletion guard error, err: %v", test.name, err)
+		}
+		allowed, paused := guard.Allow("remote", test.localProviders, deletionKeys(test.deletions), test.providers, time.Now())
+		if allowed != test.allowed || paused == test.allowed {
+			t.Errorf("%s: expected allowed %v, got allowed %v, paused %v", test.name, test.allowed, allowed, paused)
+		}
+	}
+}
+
+func TestDeletionGuardConfirm(t *testing.T) {
+	guard, err := NewDeletionGuard("test", &DeletionGuardConfig{MaxPercent: 50})
+	if err != nil {
+		t.Fatalf("new deletion guard error, err: %v", err)
+	}
+	now := time.Now()
+	if allowed, paused := guard.Allow("remote", 0, deletionKeys(3), 4, now); allowed || !paused {
+		t.Fatalf("expected the deletions paused, got allowed %v, paused %v", allowed, paused)
+	}
+	if err := guard.Confirm("remote"); err != nil {
+		t.Fatalf("confirm error, err: %v", err)
+	}
+
+	// more deletions than confirmed pause again
+	if allowed, paused := guard.Allow("remote", 0, deletionKeys(4), 4, now); allowed || !paused {
+		t.Fatalf("expected the grown deletions paused again, got allowed %v, paused %v", allowed, paused)
+	}
+	if paused := guard.Paused(); len(paused) != 1 || paused[0].Confirmed || paused[0].Deletions != 4 {
+		t.Fatalf("expected 4 unconfirmed deletions paused, got %+v", paused)
+	}
+	if err := guard.Confirm("remote"); err != nil {
+		t.Fatalf("confirm error, err: %v", err)
+	}
+
+	// the confirmed deletions, or fewer, proceed
+	if allowed, _ := guard.Allow("remote", 0, deletionKeys(3), 4, now); !allowed {
+		t.Fatal("expected the confirmed deletions allowed")
+	}
+	if paused := guard.Paused(); len(paused) != 0 {
+		t.Errorf("expected nothing paused, got %+v", paused)
+	}
+}
+
+func TestDeletionGuardGracePeriod(t *testing.T) {
+	guard, err := NewDeletionGuard("test", &DeletionGuardConfig{MaxPercent: 50, GracePeriod: time.Minute})
+	if err != nil {
+		t.Fatalf("new deletion guard error, err: %v", err)
+	}
+	now := time.Now()
+	if allowed, _ := guard.Allow("remote", 1, deletionKeys(3), 4, now); allowed {
+		t.Fatal("expected the deletions paused")
+	}
+	if allowed, paused := guard.Allow("remote", 1, deletionKeys(3), 4, now.Add(30*time.Second)); allowed || paused {
+		t.Fatalf("expected the deletions still paused, got allowed %v, paused %v", allowed, paused)
+	}
+	if allowed, _ := guard.Allow("remote", 1, deletionKeys(3), 4, now.Add(time.Minute)); !allowed {
+		t.Fatal("expected the deletions allowed past the grace period")
+	}
+}
+
+func TestRefreshDeletionGuardEmptyLocal(t *testing.T) {
+	urls := make([]string, 0)
+	for i := 1; i <= 5; i++ {
+		urls = append(urls, fmt.Sprintf("dubbo://2.2.2.%d:20880/com.foo.Bar%d?anyhost=true&dxinkube.cluster=a&timestamp=1", i, i))
+	}
+	local := dxtesting.NewFakeRegistry()
+	remote := dxtesting.NewFakeRegistry(urls...)
+	m := NewProviderManager("a", dxtesting.NewFakeAddrConverter(nil), local, NewRemoteRegistry("remote", remote, nil))
+	guard, err := NewDeletionGuard("a", &DeletionGuardConfig{MaxPercent: 50, MinCount: 10})
+	if err != nil {
+		t.Fatalf("new deletion guard error, err: %v", err)
+	}
+	m.SetDeletionGuard(guard)
+
+	// an empty local listing pauses even below the min count
+	m.Refresh()
+	expected := dxtesting.ProviderKeys(urls)
+	if keys := remote.Keys(); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected remote providers %v, got %v", expected, keys)
+	}
+	if paused := m.PausedDeletions(); len(paused) != 1 || paused[0].Deletions != 5 {
+		t.Errorf("expected 5 deletions paused, got %+v", paused)
+	}
+
+	if err := m.ConfirmDeletions("remote"); err != nil {
+		t.Fatalf("confirm deletions error, err: %v", err)
+	}
+	m.Refresh()
+	if keys := remote.Keys(); len(keys) != 0 {
+		t.Errorf("expected the confirmed deletions done, got %v", keys)
+	}
+}
@@ -2,78 +2,402 @@ package controller
 
 import (
 	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 
+	"github.com/whypro/dxinkube/pkg/bridge"
 	"github.com/whypro/dxinkube/pkg/converter"
 	"github.com/whypro/dxinkube/pkg/dubbo"
 	"github.com/whypro/dxinkube/pkg/registry"
 )
 
-type ProviderManager struct {
-	addrConverter         converter.AddrConverterInterface
-	localRegistry         registry.Interface
-	remoteRegistry        registry.Interface
-	localProvidersMapper  map[string]*dubbo.Provider
-	remoteProvidersMapper map[string]*dubbo.Provider
+// RemoteRegistry is a remote registry the local providers are published to,
+// only providers whose service matches Filter are desired in it. The owned
+// providers Filter no longer matches are unregistered.
+type RemoteRegistry struct {
+	Name     string
+	Registry registry.Interface
+	Filter   *dubbo.ServiceFilter
+
 	currentProviders      sets.String
-	desiredProviders      sets.String
+	remoteProvidersMapper map[string]*dubbo.Provider
+	// lastSeen is when the providers were last desired locally
+	lastSeen map[string]time.Time
+	// registered are the providers registered according to the snapshot,
+	// nil until it is loaded, and modified those changed by other writers
+	registered map[string]*SnapshotEntry
+	modified   sets.String
+	// adopted is set once the unmarked providers were adopted
+	adopted bool
+	// replaced are the providers replaced by a new registration which
+	// failed to unregister, by provider key
+	replaced map[string]*dubbo.Provider
 }
 
-func NewProviderManager(addrConverter converter.AddrConverterInterface, localRegistry registry.Interface, remoteRegistry registry.Interface) *ProviderManager {
-	return &ProviderManager{
-		addrConverter:         addrConverter,
-		localRegistry:         localRegistry,
-		remoteRegistry:        remoteRegistry,
-		localProvidersMapper:  make(map[string]*dubbo.Provider),
-		remoteProvidersMapper: make(map[string]*dubbo.Provider),
-		desiredProviders:      sets.NewString(),
+func NewRemoteRegistry(name string, r registry.Interface, filter *dubbo.ServiceFilter) *RemoteRegistry {
+	return &RemoteRegistry{
+		Name:                  name,
+		Registry:              r,
+		Filter:                filter,
 		currentProviders:      sets.NewString(),
+		remoteProvidersMapper: make(map[string]*dubbo.Provider),
+		lastSeen:              make(map[string]time.Time),
+		replaced:              make(map[string]*dubbo.Provider),
+	}
+}
+
+// ClusterOwnerParam is the provider url parameter marking which cluster
+// registered a remote provider.
+const ClusterOwnerParam = "dxinkube.cluster"
+
+// BridgeParam is the provider url parameter marking the DubboBridge a remote
+// provider is registered for, such providers are managed whatever the
+// registry filter.
+const BridgeParam = "dxinkube.bridge"
+
+// BridgePolicy selects the bridge of local providers, DubboBridge objects
+// for instance, and is told the outcome of each refresh.
+type BridgePolicy interface {
+	Bridge(podAddr string, service string) *bridge.Bridge
+	Report(reports map[string]*bridge.Report)
+}
+
+const (
+	refreshPeriod = 10 * time.Second
+	// minRefreshInterval throttles the refreshes triggered by the converter
+	minRefreshInterval = time.Second
+)
+
+type ProviderManager struct {
+	clusterID            string
+	addrConverter        converter.AddrConverterInterface
+	localRegistry        registry.Interface
+	remoteRegistries     []*RemoteRegistry
+	localProvidersMapper map[string]*dubbo.Provider
+	desiredProviders     sets.String
+
+	bridges BridgePolicy
+	// localBridges and bridgeReports are the bridges of the local providers
+	// and their outcome, by provider key and bridge key
+	localBridges  map[string]*bridge.Bridge
+	bridgeReports map[string]*bridge.Report
+
+	recorder record.EventRecorder
+	// providerRefs are the objects the events of the providers are recorded
+	// on, by provider key
+	providerRefs map[string]*v1.ObjectReference
+	// podAddrs are the pod addrs of the providers, by provider key, and
+	// notReadyAddrs the addrs withheld by the last listing
+	podAddrs      map[string]string
+	notReadyAddrs sets.String
+	// sourceKeys are the keys of the local providers, by provider key
+	sourceKeys map[string]string
+	// convertFailures are the reasons of the local providers failing to
+	// convert in the current listing and lastConvertFailures in the previous
+	// one, by source key. A failure is recorded when it first appears or its
+	// reason changes.
+	convertFailures     map[string]string
+	lastConvertFailures map[string]string
+	// localListFailing is set while listing the local registry fails, the
+	// failure is recorded when it first appears
+	localListFailing bool
+
+	unregisterGracePeriod time.Duration
+	pendingLock           sync.Mutex
+	// pending are the deletions waiting for their grace period, by remote
+	// registry
+	pending map[string][]PendingDeletion
+
+	snapshots      SnapshotStore
+	snapshotLoaded bool
+	snapshotLock   sync.Mutex
+	savedSnapshot  *Snapshot
+	// drift is the drift of the last refresh, by remote registry
+	drift map[string][]Drift
+
+	statusWriter *ServiceStatusWriter
+	// published are the remote registries each provider is published to
+	published map[string]sets.String
+
+	guard *DeletionGuard
+
+	adoptUnmarked bool
+
+	// listed is set once the local registry was listed successfully, it
+	// has its own lock so readiness checks do not wait for a refresh
+	listedLock sync.Mutex
+	listed     bool
+
+	refreshLock sync.Mutex
+	queue       chan struct{}
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// NewProviderManager creates a manager bridging one cluster. With a non-empty
+// clusterID the providers it registers are marked with the cluster id and it
+// only ever unregisters providers carrying its own mark, so several clusters
+// can share a remote registry. A provider has a single owner: the cluster
+// which registered it first keeps it, the others skip its key while it is
+// registered, and take it over once its owner unregistered it. With an empty
+// clusterID it owns every remote provider matching the registry filter.
+func NewProviderManager(clusterID string, addrConverter converter.AddrConverterInterface, localRegistry registry.Interface, remoteRegistries ...*RemoteRegistry) *ProviderManager {
+	return &ProviderManager{
+		clusterID:            clusterID,
+		addrConverter:        addrConverter,
+		localRegistry:        localRegistry,
+		remoteRegistries:     remoteRegistries,
+		localProvidersMapper: make(map[string]*dubbo.Provider),
+		desiredProviders:     sets.NewString(),
+		localBridges:         make(map[string]*bridge.Bridge),
+		bridgeReports:        make(map[string]*bridge.Report),
+		providerRefs:         make(map[string]*v1.ObjectReference),
+		podAddrs:             make(map[string]string),
+		notReadyAddrs:        sets.NewString(),
+		sourceKeys:           make(map[string]string),
+		convertFailures:      make(map[string]string),
+		lastConvertFailures:  make(map[string]string),
+		pending:              make(map[string][]PendingDeletion),
+		drift:                make(map[string][]Drift),
+		queue:                make(chan struct{}, 1),
+		now:                  time.Now,
+	}
+}
+
+func (m *ProviderManager) enqueue() {
+	select {
+	case m.queue <- struct{}{}:
+	default:
+	}
+}
+
+// SetBridgePolicy enables bridging the providers selected by policy, in
+// addition to those matching the registry filters.
+func (m *ProviderManager) SetBridgePolicy(policy BridgePolicy) {
+	m.bridges = policy
+}
+
+// SetEventRecorder enables recording events of the providers on their
+// DubboBridge or Service.
+func (m *ProviderManager) SetEventRecorder(recorder record.EventRecorder) {
+	m.recorder = recorder
+}
+
+// SetServiceStatusWriter enables writing what is published through each
+// service onto the service.
+func (m *ProviderManager) SetServiceStatusWriter(writer *ServiceStatusWriter) {
+	m.statusWriter = writer
+}
+
+// SetDeletionGuard enables pausing the deletions from a remote registry
+// when too many providers would be unregistered at once.
+func (m *ProviderManager) SetDeletionGuard(guard *DeletionGuard) {
+	m.guard = guard
+}
+
+// SetAdoptUnmarked makes the manager adopt, on the first reconcile of each
+// remote registry, the unmarked providers it desires, as registered before
+// the cluster had an id. They are registered again with the cluster mark.
+func (m *ProviderManager) SetAdoptUnmarked(adopt bool) {
+	m.adoptUnmarked = adopt
+}
+
+// PausedDeletions returns the deletions held by the deletion guard.
+func (m *ProviderManager) PausedDeletions() []PausedDeletions {
+	if m.guard == nil {
+		return []PausedDeletions{}
+	}
+	return m.guard.Paused()
+}
+
+// ConfirmDeletions lets the deletions held from a remote registry proceed.
+func (m *ProviderManager) ConfirmDeletions(registry string) error {
+	if m.guard == nil {
+		return fmt.Errorf("deletion guard is disabled")
+	}
+	if err := m.guard.Confirm(registry); err != nil {
+		return err
+	}
+	m.enqueue()
+	return nil
+}
+
+// cachesSynced tells whether the converter and the bridge policy have
+// synced, before that local providers may look gone while they are not.
+func (m *ProviderManager) cachesSynced() bool {
+	if !converter.HasSynced(m.addrConverter) {
+		return false
+	}
+	if syncer, ok := m.bridges.(converter.CacheSyncer); ok && !syncer.HasSynced() {
+		return false
 	}
+	return true
+}
+
+// HasSynced tells whether the caches have synced and the local registry
+// was listed once, remote providers are only unregistered from then on.
+func (m *ProviderManager) HasSynced() bool {
+	m.listedLock.Lock()
+	listed := m.listed
+	m.listedLock.Unlock()
+	return listed && m.cachesSynced()
 }
 
 func (m *ProviderManager) Parse(url string, isConvertAddr bool) (*dubbo.Provider, error) {
+	provider, _, err := m.parse(url, isConvertAddr)
+	return provider, err
+}
+
+// parse also returns the bridge of a local provider, it is looked up before
+// the addr is converted as it may choose the expose strategy.
+func (m *ProviderManager) parse(url string, isConvertAddr bool) (*dubbo.Provider, *bridge.Bridge, error) {
 	provider := dubbo.NewProvider()
 	err := provider.Parse(url)
 	if err != nil {
 		glog.Errorf("parse provider error, err: %v", err)
-		return nil, err
+		return nil, nil, err
 	}
 
+	var b *bridge.Bridge
 	if isConvertAddr {
-		addr, err := m.addrConverter.ConvertAddr(provider.Addr)
+		if m.bridges != nil {
+			b = m.bridges.Bridge(provider.Addr, provider.Service)
+		}
+		podAddr := provider.Addr
+		sourceKey := provider.Key()
+		addr, err := m.convertAddr(podAddr, b)
+		if err == converter.ErrNotReady {
+			glog.V(4).Infof("[%s] withhold provider of not ready addr %s", m.clusterID, provider.Addr)
+			m.notReadyAddrs.Insert(podAddr)
+			return nil, nil, err
+		}
+		ref := m.objectOf(podAddr, b)
 		if err != nil {
 			glog.Errorf("get tlb addr error, err: %v", err)
-			return nil, err
+			reason := converter.ReasonOf(err)
+			m.convertFailures[sourceKey] = reason
+			if lastReason, ok := m.lastConvertFailures[sourceKey]; !ok || lastReason != reason {
+				m.eventf(ref, v1.EventTypeWarning, EventReasonConvertFailed, "Convert addr %s of provider %s error: %v", podAddr, provider.Service, err)
+			}
+			if b != nil {
+				m.bridgeReport(b.Key).AddError(fmt.Errorf("convert addr of %s error, %v", provider.Service, err))
+			}
+			return nil, nil, err
 		}
 		provider.Addr = addr
+		m.providerRefs[provider.Key()] = ref
+		m.podAddrs[provider.Key()] = podAddr
+		m.sourceKeys[provider.Key()] = sourceKey
+	}
+
+	return provider, b, nil
+}
+
+func (m *ProviderManager) convertAddr(podAddr string, b *bridge.Bridge) (string, error) {
+	if b == nil || b.Expose == "" {
+		return m.addrConverter.ConvertAddr(podAddr)
+	}
+	exposeConverter, ok := m.addrConverter.(converter.ExposeConverter)
+	if !ok {
+		return "", fmt.Errorf("expose %q requires the service expose converter", b.Expose)
 	}
+	return exposeConverter.ConvertAddrAs(podAddr, b.Expose)
+}
 
-	return provider, nil
+func (m *ProviderManager) bridgeReport(key string) *bridge.Report {
+	report, ok := m.bridgeReports[key]
+	if !ok {
+		report = bridge.NewReport()
+		m.bridgeReports[key] = report
+	}
+	return report
 }
 
-func (m *ProviderManager) register(key string) error {
+func (m *ProviderManager) register(remote *RemoteRegistry, key string) error {
 	provider, ok := m.localProvidersMapper[key]
 	if !ok {
 		glog.Errorf("provider is not exists, %s", key)
 		return fmt.Errorf("provider is not exists")
 	}
 	provider.SetTimestamp()
-	glog.V(4).Infof("register provider %s", key)
-	return m.remoteRegistry.Register(provider)
+	if b, ok := m.localBridges[key]; ok {
+		for k, v := range b.Parameters {
+			provider.SetParam(k, v)
+		}
+		provider.SetParam(BridgeParam, b.Key)
+	}
+	if m.clusterID != "" {
+		provider.SetParam(ClusterOwnerParam, m.clusterID)
+	}
+	glog.V(4).Infof("[%s] register provider %s to %s", m.clusterID, key, remote.Name)
+	if err := remote.Registry.Register(provider); err != nil {
+		m.eventf(m.providerRefs[key], v1.EventTypeWarning, EventReasonRegistryError, "Register provider %s to %s error: %v", key, remote.Name, err)
+		return err
+	}
+	m.eventf(m.providerRefs[key], v1.EventTypeNormal, EventReasonRegistered, "Registered provider %s to %s", key, remote.Name)
+	if remote.registered != nil {
+		remote.registered[key] = m.snapshotEntry(remote, key, provider)
+	}
+	return nil
 }
 
-func (m *ProviderManager) unRegister(key string) error {
-	provider, ok := m.remoteProvidersMapper[key]
+func (m *ProviderManager) unRegister(remote *RemoteRegistry, key string) error {
+	provider, ok := remote.remoteProvidersMapper[key]
 	if !ok {
 		glog.Errorf("provider is not exists, %s", key)
 		return fmt.Errorf("provider is not exists")
 	}
-	glog.V(4).Infof("unregister provider %s", key)
-	return m.remoteRegistry.UnRegister(provider)
+	glog.V(4).Infof("[%s] unregister provider %s from %s", m.clusterID, key, remote.Name)
+	if err := remote.Registry.UnRegister(provider); err != nil {
+		m.eventf(m.providerRefs[key], v1.EventTypeWarning, EventReasonRegistryError, "Unregister provider %s from %s error: %v", key, remote.Name, err)
+		return err
+	}
+	m.eventf(m.providerRefs[key], v1.EventTypeNormal, EventReasonUnregistered, "Unregistered provider %s from %s", key, remote.Name)
+	delete(remote.registered, key)
+	return nil
+}
+
+// replace registers the local provider of key and then unregisters the
+// remote one it replaces, so consumers see a provider all along. The remote
+// one is unregistered again on the next reconcile when it fails.
+func (m *ProviderManager) replace(remote *RemoteRegistry, key string) error {
+	old, ok := remote.remoteProvidersMapper[key]
+	if !ok {
+		glog.Errorf("provider is not exists, %s", key)
+		return fmt.Errorf("provider is not exists")
+	}
+	if err := m.register(remote, key); err != nil {
+		return err
+	}
+	if old.String() == m.localProvidersMapper[key].String() {
+		return nil
+	}
+	glog.V(4).Infof("[%s] unregister replaced provider %s from %s", m.clusterID, old, remote.Name)
+	if err := remote.Registry.UnRegister(old); err != nil {
+		m.eventf(m.providerRefs[key], v1.EventTypeWarning, EventReasonRegistryError, "Unregister replaced provider %s from %s error: %v", key, remote.Name, err)
+		remote.replaced[key] = old
+		return err
+	}
+	return nil
+}
+
+// unRegisterReplaced unregisters again the replaced providers which failed
+// to, once.
+func (m *ProviderManager) unRegisterReplaced(remote *RemoteRegistry) {
+	for key, provider := range remote.replaced {
+		if err := remote.Registry.UnRegister(provider); err != nil {
+			glog.Warningf("[%s] unregister replaced provider %s from %s error, %v", m.clusterID, provider, remote.Name, err)
+		}
+		delete(remote.replaced, key)
+	}
 }
 
 func (m *ProviderManager) listProviders(r registry.Interface, isConvertAddr bool) (sets.String, map[string]*dubbo.Provider, error) {
@@ -86,49 +410,328 @@ func (m *ProviderManager) listProviders(r registry.Interface, isConvertAddr bool
 
 	set := sets.NewString()
 	mapper := make(map[string]*dubbo.Provider)
+	if isConvertAddr {
+		m.localBridges = make(map[string]*bridge.Bridge)
+		m.notReadyAddrs = sets.NewString()
+		m.lastConvertFailures = m.convertFailures
+		m.convertFailures = make(map[string]string)
+	}
 	for _, url := range urls {
-		provider, err := m.Parse(url, isConvertAddr)
+		provider, b, err := m.parse(url, isConvertAddr)
+		if err == converter.ErrNotReady {
+			continue
+		}
 		if err != nil {
 			glog.Warningf("parse provider url error, %v", err)
 			continue
 		}
+		// a provider replaced and not unregistered yet is listed with the
+		// replacement, the newer one is kept
+		if listed, ok := mapper[provider.Key()]; ok && newerThan(listed, provider) {
+			continue
+		}
 		set.Insert(provider.Key())
 		mapper[provider.Key()] = provider
+		if b != nil {
+			m.localBridges[provider.Key()] = b
+		}
 	}
 	return set, mapper, nil
 }
 
+// newerThan tells whether provider was registered after other, by their
+// timestamp parameters.
+func newerThan(provider *dubbo.Provider, other *dubbo.Provider) bool {
+	timestamp, _ := strconv.ParseInt(provider.Param("timestamp"), 10, 64)
+	otherTimestamp, _ := strconv.ParseInt(other.Param("timestamp"), 10, 64)
+	return timestamp > otherTimestamp
+}
+
+func filterProviders(set sets.String, mapper map[string]*dubbo.Provider, filter *dubbo.ServiceFilter) sets.String {
+	filtered := sets.NewString()
+	for key := range set {
+		if filter.Match(mapper[key].Service) {
+			filtered.Insert(key)
+		}
+	}
+	return filtered
+}
+
+// managedProviders returns the remote providers matching the registry filter
+// or registered for a bridge. Without a cluster mark nor a snapshot they are
+// the only providers known to be owned.
+func managedProviders(set sets.String, mapper map[string]*dubbo.Provider, filter *dubbo.ServiceFilter) sets.String {
+	managed := sets.NewString()
+	for key := range set {
+		if filter.Match(mapper[key].Service) || mapper[key].Param(BridgeParam) != "" {
+			managed.Insert(key)
+		}
+	}
+	return managed
+}
+
+// bridgedProviders returns the local providers whose bridge targets remote.
+func (m *ProviderManager) bridgedProviders(remote *RemoteRegistry) sets.String {
+	bridged := sets.NewString()
+	for key, b := range m.localBridges {
+		if m.desiredProviders.Has(key) && b.Targets(remote.Name) {
+			bridged.Insert(key)
+		}
+	}
+	return bridged
+}
+
+// isStale tells whether a remote provider was registered for another bridge,
+// or with other parameters than its bridge sets.
+func (m *ProviderManager) isStale(key string, remoteProvider *dubbo.Provider) bool {
+	b, ok := m.localBridges[key]
+	if !ok {
+		return remoteProvider.Param(BridgeParam) != ""
+	}
+	if remoteProvider.Param(BridgeParam) != b.Key {
+		return true
+	}
+	for k, v := range b.Parameters {
+		if remoteProvider.Param(k) != v {
+			return true
+		}
+	}
+	return false
+}
+
+// ownedProviders returns the remote providers owned, those marked by the
+// cluster whatever the registry filter, so narrowing the filter unregisters
+// them.
+func (m *ProviderManager) ownedProviders(remote *RemoteRegistry, set sets.String, mapper map[string]*dubbo.Provider) sets.String {
+	if m.clusterID == "" {
+		return managedProviders(set, mapper, remote.Filter)
+	}
+	owned := sets.NewString()
+	for key := range set {
+		if mapper[key].Param(ClusterOwnerParam) == m.clusterID {
+			owned.Insert(key)
+		}
+	}
+	return owned
+}
+
 func (m *ProviderManager) Refresh() {
+	m.refreshLock.Lock()
+	defer m.refreshLock.Unlock()
+
+	m.bridgeReports = make(map[string]*bridge.Report)
+	// the objects and pod addrs of providers gone locally are kept until
+	// they are unregistered
+	providerRefs := make(map[string]*v1.ObjectReference)
+	podAddrs := make(map[string]string)
+	sourceKeys := make(map[string]string)
+	previousProviders := sets.NewString(m.desiredProviders.UnsortedList()...)
+	for _, remote := range m.remoteRegistries {
+		previousProviders = previousProviders.Union(remote.currentProviders)
+	}
+	for key := range previousProviders {
+		if ref, ok := m.providerRefs[key]; ok {
+			providerRefs[key] = ref
+		}
+		if podAddr, ok := m.podAddrs[key]; ok {
+			podAddrs[key] = podAddr
+		}
+		if sourceKey, ok := m.sourceKeys[key]; ok {
+			sourceKeys[key] = sourceKey
+		}
+	}
+	m.providerRefs = providerRefs
+	m.podAddrs = podAddrs
+	m.sourceKeys = sourceKeys
+
+	// the remote providers registered before a restart are known before
+	// anything is reconciled
+	if m.snapshots != nil && !m.snapshotLoaded {
+		if err := m.loadSnapshot(); err != nil {
+			glog.Errorf("[%s] load snapshot error, %v", m.clusterID, err)
+			return
+		}
+	}
+
 	var err error
 	m.desiredProviders, m.localProvidersMapper, err = m.listProviders(m.localRegistry, true)
 	if err != nil {
-		glog.Errorf("list local registry providers error, %v", err)
+		glog.Errorf("[%s] list local registry providers error, %v", m.clusterID, err)
+		if !m.localListFailing {
+			m.localListFailing = true
+			m.localRegistryErrorEvents(err)
+		}
 		return
 	}
-	m.currentProviders, m.remoteProvidersMapper, err = m.listProviders(m.remoteRegistry, false)
+	m.localListFailing = false
+	m.listedLock.Lock()
+	m.listed = true
+	m.listedLock.Unlock()
+
+	// remote registries are reconciled independently, one failing does not
+	// block the others
+	m.published = make(map[string]sets.String)
+	synced := true
+	for _, remote := range m.remoteRegistries {
+		if err := m.reconcile(remote); err != nil {
+			glog.Errorf("[%s] reconcile remote registry %s error, %v", m.clusterID, remote.Name, err)
+			synced = false
+		}
+	}
+	if m.bridges != nil {
+		m.bridges.Report(m.bridgeReports)
+	}
+	if m.snapshots != nil {
+		m.saveSnapshot(m.now())
+	}
+	if m.statusWriter != nil && synced {
+		m.statusWriter.Write(m.serviceStatuses(m.now()), m.now())
+	}
+	return
+}
+
+// serviceStatuses groups the published providers by the service they are
+// exposed through.
+func (m *ProviderManager) serviceStatuses(now time.Time) map[string]*ServiceStatus {
+	statuses := make(map[string]*ServiceStatus)
+	for key, registries := range m.published {
+		ref, ok := m.providerRefs[key]
+		if !ok || ref == nil || ref.Kind != "Service" {
+			continue
+		}
+		serviceKey := ref.Namespace + "/" + ref.Name
+		status, ok := statuses[serviceKey]
+		if !ok {
+			status = &ServiceStatus{
+				Interfaces:   sets.NewString(),
+				Registries:   sets.NewString(),
+				LastSyncTime: now,
+			}
+			statuses[serviceKey] = status
+		}
+		status.Interfaces.Insert(m.localProvidersMapper[key].Service)
+		status.Registries = status.Registries.Union(registries)
+	}
+	return statuses
+}
+
+func (m *ProviderManager) reconcile(remote *RemoteRegistry) error {
+	m.unRegisterReplaced(remote)
+	currentProviders, remoteProvidersMapper, err := m.listProviders(remote.Registry, false)
 	if err != nil {
-		glog.Errorf("list remote registry providers error, %v", err)
-		return
+		return err
+	}
+	remote.currentProviders = m.ownedProviders(remote, currentProviders, remoteProvidersMapper)
+	if m.snapshots != nil {
+		remote.currentProviders = m.ownedBySnapshot(remote, remote.currentProviders, remoteProvidersMapper)
 	}
+	remote.remoteProvidersMapper = remoteProvidersMapper
 
-	created := m.desiredProviders.Difference(m.currentProviders)
-	deleted := m.currentProviders.Difference(m.desiredProviders)
+	bridgedProviders := m.bridgedProviders(remote)
+	desiredProviders := filterProviders(m.desiredProviders, m.localProvidersMapper, remote.Filter).Union(bridgedProviders)
+	// providers registered by another cluster are not created again
+	created := desiredProviders.Difference(currentProviders)
+	deleted := remote.currentProviders.Difference(desiredProviders)
+	// nothing is unregistered before the caches sync
+	synced := m.cachesSynced()
+	if !synced && deleted.Len() > 0 {
+		glog.Warningf("[%s] caches are not synced, hold %d deletions from %s", m.clusterID, deleted.Len(), remote.Name)
+		deleted = sets.NewString()
+	}
+	deleted = m.holdDisappeared(remote, desiredProviders, deleted, m.now())
+	if m.guard != nil {
+		allowed, paused := m.guard.Allow(remote.Name, m.desiredProviders.Len(), deleted, remote.currentProviders.Len(), m.now())
+		if paused {
+			m.deletionsPausedEvents(remote, deleted)
+		}
+		if !allowed {
+			glog.Warningf("[%s] deletion guard holds %d deletions from %s", m.clusterID, deleted.Len(), remote.Name)
+			deleted = sets.NewString()
+		}
+	}
+	// providers registered again replace the remote ones
+	replaced := sets.NewString()
+	// unmarked providers are adopted once, later ones belong to writers
+	// unaware of the marks
+	if m.adoptUnmarked && m.clusterID != "" && !remote.adopted && synced {
+		for providerKey := range desiredProviders.Intersection(currentProviders).Difference(remote.currentProviders) {
+			if remoteProvidersMapper[providerKey].Param(ClusterOwnerParam) != "" {
+				continue
+			}
+			glog.Infof("[%s] adopt unmarked provider %s of %s", m.clusterID, providerKey, remote.Name)
+			replaced.Insert(providerKey)
+		}
+		remote.adopted = true
+	}
+	// providers whose bridge changed are registered again
+	for providerKey := range desiredProviders.Intersection(remote.currentProviders) {
+		// as well as providers modified by other writers
+		if synced && (m.isStale(providerKey, remoteProvidersMapper[providerKey]) || remote.modified.Has(providerKey)) {
+			replaced.Insert(providerKey)
+		}
+	}
 
+	published := sets.NewString(desiredProviders.UnsortedList()...)
 	for providerKey := range created {
-		err := m.register(providerKey)
+		err := m.register(remote, providerKey)
 		if err != nil {
-			glog.Warningf("register provider error, %v", err)
+			glog.Warningf("[%s] register provider to %s error, %v", m.clusterID, remote.Name, err)
+			published.Delete(providerKey)
+			if bridgedProviders.Has(providerKey) {
+				m.bridgeReport(m.localBridges[providerKey].Key).AddError(fmt.Errorf("register %s to %s error, %v", providerKey, remote.Name, err))
+				bridgedProviders.Delete(providerKey)
+			}
 			continue
 		}
 	}
+	for providerKey := range replaced {
+		if err := m.replace(remote, providerKey); err != nil {
+			glog.Warningf("[%s] replace provider in %s error, %v", m.clusterID, remote.Name, err)
+			if bridgedProviders.Has(providerKey) {
+				m.bridgeReport(m.localBridges[providerKey].Key).AddError(fmt.Errorf("replace %s in %s error, %v", providerKey, remote.Name, err))
+			}
+		}
+	}
+	for providerKey := range bridgedProviders {
+		m.bridgeReport(m.localBridges[providerKey].Key).Registries[remote.Name]++
+	}
+	for providerKey := range published {
+		if m.published[providerKey] == nil {
+			m.published[providerKey] = sets.NewString()
+		}
+		m.published[providerKey].Insert(remote.Name)
+	}
 
 	for providerKey := range deleted {
-		m.unRegister(providerKey)
+		m.unRegister(remote, providerKey)
 	}
-	return
+	return nil
 }
 
 func (m *ProviderManager) Run(stopCh <-chan struct{}) {
+	// withdrawn addrs are unregistered without waiting for the next refresh
+	if notifier, ok := m.addrConverter.(converter.ChangeNotifier); ok {
+		notifier.SetChangeHandler(m.enqueue)
+	}
 	go m.addrConverter.Run(stopCh)
-	go wait.Until(m.Refresh, 10*time.Second, stopCh)
+	// refreshing before the caches sync would unregister the providers of
+	// the addrs not listed yet
+	glog.Infof("[%s] wait for caches to sync", m.clusterID)
+	if !cache.WaitForCacheSync(stopCh, m.cachesSynced) {
+		glog.Errorf("[%s] wait for caches to sync error", m.clusterID)
+		return
+	}
+	glog.Infof("[%s] caches synced", m.clusterID)
+	go wait.Until(m.Refresh, refreshPeriod, stopCh)
+	go func() {
+		for {
+			select {
+			case <-m.queue:
+				m.Refresh()
+			case <-stopCh:
+				return
+			}
+			time.Sleep(minRefreshInterval)
+		}
+	}()
 }
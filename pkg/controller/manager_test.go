@@ -0,0 +1,299 @@
+package controller
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/whypro/dxinkube/pkg/dubbo"
+	dxtesting "github.com/whypro/dxinkube/pkg/testing"
+)
+
+var timestampParam = regexp.MustCompile(`&?timestamp=[0-9]+`)
+
+func TestRefresh(t *testing.T) {
+	tests := []struct {
+		name string
+		// local and remote are the provider urls of the registries, malformed
+		// the local nodes stored as they are
+		local     []string
+		malformed []string
+		remote    []string
+		addrs     map[string]string
+		expected  []string
+	}{
+		{
+			name:     "create",
+			local:    []string{"dubbo://10.0.0.1:20880/com.foo.Bar?anyhost=true&timestamp=1"},
+			addrs:    map[string]string{"10.0.0.1:20880": "2.2.2.1:20880"},
+			expected: []string{"dubbo://2.2.2.1:20880/com.foo.Bar"},
+		},
+		{
+			name: "delete",
+			local: []string{
+				"dubbo://10.0.0.1:20880/com.foo.Bar?anyhost=true&timestamp=1",
+			},
+			remote: []string{
+				"dubbo://2.2.2.1:20880/com.foo.Bar?anyhost=true&timestamp=1",
+				"dubbo://2.2.2.2:20880/com.foo.Gone?anyhost=true&timestamp=1",
+			},
+			addrs:    map[string]string{"10.0.0.1:20880": "2.2.2.1:20880"},
+			expected: []string{"dubbo://2.2.2.1:20880/com.foo.Bar"},
+		},
+		{
+			name:      "parse failure",
+			local:     []string{"dubbo://10.0.0.1:20880/com.foo.Bar?anyhost=true&timestamp=1"},
+			malformed: []string{"dubbo%3A%2F%2F10.0.0.2%3A20880%2Fcom.foo.Bad%3Fanyhost%3D%zz"},
+			addrs: map[string]string{
+				"10.0.0.1:20880": "2.2.2.1:20880",
+				"10.0.0.2:20880": "2.2.2.2:20880",
+			},
+			expected: []string{"dubbo://2.2.2.1:20880/com.foo.Bar"},
+		},
+		{
+			name: "conversion failure",
+			local: []string{
+				"dubbo://10.0.0.1:20880/com.foo.Bar?anyhost=true&timestamp=1",
+				"dubbo://10.0.0.2:20880/com.foo.Baz?anyhost=true&timestamp=1",
+			},
+			remote: []string{
+				"dubbo://2.2.2.2:20880/com.foo.Baz?anyhost=true&timestamp=1",
+			},
+			addrs:    map[string]string{"10.0.0.1:20880": "2.2.2.1:20880"},
+			expected: []string{"dubbo://2.2.2.1:20880/com.foo.Bar"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			local := dxtesting.NewFakeRegistry(test.local...)
+			local.AddNodes(test.malformed...)
+			remote := dxtesting.NewFakeRegistry(test.remote...)
+			addrConverter := dxtesting.NewFakeAddrConverter(test.addrs)
+			m := NewProviderManager("", addrConverter, local, NewRemoteRegistry("remote", remote, nil))
+
+			m.Refresh()
+			if keys := remote.Keys(); !reflect.DeepEqual(keys, test.expected) {
+				t.Errorf("expected remote providers %v, got %v", test.expected, keys)
+			}
+			// a second refresh finds nothing to change
+			remote.ClearActions()
+			m.Refresh()
+			if actions := remote.Actions(); len(actions) != 1 {
+				t.Errorf("expected only the list action, got %+v", actions)
+			}
+		})
+	}
+}
+
+func TestRefreshRemoteErrors(t *testing.T) {
+	local := dxtesting.NewFakeRegistry("dubbo://10.0.0.1:20880/com.foo.Bar?anyhost=true&timestamp=1")
+	remote := dxtesting.NewFakeRegistry("dubbo://2.2.2.2:20880/com.foo.Gone?anyhost=true&timestamp=1")
+	addrConverter := dxtesting.NewFakeAddrConverter(map[string]string{"10.0.0.1:20880": "2.2.2.1:20880"})
+	m := NewProviderManager("", addrConverter, local, NewRemoteRegistry("remote", remote, nil))
+
+	remote.SetError(dxtesting.VerbList, errors.New("connection lost"))
+	m.Refresh()
+	expected := []string{"dubbo://2.2.2.2:20880/com.foo.Gone"}
+	if keys := remote.Keys(); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected remote providers %v, got %v", expected, keys)
+	}
+
+	remote.SetError(dxtesting.VerbList, nil)
+	m.Refresh()
+	expected = []string{"dubbo://2.2.2.1:20880/com.foo.Bar"}
+	if keys := remote.Keys(); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected remote providers %v, got %v", expected, keys)
+	}
+}
+
+func TestRefreshAdoptUnmarked(t *testing.T) {
+	local := dxtesting.NewFakeRegistry(
+		"dubbo://10.0.0.1:20880/com.foo.Bar?anyhost=true&timestamp=1",
+		"dubbo://10.0.0.2:20880/com.foo.Baz?anyhost=true&timestamp=1",
+	)
+	remote := dxtesting.NewFakeRegistry(
+		"dubbo://2.2.2.1:20880/com.foo.Bar?anyhost=true&timestamp=1",
+		"dubbo://2.2.2.3:20880/com.foo.Other?anyhost=true&timestamp=1",
+		"dubbo://2.2.2.4:20880/com.foo.Owned?anyhost=true&dxinkube.cluster=b&timestamp=1",
+	)
+	addrConverter := dxtesting.NewFakeAddrConverter(map[string]string{
+		"10.0.0.1:20880": "2.2.2.1:20880",
+		"10.0.0.2:20880": "2.2.2.2:20880",
+	})
+	m := NewProviderManager("a", addrConverter, local, NewRemoteRegistry("remote", remote, nil))
+	m.SetAdoptUnmarked(true)
+
+	m.Refresh()
+	// the adopted provider is registered again before the unmarked one is
+	// unregistered
+	actions := remote.Actions()
+	verbs := make([]string, 0)
+	for _, action := range actions {
+		if strings.Contains(action.URL, "com.foo.Bar") {
+			verbs = append(verbs, action.Verb)
+		}
+	}
+	if expected := []string{dxtesting.VerbRegister, dxtesting.VerbUnRegister}; !reflect.DeepEqual(verbs, expected) {
+		t.Errorf("expected the actions %v on the adopted provider, got %+v", expected, actions)
+	}
+	expected := []string{
+		"dubbo://2.2.2.1:20880/com.foo.Bar?anyhost=true&dxinkube.cluster=a",
+		"dubbo://2.2.2.2:20880/com.foo.Baz?anyhost=true&dxinkube.cluster=a",
+		"dubbo://2.2.2.3:20880/com.foo.Other?anyhost=true",
+		"dubbo://2.2.2.4:20880/com.foo.Owned?anyhost=true&dxinkube.cluster=b",
+	}
+	if providers := withoutTimestamps(remote.Providers()); !reflect.DeepEqual(providers, expected) {
+		t.Errorf("expected remote providers %v, got %v", expected, providers)
+	}
+
+	// providers unmarked later are not adopted
+	remote.AddNodes("dubbo%3A%2F%2F2.2.2.5%3A20880%2Fcom.foo.Late%3Fanyhost%3Dtrue")
+	addrConverter.Set("10.0.0.5:20880", "2.2.2.5:20880")
+	local.AddNodes("dubbo%3A%2F%2F10.0.0.5%3A20880%2Fcom.foo.Late%3Fanyhost%3Dtrue")
+	remote.ClearActions()
+	m.Refresh()
+	if actions := remote.Actions(); len(actions) != 1 {
+		t.Errorf("expected only the list action, got %+v", actions)
+	}
+}
+
+func TestRefreshNarrowedFilter(t *testing.T) {
+	local := dxtesting.NewFakeRegistry(
+		"dubbo://10.0.0.1:20880/com.foo.Bar?anyhost=true&timestamp=1",
+		"dubbo://10.0.0.2:20880/com.bar.Baz?anyhost=true&timestamp=1",
+	)
+	remote := dxtesting.NewFakeRegistry(
+		"dubbo://2.2.2.1:20880/com.foo.Bar?anyhost=true&dxinkube.cluster=a&timestamp=1",
+		"dubbo://2.2.2.3:20880/com.foo.Other?anyhost=true&timestamp=1",
+		"dubbo://2.2.2.4:20880/com.foo.Owned?anyhost=true&dxinkube.cluster=b&timestamp=1",
+	)
+	addrConverter := dxtesting.NewFakeAddrConverter(map[string]string{
+		"10.0.0.1:20880": "2.2.2.1:20880",
+		"10.0.0.2:20880": "2.2.2.2:20880",
+	})
+	filter := &dubbo.ServiceFilter{Exclude: []string{"com.foo.*"}}
+	m := NewProviderManager("a", addrConverter, local, NewRemoteRegistry("remote", remote, filter))
+
+	// the provider owned is unregistered once the filter excludes it, the
+	// others are left alone
+	m.Refresh()
+	expected := []string{
+		"dubbo://2.2.2.2:20880/com.bar.Baz",
+		"dubbo://2.2.2.3:20880/com.foo.Other",
+		"dubbo://2.2.2.4:20880/com.foo.Owned",
+	}
+	if keys := remote.Keys(); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected remote providers %v, got %v", expected, keys)
+	}
+}
+
+func TestRefreshReplaceUnregisterError(t *testing.T) {
+	local := dxtesting.NewFakeRegistry("dubbo://10.0.0.1:20880/com.foo.Bar?anyhost=true&timestamp=1")
+	remote := dxtesting.NewFakeRegistry("dubbo://2.2.2.1:20880/com.foo.Bar?anyhost=true&timestamp=1")
+	addrConverter := dxtesting.NewFakeAddrConverter(map[string]string{"10.0.0.1:20880": "2.2.2.1:20880"})
+	m := NewProviderManager("a", addrConverter, local, NewRemoteRegistry("remote", remote, nil))
+	m.SetAdoptUnmarked(true)
+
+	// the replacement is registered even though the unmarked provider stays
+	remote.SetError(dxtesting.VerbUnRegister, errors.New("connection lost"))
+	m.Refresh()
+	expected := []string{
+		"dubbo://2.2.2.1:20880/com.foo.Bar?anyhost=true&dxinkube.cluster=a",
+		"dubbo://2.2.2.1:20880/com.foo.Bar?anyhost=true",
+	}
+	if providers := withoutTimestamps(remote.Providers()); !reflect.DeepEqual(providers, expected) {
+		t.Errorf("expected remote providers %v, got %v", expected, providers)
+	}
+
+	// it is unregistered on the next refresh, the replacement is kept
+	remote.SetError(dxtesting.VerbUnRegister, nil)
+	remote.ClearActions()
+	m.Refresh()
+	expected = []string{"dubbo://2.2.2.1:20880/com.foo.Bar?anyhost=true&dxinkube.cluster=a"}
+	if providers := withoutTimestamps(remote.Providers()); !reflect.DeepEqual(providers, expected) {
+		t.Errorf("expected remote providers %v, got %v", expected, providers)
+	}
+	if registered := remote.ActionsFor(dxtesting.VerbRegister); len(registered) != 0 {
+		t.Errorf("expected nothing registered, got %v", registered)
+	}
+}
+
+// unsyncedAddrConverter is a fake converter whose caches sync when told.
+type unsyncedAddrConverter struct {
+	*dxtesting.FakeAddrConverter
+	synced bool
+}
+
+func (c *unsyncedAddrConverter) HasSynced() bool {
+	return c.synced
+}
+
+func TestRefreshHoldsDeletionsUntilSynced(t *testing.T) {
+	local := dxtesting.NewFakeRegistry()
+	remote := dxtesting.NewFakeRegistry("dubbo://2.2.2.2:20880/com.foo.Gone?anyhost=true&timestamp=1")
+	addrConverter := &unsyncedAddrConverter{FakeAddrConverter: dxtesting.NewFakeAddrConverter(nil)}
+	m := NewProviderManager("", addrConverter, local, NewRemoteRegistry("remote", remote, nil))
+	expected := []string{"dubbo://2.2.2.2:20880/com.foo.Gone"}
+
+	// nothing is unregistered before the local registry is listed once
+	local.SetError(dxtesting.VerbList, errors.New("connection lost"))
+	addrConverter.synced = true
+	m.Refresh()
+	if m.HasSynced() {
+		t.Error("expected not synced before the local registry is listed")
+	}
+	if keys := remote.Keys(); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected remote providers %v, got %v", expected, keys)
+	}
+
+	// nor before the caches sync
+	local.SetError(dxtesting.VerbList, nil)
+	addrConverter.synced = false
+	m.Refresh()
+	if m.HasSynced() {
+		t.Error("expected not synced before the caches sync")
+	}
+	if keys := remote.Keys(); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected remote providers %v, got %v", expected, keys)
+	}
+
+	addrConverter.synced = true
+	m.Refresh()
+	if !m.HasSynced() {
+		t.Error("expected synced")
+	}
+	if keys := remote.Keys(); len(keys) != 0 {
+		t.Errorf("expected the deletion done, got %v", keys)
+	}
+}
+
+func TestHasSyncedDuringRefresh(t *testing.T) {
+	m := NewProviderManager("", dxtesting.NewFakeAddrConverter(nil), dxtesting.NewFakeRegistry())
+	m.Refresh()
+
+	// a slow refresh holds the refresh lock
+	m.refreshLock.Lock()
+	defer m.refreshLock.Unlock()
+	synced := make(chan bool)
+	go func() { synced <- m.HasSynced() }()
+	select {
+	case ok := <-synced:
+		if !ok {
+			t.Error("expected synced")
+		}
+	case <-time.After(time.Second):
+		t.Error("expected HasSynced not to wait for the refresh")
+	}
+}
+
+func withoutTimestamps(urls []string) []string {
+	stripped := make([]string, 0, len(urls))
+	for _, url := range urls {
+		stripped = append(stripped, timestampParam.ReplaceAllString(url, ""))
+	}
+	return stripped
+}
@@ -0,0 +1,335 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/whypro/dxinkube/pkg/dubbo"
+)
+
+const (
+	DriftMissing  = "Missing"
+	DriftModified = "Modified"
+)
+
+// SnapshotEntry is a provider registered to a remote registry.
+type SnapshotEntry struct {
+	Registry string `json:"registry"`
+	// SourceKey is the key of the local provider, Key of the remote one
+	SourceKey string `json:"source_key"`
+	Key       string `json:"key"`
+	URL       string `json:"url"`
+}
+
+// Snapshot lists the remote providers a cluster owns.
+type Snapshot struct {
+	ClusterID string          `json:"cluster_id"`
+	Time      time.Time       `json:"time"`
+	Entries   []SnapshotEntry `json:"entries"`
+}
+
+// Drift is a change of an owned remote provider by another writer.
+type Drift struct {
+	Registry  string `json:"registry"`
+	Key       string `json:"key"`
+	Reason    string `json:"reason"`
+	URL       string `json:"url"`
+	RemoteURL string `json:"remote_url,omitempty"`
+}
+
+// SnapshotParseError is returned by the stores when the saved snapshot is
+// not a valid snapshot.
+type SnapshotParseError struct {
+	Err error
+}
+
+func (e *SnapshotParseError) Error() string {
+	return fmt.Sprintf("parse snapshot error, %v", e.Err)
+}
+
+// SnapshotStore persists the snapshot of a cluster.
+type SnapshotStore interface {
+	// Load returns the snapshot saved last, nil when none was saved, and a
+	// SnapshotParseError when it can not be parsed
+	Load() (*Snapshot, error)
+	Save(snapshot *Snapshot) error
+}
+
+type fileSnapshotStore struct {
+	path string
+}
+
+// NewFileSnapshotStore returns a store keeping the snapshot in a json file.
+func NewFileSnapshotStore(path string) SnapshotStore {
+	return &fileSnapshotStore{path: path}
+}
+
+func (s *fileSnapshotStore) Load() (*Snapshot, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, &SnapshotParseError{Err: err}
+	}
+	return snapshot, nil
+}
+
+// Save writes a temporary file renamed over the snapshot, a crash never
+// leaves a partial snapshot.
+func (s *fileSnapshotStore) Save(snapshot *Snapshot) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+type configMapSnapshotStore struct {
+	kubeClient kubernetes.Interface
+	namespace  string
+	name       string
+	key        string
+}
+
+// NewConfigMapSnapshotStore returns a store keeping the snapshot under key
+// of a ConfigMap, several clusters may share the ConfigMap with their own key.
+func NewConfigMapSnapshotStore(kubeClient kubernetes.Interface, namespace string, name string, key string) SnapshotStore {
+	return &configMapSnapshotStore{
+		kubeClient: kubeClient,
+		namespace:  namespace,
+		name:       name,
+		key:        key,
+	}
+}
+
+func (s *configMapSnapshotStore) Load() (*Snapshot, error) {
+	cm, err := s.kubeClient.CoreV1().ConfigMaps(s.namespace).Get(s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, ok := cm.Data[s.key]
+	if !ok {
+		return nil, nil
+	}
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal([]byte(data), snapshot); err != nil {
+		return nil, &SnapshotParseError{Err: err}
+	}
+	return snapshot, nil
+}
+
+// Save retries on conflicts, the clusters sharing the ConfigMap update it
+// concurrently.
+func (s *configMapSnapshotStore) Save(snapshot *Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := s.kubeClient.CoreV1().ConfigMaps(s.namespace).Get(s.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = s.kubeClient.CoreV1().ConfigMaps(s.namespace).Create(&v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: s.namespace, Name: s.name},
+				Data:       map[string]string{s.key: string(data)},
+			})
+			// another cluster created it meanwhile, it is updated then
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(v1.Resource("configmaps"), s.name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		updated := cm.DeepCopy()
+		if updated.Data == nil {
+			updated.Data = make(map[string]string)
+		}
+		updated.Data[s.key] = string(data)
+		_, err = s.kubeClient.CoreV1().ConfigMaps(s.namespace).Update(updated)
+		return err
+	})
+}
+
+// SetSnapshotStore enables persisting the remote providers registered, so
+// that after a restart only those are reconciled and their changes by other
+// writers are detected.
+func (m *ProviderManager) SetSnapshotStore(store SnapshotStore) {
+	m.snapshots = store
+}
+
+// loadSnapshot restores the providers registered from the saved snapshot.
+// Without a snapshot the remote registries adopt the providers owned at
+// their first reconcile, and so they do when the snapshot can not be parsed,
+// it is saved over then.
+func (m *ProviderManager) loadSnapshot() error {
+	snapshot, err := m.snapshots.Load()
+	if _, ok := err.(*SnapshotParseError); ok {
+		glog.Errorf("[%s] load snapshot error, adopt the providers owned, %v", m.clusterID, err)
+		m.snapshotLoaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.snapshotLoaded = true
+	if snapshot == nil {
+		glog.Infof("[%s] no snapshot, adopt the providers owned", m.clusterID)
+		return nil
+	}
+	for _, remote := range m.remoteRegistries {
+		remote.registered = make(map[string]*SnapshotEntry)
+	}
+	for i := range snapshot.Entries {
+		entry := snapshot.Entries[i]
+		for _, remote := range m.remoteRegistries {
+			if remote.Name == entry.Registry {
+				remote.registered[entry.Key] = &entry
+			}
+		}
+	}
+	m.snapshotLock.Lock()
+	m.savedSnapshot = snapshot
+	m.snapshotLock.Unlock()
+	glog.Infof("[%s] loaded snapshot of %d providers saved at %v", m.clusterID, len(snapshot.Entries), snapshot.Time)
+	return nil
+}
+
+// ownedBySnapshot returns the remote providers registered according to the
+// snapshot, and the drift of the others. Providers missing remotely are
+// forgotten, they are registered again while desired.
+func (m *ProviderManager) ownedBySnapshot(remote *RemoteRegistry, owned sets.String, mapper map[string]*dubbo.Provider) sets.String {
+	if remote.registered == nil {
+		remote.registered = make(map[string]*SnapshotEntry)
+		for key := range owned {
+			remote.registered[key] = m.snapshotEntry(remote, key, mapper[key])
+		}
+	} else if m.clusterID != "" {
+		// providers marked by the cluster are its own whatever the snapshot
+		for key := range owned {
+			if _, ok := remote.registered[key]; !ok {
+				remote.registered[key] = m.snapshotEntry(remote, key, mapper[key])
+			}
+		}
+	}
+
+	drift := make([]Drift, 0)
+	remote.modified = sets.NewString()
+	snapshotOwned := sets.NewString()
+	for key, entry := range remote.registered {
+		remoteProvider, ok := mapper[key]
+		if !ok {
+			glog.Warningf("[%s] provider %s registered to %s is missing", m.clusterID, key, remote.Name)
+			drift = append(drift, Drift{Registry: remote.Name, Key: key, Reason: DriftMissing, URL: entry.URL})
+			delete(remote.registered, key)
+			continue
+		}
+		if url := remoteProvider.String(); url != entry.URL {
+			glog.Warningf("[%s] provider %s registered to %s is modified, %s", m.clusterID, key, remote.Name, url)
+			drift = append(drift, Drift{Registry: remote.Name, Key: key, Reason: DriftModified, URL: entry.URL, RemoteURL: url})
+			remote.modified.Insert(key)
+		}
+		snapshotOwned.Insert(key)
+	}
+	sort.Slice(drift, func(i, j int) bool { return drift[i].Key < drift[j].Key })
+
+	m.snapshotLock.Lock()
+	m.drift[remote.Name] = drift
+	m.snapshotLock.Unlock()
+	return snapshotOwned
+}
+
+func (m *ProviderManager) snapshotEntry(remote *RemoteRegistry, key string, provider *dubbo.Provider) *SnapshotEntry {
+	entry := &SnapshotEntry{
+		Registry:  remote.Name,
+		SourceKey: m.sourceKeys[key],
+		Key:       key,
+		URL:       provider.String(),
+	}
+	if entry.SourceKey == "" {
+		entry.SourceKey = key
+	}
+	return entry
+}
+
+// saveSnapshot saves the providers registered when they changed.
+func (m *ProviderManager) saveSnapshot(now time.Time) {
+	entries := make([]SnapshotEntry, 0)
+	for _, remote := range m.remoteRegistries {
+		for _, entry := range remote.registered {
+			entries = append(entries, *entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Registry != entries[j].Registry {
+			return entries[i].Registry < entries[j].Registry
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	if m.savedSnapshot != nil && reflect.DeepEqual(m.savedSnapshot.Entries, entries) {
+		return
+	}
+	snapshot := &Snapshot{ClusterID: m.clusterID, Time: now, Entries: entries}
+	if err := m.snapshots.Save(snapshot); err != nil {
+		glog.Errorf("[%s] save snapshot error, err: %v", m.clusterID, err)
+		return
+	}
+	m.snapshotLock.Lock()
+	m.savedSnapshot = snapshot
+	m.snapshotLock.Unlock()
+}
+
+// SnapshotStatus is the snapshot saved last and the drift of the last
+// refresh.
+type SnapshotStatus struct {
+	Snapshot *Snapshot `json:"snapshot"`
+	Drift    []Drift   `json:"drift"`
+}
+
+func (m *ProviderManager) SnapshotStatus() *SnapshotStatus {
+	m.snapshotLock.Lock()
+	defer m.snapshotLock.Unlock()
+	status := &SnapshotStatus{
+		Snapshot: m.savedSnapshot,
+		Drift:    make([]Drift, 0),
+	}
+	for _, drift := range m.drift {
+		status.Drift = append(status.Drift, drift...)
+	}
+	sort.Slice(status.Drift, func(i, j int) bool {
+		if status.Drift[i].Registry != status.Drift[j].Registry {
+			return status.Drift[i].Registry < status.Drift[j].Registry
+		}
+		return status.Drift[i].Key < status.Drift[j].Key
+	})
+	return status
+}
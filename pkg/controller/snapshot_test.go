@@ -0,0 +1,237 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubetesting "k8s.io/client-go/testing"
+
+	"github.com/whypro/dxinkube/pkg/dubbo"
+	dxtesting "github.com/whypro/dxinkube/pkg/testing"
+)
+
+func TestRefreshUnparseableSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json")
+	if err := ioutil.WriteFile(path, []byte("{bad"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store := NewFileSnapshotStore(path)
+	if _, err := store.Load(); err == nil {
+		t.Fatalf("expected a snapshot parse error")
+	} else if _, ok := err.(*SnapshotParseError); !ok {
+		t.Fatalf("expected a snapshot parse error, got %v", err)
+	}
+
+	local := dxtesting.NewFakeRegistry("dubbo://10.0.0.1:20880/com.foo.Bar?anyhost=true&timestamp=1")
+	remote := dxtesting.NewFakeRegistry("dubbo://2.2.2.2:20880/com.foo.Owned?anyhost=true&dxinkube.cluster=a&timestamp=1")
+	addrConverter := dxtesting.NewFakeAddrConverter(map[string]string{"10.0.0.1:20880": "2.2.2.1:20880"})
+	m := NewProviderManager("a", addrConverter, local, NewRemoteRegistry("remote", remote, nil))
+	m.SetSnapshotStore(store)
+
+	m.Refresh()
+	expected := []string{
+		"dubbo://2.2.2.1:20880/com.foo.Bar?anyhost=true&dxinkube.cluster=a",
+	}
+	if providers := withoutTimestamps(remote.Providers()); !reflect.DeepEqual(providers, expected) {
+		t.Errorf("expected remote providers %v, got %v", expected, providers)
+	}
+
+	snapshot, err := store.Load()
+	if err != nil {
+		t.Fatalf("expected the snapshot saved over, got %v", err)
+	}
+	if snapshot == nil || len(snapshot.Entries) != 1 {
+		t.Errorf("expected a snapshot of 1 provider, got %+v", snapshot)
+	}
+}
+
+// memorySnapshotStore keeps the snapshot as json, as the other stores do.
+type memorySnapshotStore struct {
+	data []byte
+}
+
+func (s *memorySnapshotStore) Load() (*Snapshot, error) {
+	if s.data == nil {
+		return nil, nil
+	}
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(s.data, snapshot); err != nil {
+		return nil, &SnapshotParseError{Err: err}
+	}
+	return snapshot, nil
+}
+
+func (s *memorySnapshotStore) Save(snapshot *Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	s.data = data
+	return nil
+}
+
+// registerWithSnapshot registers the local providers to a new remote
+// registry, the snapshot saved is that of the cluster before a restart.
+func registerWithSnapshot(t *testing.T, clusterID string, local *dxtesting.FakeRegistry, addrConverter *dxtesting.FakeAddrConverter) (*dxtesting.FakeRegistry, SnapshotStore) {
+	remote := dxtesting.NewFakeRegistry()
+	store := &memorySnapshotStore{}
+	m := NewProviderManager(clusterID, addrConverter, local, NewRemoteRegistry("remote", remote, nil))
+	m.SetSnapshotStore(store)
+	m.Refresh()
+	if snapshot, err := store.Load(); err != nil || snapshot == nil || len(snapshot.Entries) != len(local.Providers()) {
+		t.Fatalf("expected a snapshot of the local providers, got %+v, err: %v", snapshot, err)
+	}
+	return remote, store
+}
+
+func TestRefreshRestartWithSnapshot(t *testing.T) {
+	for _, clusterID := range []string{"", "a"} {
+		t.Run("cluster "+clusterID, func(t *testing.T) {
+			local := dxtesting.NewFakeRegistry(
+				"dubbo://10.0.0.1:20880/com.foo.Bar?anyhost=true&timestamp=1",
+				"dubbo://10.0.0.2:20880/com.foo.Baz?anyhost=true&timestamp=1",
+			)
+			addrConverter := dxtesting.NewFakeAddrConverter(map[string]string{
+				"10.0.0.1:20880": "2.2.2.1:20880",
+				"10.0.0.2:20880": "2.2.2.2:20880",
+			})
+			remote, store := registerWithSnapshot(t, clusterID, local, addrConverter)
+
+			// another writer registers a provider, and Baz is gone locally
+			// while the cluster restarts
+			remote.AddNodes("dubbo%3A%2F%2F2.2.2.3%3A20880%2Fcom.foo.Other%3Fanyhost%3Dtrue")
+			local = dxtesting.NewFakeRegistry("dubbo://10.0.0.1:20880/com.foo.Bar?anyhost=true&timestamp=1")
+			m := NewProviderManager(clusterID, addrConverter, local, NewRemoteRegistry("remote", remote, nil))
+			m.SetSnapshotStore(store)
+			remote.ClearActions()
+
+			m.Refresh()
+			expected := []string{
+				"dubbo://2.2.2.1:20880/com.foo.Bar",
+				"dubbo://2.2.2.3:20880/com.foo.Other",
+			}
+			if keys := remote.Keys(); !reflect.DeepEqual(keys, expected) {
+				t.Errorf("expected remote providers %v, got %v", expected, keys)
+			}
+			if registered := remote.ActionsFor(dxtesting.VerbRegister); len(registered) != 0 {
+				t.Errorf("expected nothing registered, got %v", registered)
+			}
+			if drift := m.SnapshotStatus().Drift; len(drift) != 0 {
+				t.Errorf("expected no drift, got %+v", drift)
+			}
+		})
+	}
+}
+
+func TestRefreshSnapshotDrift(t *testing.T) {
+	for _, clusterID := range []string{"", "a"} {
+		t.Run("cluster "+clusterID, func(t *testing.T) {
+			local := dxtesting.NewFakeRegistry(
+				"dubbo://10.0.0.1:20880/com.foo.Bar?anyhost=true&timestamp=1",
+				"dubbo://10.0.0.2:20880/com.foo.Baz?anyhost=true&timestamp=1",
+			)
+			addrConverter := dxtesting.NewFakeAddrConverter(map[string]string{
+				"10.0.0.1:20880": "2.2.2.1:20880",
+				"10.0.0.2:20880": "2.2.2.2:20880",
+			})
+			remote, store := registerWithSnapshot(t, clusterID, local, addrConverter)
+			snapshot, _ := store.Load()
+			urls := make(map[string]string)
+			for _, entry := range snapshot.Entries {
+				urls[entry.Key] = entry.URL
+			}
+
+			// another writer changes Bar and unregisters Baz
+			for _, url := range remote.Providers() {
+				provider := dubbo.NewProvider()
+				if err := provider.Parse(url); err != nil {
+					t.Fatalf("parse provider error, err: %v", err)
+				}
+				remote.UnRegister(provider)
+				if provider.Service == "com.foo.Bar" {
+					provider.SetParam("weight", "50")
+					remote.Register(provider)
+				}
+			}
+			modifiedURL := remote.Providers()[0]
+
+			m := NewProviderManager(clusterID, addrConverter, local, NewRemoteRegistry("remote", remote, nil))
+			m.SetSnapshotStore(store)
+			m.Refresh()
+			expected := []Drift{
+				{
+					Registry:  "remote",
+					Key:       "dubbo://2.2.2.1:20880/com.foo.Bar",
+					Reason:    DriftModified,
+					URL:       urls["dubbo://2.2.2.1:20880/com.foo.Bar"],
+					RemoteURL: modifiedURL,
+				},
+				{
+					Registry: "remote",
+					Key:      "dubbo://2.2.2.2:20880/com.foo.Baz",
+					Reason:   DriftMissing,
+					URL:      urls["dubbo://2.2.2.2:20880/com.foo.Baz"],
+				},
+			}
+			if drift := m.SnapshotStatus().Drift; !reflect.DeepEqual(drift, expected) {
+				t.Errorf("expected drift %+v, got %+v", expected, drift)
+			}
+
+			// both are registered again as the cluster desires them
+			for _, url := range remote.Providers() {
+				if strings.Contains(url, "weight=50") {
+					t.Errorf("expected the modified provider registered again, got %s", url)
+				}
+			}
+			expectedKeys := []string{
+				"dubbo://2.2.2.1:20880/com.foo.Bar",
+				"dubbo://2.2.2.2:20880/com.foo.Baz",
+			}
+			if keys := remote.Keys(); !reflect.DeepEqual(keys, expectedKeys) {
+				t.Errorf("expected remote providers %v, got %v", expectedKeys, keys)
+			}
+		})
+	}
+}
+
+func TestConfigMapSnapshotStoreConflict(t *testing.T) {
+	kubeClient := dxtesting.NewFakeKubeClient(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "snapshots"},
+		Data:       map[string]string{"b": "{}"},
+	})
+	conflicts := 2
+	kubeClient.PrependReactor("update", "configmaps", func(action kubetesting.Action) (bool, runtime.Object, error) {
+		if conflicts == 0 {
+			return false, nil, nil
+		}
+		conflicts--
+		return true, nil, apierrors.NewConflict(v1.Resource("configmaps"), "snapshots", errors.New("updated meanwhile"))
+	})
+	store := NewConfigMapSnapshotStore(kubeClient, "ns", "snapshots", "a")
+	if err := store.Save(&Snapshot{ClusterID: "a", Entries: []SnapshotEntry{}}); err != nil {
+		t.Fatalf("save snapshot error, err: %v", err)
+	}
+	snapshot, err := store.Load()
+	if err != nil || snapshot == nil || snapshot.ClusterID != "a" {
+		t.Errorf("expected the snapshot saved past the conflicts, got %+v, err: %v", snapshot, err)
+	}
+	cm, _ := kubeClient.CoreV1().ConfigMaps("ns").Get("snapshots", metav1.GetOptions{})
+	if cm.Data["b"] != "{}" {
+		t.Errorf("expected the snapshot of another cluster kept, got %v", cm.Data)
+	}
+}
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+const (
+	// BridgedInterfacesKey lists the dubbo interfaces published through a
+	// service
+	BridgedInterfacesKey = "dxinkube/bridged-interfaces"
+	// BridgedRegistriesKey lists the remote registries they are published to
+	BridgedRegistriesKey = "dxinkube/bridged-registries"
+	// LastSyncTimeKey is the time of the last successful sync
+	LastSyncTimeKey = "dxinkube/last-sync-time"
+
+	defaultStatusMinInterval  = 30 * time.Second
+	defaultStatusSyncInterval = 5 * time.Minute
+	defaultStatusQPS          = 5
+	defaultStatusBurst        = 10
+)
+
+type ServiceStatusConfig struct {
+	KubeConfig *rest.Config
+	// KubeClient is used instead of creating a client from KubeConfig when set
+	KubeClient kubernetes.Interface
+	// MinInterval is the shortest interval between two patches of a
+	// service, 30s by default
+	MinInterval time.Duration
+	// SyncInterval is the interval the last sync time of an unchanged
+	// service is refreshed at, 5m by default
+	SyncInterval time.Duration
+	// QPS and Burst limit the patches of every service
+	QPS   float32
+	Burst int
+}
+
+// ServiceStatus is what is published through a service.
+type ServiceStatus struct {
+	Interfaces   sets.String
+	Registries   sets.String
+	LastSyncTime time.Time
+}
+
+func (s *ServiceStatus) annotations() map[string]string {
+	return map[string]string{
+		BridgedInterfacesKey: strings.Join(s.Interfaces.List(), ","),
+		BridgedRegistriesKey: strings.Join(s.Registries.List(), ","),
+		LastSyncTimeKey:      s.LastSyncTime.UTC().Format(time.RFC3339),
+	}
+}
+
+type writtenStatus struct {
+	status    *ServiceStatus
+	patchTime time.Time
+}
+
+// ServiceStatusWriter patches the status of the services as annotations.
+// A changed status is patched at most once per MinInterval, an unchanged one
+// once per SyncInterval, and every patch goes through a rate limiter.
+type ServiceStatusWriter struct {
+	config     *ServiceStatusConfig
+	kubeClient kubernetes.Interface
+	limiter    flowcontrol.RateLimiter
+
+	lock    sync.Mutex
+	written map[string]*writtenStatus
+}
+
+func NewServiceStatusWriter(config *ServiceStatusConfig) (*ServiceStatusWriter, error) {
+	if config.MinInterval == 0 {
+		config.MinInterval = defaultStatusMinInterval
+	}
+	if config.SyncInterval == 0 {
+		config.SyncInterval = defaultStatusSyncInterval
+	}
+	if config.QPS == 0 {
+		config.QPS = defaultStatusQPS
+	}
+	if config.Burst == 0 {
+		config.Burst = defaultStatusBurst
+	}
+	kubeClient := config.KubeClient
+	if kubeClient == nil {
+		var err error
+		kubeClient, err = kubernetes.NewForConfig(config.KubeConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create kubernetes client")
+		}
+	}
+	return &ServiceStatusWriter{
+		config:     config,
+		kubeClient: kubeClient,
+		limiter:    flowcontrol.NewTokenBucketRateLimiter(config.QPS, config.Burst),
+		written:    make(map[string]*writtenStatus),
+	}, nil
+}
+
+// Write patches the statuses due, keyed by service namespace/name. Services
+// written before and missing from statuses publish nothing anymore.
+func (w *ServiceStatusWriter) Write(statuses map[string]*ServiceStatus, now time.Time) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for key, written := range w.written {
+		if _, ok := statuses[key]; !ok && written.status.Interfaces.Len() > 0 {
+			statuses[key] = &ServiceStatus{
+				Interfaces:   sets.NewString(),
+				Registries:   sets.NewString(),
+				LastSyncTime: now,
+			}
+		}
+	}
+
+	for key, status := range statuses {
+		written, ok := w.written[key]
+		if ok {
+			changed := !written.status.Interfaces.Equal(status.Interfaces) || !written.status.Registries.Equal(status.Registries)
+			elapsed := now.Sub(written.patchTime)
+			if elapsed < w.config.MinInterval || (!changed && elapsed < w.config.SyncInterval) {
+				continue
+			}
+		}
+		if !w.limiter.TryAccept() {
+			glog.V(4).Infof("service status patches are throttled, %s is delayed", key)
+			continue
+		}
+		err := w.patch(key, status)
+		if apierrors.IsNotFound(err) {
+			delete(w.written, key)
+			continue
+		}
+		if err != nil {
+			glog.Errorf("patch status of service %s error, err: %v", key, err)
+			continue
+		}
+		w.written[key] = &writtenStatus{status: status, patchTime: now}
+	}
+}
+
+func (w *ServiceStatusWriter) patch(key string, status *ServiceStatus) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": status.annotations(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.kubeClient.CoreV1().Services(namespace).Patch(name, types.MergePatchType, patch)
+	return err
+}
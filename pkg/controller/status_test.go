@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	dxtesting "github.com/whypro/dxinkube/pkg/testing"
+)
+
+func newStatusTestService(name string) *v1.Service {
+	return &v1.Service{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "ns",
+		Name:        name,
+		Annotations: map[string]string{"owner": "team"},
+	}}
+}
+
+func newServiceStatus(interfaces []string, registries []string, now time.Time) *ServiceStatus {
+	return &ServiceStatus{
+		Interfaces:   sets.NewString(interfaces...),
+		Registries:   sets.NewString(registries...),
+		LastSyncTime: now,
+	}
+}
+
+func countPatches(kubeClient *dxtesting.FakeKubeClient) int {
+	count := 0
+	for _, action := range kubeClient.Actions() {
+		if action.GetVerb() == "patch" {
+			count++
+		}
+	}
+	return count
+}
+
+func expectAnnotations(t *testing.T, step string, kubeClient *dxtesting.FakeKubeClient, name string, interfaces string, registries string) {
+	svc, err := kubeClient.CoreV1().Services("ns").Get(name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("%s: get service error, err: %v", step, err)
+	}
+	if svc.Annotations[BridgedInterfacesKey] != interfaces || svc.Annotations[BridgedRegistriesKey] != registries {
+		t.Errorf("%s: expected interfaces %q, registries %q, got %v", step, interfaces, registries, svc.Annotations)
+	}
+	// the merge patch keeps the other annotations
+	if svc.Annotations["owner"] != "team" {
+		t.Errorf("%s: expected the other annotations kept, got %v", step, svc.Annotations)
+	}
+}
+
+func TestServiceStatusWriter(t *testing.T) {
+	kubeClient := dxtesting.NewFakeKubeClient(newStatusTestService("a"))
+	w, err := NewServiceStatusWriter(&ServiceStatusConfig{
+		KubeClient:   kubeClient,
+		MinInterval:  30 * time.Second,
+		SyncInterval: 5 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("new service status writer error, err: %v", err)
+	}
+	now := time.Now()
+	steps := []struct {
+		name       string
+		after      time.Duration
+		statuses   map[string]*ServiceStatus
+		patches    int
+		interfaces string
+		registries string
+	}{
+		{
+			name:       "first write",
+			statuses:   map[string]*ServiceStatus{"ns/a": newServiceStatus([]string{"com.foo.Bar"}, []string{"remote"}, now)},
+			patches:    1,
+			interfaces: "com.foo.Bar",
+			registries: "remote",
+		},
+		{
+			name:       "change within the min interval",
+			after:      10 * time.Second,
+			statuses:   map[string]*ServiceStatus{"ns/a": newServiceStatus([]string{"com.foo.Bar", "com.foo.Baz"}, []string{"remote"}, now)},
+			patches:    1,
+			interfaces: "com.foo.Bar",
+			registries: "remote",
+		},
+		{
+			name:       "change past the min interval",
+			after:      31 * time.Second,
+			statuses:   map[string]*ServiceStatus{"ns/a": newServiceStatus([]string{"com.foo.Bar", "com.foo.Baz"}, []string{"remote"}, now)},
+			patches:    2,
+			interfaces: "com.foo.Bar,com.foo.Baz",
+			registries: "remote",
+		},
+		{
+			name:       "unchanged within the sync interval",
+			after:      2 * time.Minute,
+			statuses:   map[string]*ServiceStatus{"ns/a": newServiceStatus([]string{"com.foo.Bar", "com.foo.Baz"}, []string{"remote"}, now)},
+			patches:    2,
+			interfaces: "com.foo.Bar,com.foo.Baz",
+			registries: "remote",
+		},
+		{
+			name:       "unchanged past the sync interval",
+			after:      6 * time.Minute,
+			statuses:   map[string]*ServiceStatus{"ns/a": newServiceStatus([]string{"com.foo.Bar", "com.foo.Baz"}, []string{"remote"}, now)},
+			patches:    3,
+			interfaces: "com.foo.Bar,com.foo.Baz",
+			registries: "remote",
+		},
+		{
+			name:     "cleared",
+			after:    7 * time.Minute,
+			statuses: map[string]*ServiceStatus{},
+			patches:  4,
+		},
+		{
+			name:     "cleared again",
+			after:    20 * time.Minute,
+			statuses: map[string]*ServiceStatus{},
+			patches:  4,
+		},
+	}
+	for _, step := range steps {
+		w.Write(step.statuses, now.Add(step.after))
+		if got := countPatches(kubeClient); got != step.patches {
+			t.Errorf("%s: expected %d patches, got %d", step.name, step.patches, got)
+		}
+		expectAnnotations(t, step.name, kubeClient, "a", step.interfaces, step.registries)
+	}
+}
+
+func TestServiceStatusWriterRateLimit(t *testing.T) {
+	kubeClient := dxtesting.NewFakeKubeClient(newStatusTestService("a"), newStatusTestService("b"))
+	w, err := NewServiceStatusWriter(&ServiceStatusConfig{
+		KubeClient: kubeClient,
+		QPS:        0.001,
+		Burst:      1,
+	})
+	if err != nil {
+		t.Fatalf("new service status writer error, err: %v", err)
+	}
+	now := time.Now()
+	w.Write(map[string]*ServiceStatus{
+		"ns/a": newServiceStatus([]string{"com.foo.Bar"}, []string{"remote"}, now),
+		"ns/b": newServiceStatus([]string{"com.foo.Baz"}, []string{"remote"}, now),
+	}, now)
+	if got := countPatches(kubeClient); got != 1 {
+		t.Errorf("expected the burst to allow 1 patch, got %d", got)
+	}
+}
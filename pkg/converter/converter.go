@@ -1,6 +1,199 @@
 package converter
 
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// ExposeKey is the label or annotation selecting how a workload is exposed
+	ExposeKey = "dxinkube/expose"
+
+	ExposeLoadBalancer = "loadbalancer"
+	ExposeNodePort     = "nodeport"
+	ExposeHostPort     = "hostport"
+	ExposeDirect       = "direct"
+)
+
+// ErrNotManaged is returned by a converter for addresses it is not
+// responsible for, a Chain then tries the next converter.
+var ErrNotManaged = errors.New("addr is not managed by this converter")
+
+// ErrNotReady is returned for addresses of not ready or terminating pods,
+// their providers are withheld from the remote registries.
+var ErrNotReady = errors.New("addr is not ready")
+
 type AddrConverterInterface interface {
 	ConvertAddr(podAddr string) (string, error)
 	Run(stopCh <-chan struct{})
 }
+
+// ExposeConverter is implemented by converters able to convert an address
+// through a given expose strategy, one of the ExposeKey annotation values.
+type ExposeConverter interface {
+	ConvertAddrAs(podAddr string, expose string) (string, error)
+}
+
+// ServiceLocator is implemented by converters knowing the service a pod
+// address is exposed through.
+type ServiceLocator interface {
+	ServiceOfAddr(podAddr string) (*v1.Service, bool)
+}
+
+// ChangeNotifier is implemented by converters telling when addresses they
+// converted are withdrawn, so their providers are unregistered without
+// waiting for the next refresh.
+type ChangeNotifier interface {
+	SetChangeHandler(handler func())
+}
+
+// CacheSyncer is implemented by converters backed by informers. Until
+// HasSynced their conversions are not to be trusted, an address missing from
+// caches still being listed is not gone.
+type CacheSyncer interface {
+	HasSynced() bool
+}
+
+// HasSynced tells whether converter has synced, converters that are not a
+// CacheSyncer always have.
+func HasSynced(converter AddrConverterInterface) bool {
+	if syncer, ok := converter.(CacheSyncer); ok {
+		return syncer.HasSynced()
+	}
+	return true
+}
+
+type changeNotifier struct {
+	lock    sync.RWMutex
+	handler func()
+}
+
+func (n *changeNotifier) SetChangeHandler(handler func()) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.handler = handler
+}
+
+func (n *changeNotifier) notifyChange() {
+	n.lock.RLock()
+	handler := n.handler
+	n.lock.RUnlock()
+	if handler != nil {
+		handler()
+	}
+}
+
+// setChangeHandler sets handler on every converter that is a ChangeNotifier.
+func setChangeHandler(converters []AddrConverterInterface, handler func()) {
+	for _, converter := range converters {
+		if notifier, ok := converter.(ChangeNotifier); ok {
+			notifier.SetChangeHandler(handler)
+		}
+	}
+}
+
+// Chain tries its converters in order. The first result that is not
+// ErrNotManaged is returned.
+type Chain []AddrConverterInterface
+
+func NewChain(converters ...AddrConverterInterface) Chain {
+	return Chain(converters)
+}
+
+func (c Chain) ConvertAddr(podAddr string) (string, error) {
+	err := ErrNotManaged
+	for _, converter := range c {
+		var addr string
+		addr, err = converter.ConvertAddr(podAddr)
+		if err != ErrNotManaged {
+			return addr, err
+		}
+	}
+	return "", err
+}
+
+// ConvertAddrAs converts podAddr through the first converter of the chain
+// supporting expose strategies.
+func (c Chain) ConvertAddrAs(podAddr string, expose string) (string, error) {
+	for _, converter := range c {
+		if exposeConverter, ok := converter.(ExposeConverter); ok {
+			return exposeConverter.ConvertAddrAs(podAddr, expose)
+		}
+	}
+	return "", errors.Errorf("expose %q is not supported", expose)
+}
+
+func (c Chain) ServiceOfAddr(podAddr string) (*v1.Service, bool) {
+	for _, converter := range c {
+		if locator, ok := converter.(ServiceLocator); ok {
+			if svc, ok := locator.ServiceOfAddr(podAddr); ok {
+				return svc, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (c Chain) SetChangeHandler(handler func()) {
+	setChangeHandler(c, handler)
+}
+
+func (c Chain) HasSynced() bool {
+	for _, converter := range c {
+		if !HasSynced(converter) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Chain) Run(stopCh <-chan struct{}) {
+	for _, converter := range c {
+		go converter.Run(stopCh)
+	}
+}
+
+// newKubeClient returns kubeClient when set, or a client created from kubeConfig.
+func newKubeClient(kubeConfig *rest.Config, kubeClient kubernetes.Interface) (kubernetes.Interface, error) {
+	if kubeClient != nil {
+		return kubeClient, nil
+	}
+	kubeClient, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create kubernetes client")
+	}
+	return kubeClient, nil
+}
+
+// NewInformerFactory returns an informer factory of every namespace, so the
+// converters of a cluster share their informers.
+func NewInformerFactory(kubeConfig *rest.Config, kubeClient kubernetes.Interface, resyncPeriod time.Duration) (informers.SharedInformerFactory, error) {
+	kubeClient, err := newKubeClient(kubeConfig, kubeClient)
+	if err != nil {
+		return nil, err
+	}
+	return informers.NewSharedInformerFactory(kubeClient, resyncPeriod), nil
+}
+
+// addIndexers adds the indexers a shared informer is missing, the converters
+// sharing it add the same ones.
+func addIndexers(informer cache.SharedIndexInformer, indexers cache.Indexers) error {
+	missing := cache.Indexers{}
+	existing := informer.GetIndexer().GetIndexers()
+	for name, indexFunc := range indexers {
+		if _, ok := existing[name]; !ok {
+			missing[name] = indexFunc
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return informer.AddIndexers(missing)
+}
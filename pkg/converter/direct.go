@@ -0,0 +1,174 @@
+package converter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	informersv1 "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	readyAddrIndex    = "readyAddr"
+	notReadyAddrIndex = "notReadyAddr"
+)
+
+type DirectControllerConfig struct {
+	KubeConfig *rest.Config
+	// KubeClient is used instead of creating a client from KubeConfig when set
+	KubeClient   kubernetes.Interface
+	ResyncPeriod time.Duration
+	// Namespaces restricts the converter to pods of these namespaces, pods of
+	// other namespaces are ErrNotManaged. Every namespace when empty.
+	Namespaces []string
+	// InformerFactory is shared with the other converters when set
+	InformerFactory informers.SharedInformerFactory
+}
+
+// DirectController passes pod addresses through unchanged, for clusters whose
+// pod ips are routable from outside. An address is only bridged while it is
+// a ready address of some endpoints.
+type DirectController struct {
+	changeNotifier
+
+	config            *DirectControllerConfig
+	kubeClient        kubernetes.Interface
+	namespaces        sets.String
+	endpointsInformer cache.SharedIndexInformer
+}
+
+func endpointsAddrIndexFunc(ready bool) cache.IndexFunc {
+	return func(obj interface{}) ([]string, error) {
+		ep, ok := obj.(*v1.Endpoints)
+		if !ok {
+			return []string{}, nil
+		}
+		addrs := make([]string, 0)
+		for _, subset := range ep.Subsets {
+			epAddrs := subset.Addresses
+			if !ready {
+				epAddrs = subset.NotReadyAddresses
+			}
+			for _, addr := range epAddrs {
+				for _, port := range subset.Ports {
+					addrs = append(addrs, fmt.Sprintf("%s:%d", addr.IP, port.Port))
+				}
+			}
+		}
+		return addrs, nil
+	}
+}
+
+func NewDirectController(config *DirectControllerConfig) (*DirectController, error) {
+	kubeClient, err := newKubeClient(config.KubeConfig, config.KubeClient)
+	if err != nil {
+		return nil, err
+	}
+
+	indexers := cache.Indexers{
+		readyAddrIndex:    endpointsAddrIndexFunc(true),
+		notReadyAddrIndex: endpointsAddrIndexFunc(false),
+	}
+	var endpointsInformer cache.SharedIndexInformer
+	if config.InformerFactory != nil {
+		endpointsInformer = config.InformerFactory.Core().V1().Endpoints().Informer()
+		if err := addIndexers(endpointsInformer, indexers); err != nil {
+			return nil, err
+		}
+	} else {
+		namespace := ""
+		if len(config.Namespaces) == 1 {
+			namespace = config.Namespaces[0]
+		}
+		endpointsInformer = informersv1.NewEndpointsInformer(kubeClient, namespace, config.ResyncPeriod, indexers)
+	}
+
+	c := &DirectController{
+		config:            config,
+		kubeClient:        kubeClient,
+		namespaces:        sets.NewString(config.Namespaces...),
+		endpointsInformer: endpointsInformer,
+	}
+	endpointsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: c.onEndpointsUpdate,
+		DeleteFunc: func(obj interface{}) { c.notifyChange() },
+	})
+	return c, nil
+}
+
+// onEndpointsUpdate notifies when ready addresses are withdrawn.
+func (c *DirectController) onEndpointsUpdate(oldObj, newObj interface{}) {
+	oldEp, ok := oldObj.(*v1.Endpoints)
+	if !ok {
+		return
+	}
+	newEp, ok := newObj.(*v1.Endpoints)
+	if !ok {
+		return
+	}
+	if getPodAddrsFromEndpoints(oldEp).Difference(getPodAddrsFromEndpoints(newEp)).Len() > 0 {
+		c.notifyChange()
+	}
+}
+
+func (c *DirectController) Run(stopCh <-chan struct{}) {
+	if c.config.InformerFactory != nil {
+		c.config.InformerFactory.Start(stopCh)
+		return
+	}
+	go c.endpointsInformer.Run(stopCh)
+}
+
+func (c *DirectController) HasSynced() bool {
+	return c.endpointsInformer.HasSynced()
+}
+
+// lookup returns the namespaces of the endpoints holding podAddr in index.
+func (c *DirectController) lookup(index string, podAddr string) (sets.String, error) {
+	objs, err := c.endpointsInformer.GetIndexer().ByIndex(index, podAddr)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := sets.NewString()
+	for _, obj := range objs {
+		if ep, ok := obj.(*v1.Endpoints); ok {
+			namespaces.Insert(ep.Namespace)
+		}
+	}
+	return namespaces, nil
+}
+
+func (c *DirectController) managed(namespaces sets.String) bool {
+	return c.namespaces.Len() == 0 || c.namespaces.HasAny(namespaces.List()...)
+}
+
+func (c *DirectController) ConvertAddr(podAddr string) (string, error) {
+	namespaces, err := c.lookup(readyAddrIndex, podAddr)
+	if err != nil {
+		return "", err
+	}
+	if namespaces.Len() > 0 && c.managed(namespaces) {
+		return podAddr, nil
+	}
+
+	namespaces, err = c.lookup(notReadyAddrIndex, podAddr)
+	if err != nil {
+		return "", err
+	}
+	if namespaces.Len() > 0 && c.managed(namespaces) {
+		glog.V(4).Infof("podIP %s is not ready", podAddr)
+		return "", ErrNotReady
+	}
+
+	if c.namespaces.Len() > 0 {
+		return "", ErrNotManaged
+	}
+	glog.Errorf("podIP %s is not a ready endpoint", podAddr)
+	return "", fmt.Errorf("podIP is not a ready endpoint")
+}
@@ -0,0 +1,75 @@
+package converter
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newDirectTestEndpoints(namespace string, ready string, notReady string) *v1.Endpoints {
+	return &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "demo"},
+		Subsets: []v1.EndpointSubset{{
+			Addresses:         []v1.EndpointAddress{{IP: ready}},
+			NotReadyAddresses: []v1.EndpointAddress{{IP: notReady}},
+			Ports:             []v1.EndpointPort{{Name: "dubbo", Port: 20880}},
+		}},
+	}
+}
+
+func TestDirectConvertAddr(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(
+		newDirectTestEndpoints("a", "10.0.0.1", "10.0.0.2"),
+		newDirectTestEndpoints("b", "10.0.0.3", "10.0.0.4"),
+	)
+	tests := []struct {
+		name       string
+		namespaces []string
+		podAddr    string
+		expected   string
+		err        error
+		// failed is set for errors other than err
+		failed bool
+	}{
+		{name: "ready", podAddr: "10.0.0.1:20880", expected: "10.0.0.1:20880"},
+		{name: "not ready", podAddr: "10.0.0.2:20880", err: ErrNotReady},
+		{name: "ready other namespace", podAddr: "10.0.0.3:20880", expected: "10.0.0.3:20880"},
+		{name: "unknown", podAddr: "10.0.0.9:20880", failed: true},
+		{name: "other port", podAddr: "10.0.0.1:20881", failed: true},
+		{name: "one namespace ready", namespaces: []string{"a"}, podAddr: "10.0.0.1:20880", expected: "10.0.0.1:20880"},
+		{name: "one namespace unmanaged", namespaces: []string{"a"}, podAddr: "10.0.0.3:20880", err: ErrNotManaged},
+		{name: "namespaces ready", namespaces: []string{"a", "c"}, podAddr: "10.0.0.1:20880", expected: "10.0.0.1:20880"},
+		{name: "namespaces not ready", namespaces: []string{"a", "c"}, podAddr: "10.0.0.2:20880", err: ErrNotReady},
+		{name: "namespaces unmanaged ready", namespaces: []string{"a", "c"}, podAddr: "10.0.0.3:20880", err: ErrNotManaged},
+		{name: "namespaces unmanaged not ready", namespaces: []string{"a", "c"}, podAddr: "10.0.0.4:20880", err: ErrNotManaged},
+		{name: "namespaces unknown", namespaces: []string{"a", "c"}, podAddr: "10.0.0.9:20880", err: ErrNotManaged},
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	for _, test := range tests {
+		c, err := NewDirectController(&DirectControllerConfig{KubeClient: kubeClient, Namespaces: test.namespaces})
+		if err != nil {
+			t.Fatalf("new direct controller error, err: %v", err)
+		}
+		c.Run(stopCh)
+		if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+			return c.HasSynced(), nil
+		}); err != nil {
+			t.Fatal("direct caches not synced")
+		}
+		addr, err := c.ConvertAddr(test.podAddr)
+		if test.failed {
+			if err == nil || err == ErrNotManaged || err == ErrNotReady {
+				t.Errorf("%s: expected a conversion error, got %q, %v", test.name, addr, err)
+			}
+			continue
+		}
+		if addr != test.expected || err != test.err {
+			t.Errorf("%s: expected %q, %v, got %q, %v", test.name, test.expected, test.err, addr, err)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	informersv1 "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	endpointSliceGroupVersion = "discovery.k8s.io/v1"
+	endpointSliceResource     = "endpointslices"
+
+	// ServiceNameLabel is set by kubernetes on the EndpointSlices of a service
+	ServiceNameLabel = "kubernetes.io/service-name"
+
+	serviceNameIndex = "serviceName"
+)
+
+// endpointSlice holds the discovery.k8s.io/v1 EndpointSlice fields in use,
+// the vendored client-go predates the api.
+type endpointSlice struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	AddressType       string                  `json:"addressType"`
+	Endpoints         []endpointSliceEndpoint `json:"endpoints"`
+	Ports             []endpointSlicePort     `json:"ports"`
+}
+
+type endpointSliceEndpoint struct {
+	Addresses  []string                `json:"addresses"`
+	Conditions endpointSliceConditions `json:"conditions"`
+	TargetRef  *v1.ObjectReference     `json:"targetRef,omitempty"`
+	NodeName   *string                 `json:"nodeName,omitempty"`
+}
+
+type endpointSliceConditions struct {
+	Ready       *bool `json:"ready,omitempty"`
+	Serving     *bool `json:"serving,omitempty"`
+	Terminating *bool `json:"terminating,omitempty"`
+}
+
+func (c endpointSliceConditions) isReady() bool {
+	if c.Terminating != nil && *c.Terminating {
+		return false
+	}
+	return c.Ready == nil || *c.Ready
+}
+
+type endpointSlicePort struct {
+	Name     *string      `json:"name,omitempty"`
+	Protocol *v1.Protocol `json:"protocol,omitempty"`
+	Port     *int32       `json:"port,omitempty"`
+}
+
+func endpointSliceFromUnstructured(obj interface{}) (*endpointSlice, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("invalid obj type: %T", obj)
+	}
+	data, err := u.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	slice := &endpointSlice{}
+	if err := json.Unmarshal(data, slice); err != nil {
+		return nil, err
+	}
+	return slice, nil
+}
+
+// serviceNameIndexFunc indexes EndpointSlices by namespace/service name.
+func serviceNameIndexFunc(obj interface{}) ([]string, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return []string{}, nil
+	}
+	name, ok := u.GetLabels()[ServiceNameLabel]
+	if !ok {
+		return []string{}, nil
+	}
+	return []string{u.GetNamespace() + "/" + name}, nil
+}
+
+// endpointsSource provides the endpoints of services, read from core/v1
+// Endpoints or aggregated from EndpointSlices.
+type endpointsSource interface {
+	Get(namespace string, name string) (*v1.Endpoints, error)
+	AddEventHandler(handler cache.ResourceEventHandler)
+	Run(stopCh <-chan struct{})
+	HasSynced() bool
+}
+
+type coreEndpointsSource struct {
+	informer cache.SharedIndexInformer
+	lister   listersv1.EndpointsLister
+}
+
+func newCoreEndpointsSource(kubeClient kubernetes.Interface, namespace string, resyncPeriod time.Duration) *coreEndpointsSource {
+	informer := informersv1.NewEndpointsInformer(kubeClient, namespace, resyncPeriod, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+	return &coreEndpointsSource{
+		informer: informer,
+		lister:   listersv1.NewEndpointsLister(informer.GetIndexer()),
+	}
+}
+
+func (s *coreEndpointsSource) Get(namespace string, name string) (*v1.Endpoints, error) {
+	return s.lister.Endpoints(namespace).Get(name)
+}
+
+func (s *coreEndpointsSource) AddEventHandler(handler cache.ResourceEventHandler) {
+	s.informer.AddEventHandler(handler)
+}
+
+func (s *coreEndpointsSource) Run(stopCh <-chan struct{}) {
+	s.informer.Run(stopCh)
+}
+
+func (s *coreEndpointsSource) HasSynced() bool {
+	return s.informer.HasSynced()
+}
+
+// endpointSliceSource aggregates the EndpointSlices of each service into a
+// single Endpoints, one subset per slice, and notifies its handlers of the
+// aggregated Endpoints changes.
+type endpointSliceSource struct {
+	informer cache.SharedIndexInformer
+
+	lock      sync.RWMutex
+	endpoints map[string]*v1.Endpoints
+	handlers  []cache.ResourceEventHandler
+}
+
+func newEndpointSliceSource(client dynamic.Interface, namespace string, resyncPeriod time.Duration) *endpointSliceSource {
+	resource := client.Resource(&metav1.APIResource{Name: endpointSliceResource, Namespaced: true}, namespace)
+	informer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return resource.List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return resource.Watch(options)
+			},
+		},
+		&unstructured.Unstructured{},
+		resyncPeriod,
+		cache.Indexers{serviceNameIndex: serviceNameIndexFunc},
+	)
+	s := &endpointSliceSource{
+		informer:  informer,
+		endpoints: make(map[string]*v1.Endpoints),
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    s.onSliceChange,
+		UpdateFunc: func(oldObj, newObj interface{}) { s.onSliceChange(newObj) },
+		DeleteFunc: s.onSliceChange,
+	})
+	return s
+}
+
+func (s *endpointSliceSource) Get(namespace string, name string) (*v1.Endpoints, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	ep, ok := s.endpoints[namespace+"/"+name]
+	if !ok {
+		return nil, errors.NewNotFound(v1.Resource("endpoints"), name)
+	}
+	return ep, nil
+}
+
+func (s *endpointSliceSource) AddEventHandler(handler cache.ResourceEventHandler) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.handlers = append(s.handlers, handler)
+}
+
+func (s *endpointSliceSource) Run(stopCh <-chan struct{}) {
+	s.informer.Run(stopCh)
+}
+
+func (s *endpointSliceSource) HasSynced() bool {
+	return s.informer.HasSynced()
+}
+
+func (s *endpointSliceSource) onSliceChange(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	keys, err := serviceNameIndexFunc(obj)
+	if err != nil || len(keys) == 0 {
+		glog.V(7).Infof("skip endpoint slice without service, obj: %T", obj)
+		return
+	}
+	key := keys[0]
+
+	objs, err := s.informer.GetIndexer().ByIndex(serviceNameIndex, key)
+	if err != nil {
+		glog.Errorf("list endpoint slices of service %s error, err: %v", key, err)
+		return
+	}
+	slices := make([]*endpointSlice, 0, len(objs))
+	for _, obj := range objs {
+		slice, err := endpointSliceFromUnstructured(obj)
+		if err != nil {
+			glog.Errorf("parse endpoint slice error, err: %v", err)
+			continue
+		}
+		slices = append(slices, slice)
+	}
+
+	s.lock.Lock()
+	oldEp, existed := s.endpoints[key]
+	var newEp *v1.Endpoints
+	if len(slices) == 0 {
+		delete(s.endpoints, key)
+	} else {
+		newEp = endpointsFromSlices(slices)
+		s.endpoints[key] = newEp
+	}
+	handlers := s.handlers
+	s.lock.Unlock()
+
+	for _, handler := range handlers {
+		switch {
+		case newEp == nil && existed:
+			handler.OnDelete(oldEp)
+		case newEp != nil && !existed:
+			handler.OnAdd(newEp)
+		case newEp != nil && !reflect.DeepEqual(oldEp, newEp):
+			handler.OnUpdate(oldEp, newEp)
+		}
+	}
+}
+
+// endpointsFromSlices aggregates the slices of one service, slices are
+// sorted by name so the result does not depend on the informer order.
+func endpointsFromSlices(slices []*endpointSlice) *v1.Endpoints {
+	sort.Slice(slices, func(i, j int) bool {
+		return slices[i].Name < slices[j].Name
+	})
+	first := slices[0]
+	ep := &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: first.Namespace,
+			Name:      first.Labels[ServiceNameLabel],
+			Labels:    make(map[string]string),
+		},
+	}
+	for k, v := range first.Labels {
+		ep.Labels[k] = v
+	}
+	delete(ep.Labels, ServiceNameLabel)
+
+	for _, slice := range slices {
+		if slice.AddressType != "IPv4" && slice.AddressType != "IPv6" {
+			continue
+		}
+		subset := v1.EndpointSubset{}
+		for _, port := range slice.Ports {
+			if port.Port == nil {
+				continue
+			}
+			epPort := v1.EndpointPort{Port: *port.Port, Protocol: v1.ProtocolTCP}
+			if port.Name != nil {
+				epPort.Name = *port.Name
+			}
+			if port.Protocol != nil {
+				epPort.Protocol = *port.Protocol
+			}
+			subset.Ports = append(subset.Ports, epPort)
+		}
+		for _, endpoint := range slice.Endpoints {
+			for _, addr := range endpoint.Addresses {
+				epAddr := v1.EndpointAddress{IP: addr, TargetRef: endpoint.TargetRef, NodeName: endpoint.NodeName}
+				// a nil ready condition is to be interpreted as ready, a
+				// terminating endpoint is not ready whatever it reports
+				if endpoint.Conditions.isReady() {
+					subset.Addresses = append(subset.Addresses, epAddr)
+				} else {
+					subset.NotReadyAddresses = append(subset.NotReadyAddresses, epAddr)
+				}
+			}
+		}
+		if len(subset.Ports) > 0 && (len(subset.Addresses) > 0 || len(subset.NotReadyAddresses) > 0) {
+			ep.Subsets = append(ep.Subsets, subset)
+		}
+	}
+	return ep
+}
+
+// hasEndpointSlices tells whether the server serves discovery.k8s.io/v1
+// EndpointSlices.
+func hasEndpointSlices(kubeClient kubernetes.Interface) (bool, error) {
+	resources, err := kubeClient.Discovery().ServerResourcesForGroupVersion(endpointSliceGroupVersion)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, resource := range resources.APIResources {
+		if resource.Name == endpointSliceResource {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// newEndpointSliceClient returns a dynamic client of discovery.k8s.io/v1.
+func newEndpointSliceClient(kubeConfig *rest.Config) (dynamic.Interface, error) {
+	gv, err := schema.ParseGroupVersion(endpointSliceGroupVersion)
+	if err != nil {
+		return nil, err
+	}
+	config := *kubeConfig
+	config.GroupVersion = &gv
+	config.APIPath = "/apis"
+	return dynamic.NewClient(&config)
+}
+
+// endpointSliceClientOf returns a discovery.k8s.io/v1 client, sliceClient
+// or one created from kubeConfig, when the server serves EndpointSlices. It
+// returns nil when Endpoints are to be used instead.
+func endpointSliceClientOf(kubeClient kubernetes.Interface, kubeConfig *rest.Config, sliceClient dynamic.Interface) dynamic.Interface {
+	ok, err := hasEndpointSlices(kubeClient)
+	if err != nil {
+		glog.Warningf("discover endpoint slices error, fall back to endpoints, err: %v", err)
+		ok = false
+	}
+	if ok && sliceClient == nil && kubeConfig != nil {
+		sliceClient, err = newEndpointSliceClient(kubeConfig)
+		if err != nil {
+			glog.Warningf("create endpoint slice client error, fall back to endpoints, err: %v", err)
+		}
+	}
+	if !ok || sliceClient == nil {
+		glog.Infof("endpoint slices are not available, using endpoints")
+		return nil
+	}
+	glog.Infof("using endpoint slices")
+	return sliceClient
+}
+
+// newEndpointsSource returns an EndpointSlice source of namespace when
+// sliceClient is set, an Endpoints one otherwise.
+func newEndpointsSource(kubeClient kubernetes.Interface, sliceClient dynamic.Interface, namespace string, resyncPeriod time.Duration) endpointsSource {
+	if sliceClient == nil {
+		return newCoreEndpointsSource(kubeClient, namespace, resyncPeriod)
+	}
+	return newEndpointSliceSource(sliceClient, namespace, resyncPeriod)
+}
@@ -0,0 +1,166 @@
+package converter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	kubetesting "k8s.io/client-go/testing"
+)
+
+// newTestSlice returns an EndpointSlice of the service svc in namespace ns,
+// conditions are the conditions of its endpoint.
+func newTestSlice(name string, ip string, conditions map[string]interface{}) unstructured.Unstructured {
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": endpointSliceGroupVersion,
+		"kind":       "EndpointSlice",
+		"metadata": map[string]interface{}{
+			"namespace": "ns",
+			"name":      name,
+			"labels":    map[string]interface{}{ServiceNameLabel: "svc"},
+		},
+		"addressType": "IPv4",
+		"endpoints": []interface{}{
+			map[string]interface{}{"addresses": []interface{}{ip}, "conditions": conditions},
+		},
+		"ports": []interface{}{
+			map[string]interface{}{"name": "dubbo", "port": int64(20880), "protocol": "TCP"},
+		},
+	}}
+}
+
+func newTestTLBService() *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "svc", Labels: map[string]string{"ke-tlb/owner": "x"}},
+		Spec:       v1.ServiceSpec{Ports: []v1.ServicePort{{Name: "dubbo", Port: 30000}}},
+		Status: v1.ServiceStatus{LoadBalancer: v1.LoadBalancerStatus{
+			Ingress: []v1.LoadBalancerIngress{{IP: "192.168.0.100"}},
+		}},
+	}
+}
+
+func TestEndpointsFromSlices(t *testing.T) {
+	objs := []unstructured.Unstructured{
+		newTestSlice("svc-b", "10.0.0.2", map[string]interface{}{"ready": false, "terminating": true}),
+		newTestSlice("svc-a", "10.0.0.1", map[string]interface{}{}),
+		newTestSlice("svc-c", "10.0.0.3", map[string]interface{}{"ready": true, "terminating": true}),
+	}
+	slices := make([]*endpointSlice, 0, len(objs))
+	for i := range objs {
+		slice, err := endpointSliceFromUnstructured(&objs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices = append(slices, slice)
+	}
+
+	ports := []v1.EndpointPort{{Name: "dubbo", Port: 20880, Protocol: v1.ProtocolTCP}}
+	expected := &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "svc", Labels: map[string]string{}},
+		Subsets: []v1.EndpointSubset{
+			{Addresses: []v1.EndpointAddress{{IP: "10.0.0.1"}}, Ports: ports},
+			{NotReadyAddresses: []v1.EndpointAddress{{IP: "10.0.0.2"}}, Ports: ports},
+			{NotReadyAddresses: []v1.EndpointAddress{{IP: "10.0.0.3"}}, Ports: ports},
+		},
+	}
+	if ep := endpointsFromSlices(slices); !reflect.DeepEqual(ep, expected) {
+		t.Errorf("expected %+v, got %+v", expected, ep)
+	}
+}
+
+func TestTLBControllerEndpointSlices(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(newTestTLBService())
+	kubeClient.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{{
+		GroupVersion: endpointSliceGroupVersion,
+		APIResources: []metav1.APIResource{{Name: endpointSliceResource, Namespaced: true}},
+	}}
+	sliceClient := &fakedynamic.FakeClient{
+		GroupVersion: schema.GroupVersion{Group: "discovery.k8s.io", Version: "v1"},
+		Fake:         &kubetesting.Fake{},
+	}
+	sliceClient.AddReactor("list", "*", func(kubetesting.Action) (bool, runtime.Object, error) {
+		return true, &unstructured.UnstructuredList{Items: []unstructured.Unstructured{
+			newTestSlice("svc-a", "10.0.0.1", map[string]interface{}{"ready": true}),
+			newTestSlice("svc-b", "10.0.0.2", map[string]interface{}{"ready": true}),
+			newTestSlice("svc-c", "10.0.0.3", map[string]interface{}{"ready": false, "terminating": true}),
+		}}, nil
+	})
+	sliceClient.AddWatchReactor("*", func(kubetesting.Action) (bool, watch.Interface, error) {
+		return true, watch.NewFake(), nil
+	})
+
+	c, err := NewTLBController(&TLBControllerConfig{
+		KubeClient:          kubeClient,
+		EndpointSliceClient: sliceClient,
+		TLBLabelName:        "ke-tlb/owner",
+		Namespace:           "ns",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.sliceClient == nil {
+		t.Fatal("expected endpoint slices to be used")
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c.Run(stopCh)
+	waitForTLBSync(t, c)
+
+	// the slices of the service are aggregated by its service name label
+	for _, podAddr := range []string{"10.0.0.1:20880", "10.0.0.2:20880"} {
+		if addr, err := c.ConvertAddr(podAddr); addr != "192.168.0.100:30000" {
+			t.Errorf("expected %s converted to 192.168.0.100:30000, got %q, %v", podAddr, addr, err)
+		}
+	}
+	if _, err := c.ConvertAddr("10.0.0.3:20880"); err != ErrNotReady {
+		t.Errorf("expected the terminating endpoint not ready, got %v", err)
+	}
+}
+
+func TestTLBControllerEndpointsFallback(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(newTestTLBService(), &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "svc"},
+		Subsets: []v1.EndpointSubset{{
+			Addresses: []v1.EndpointAddress{{IP: "10.0.0.1"}},
+			Ports:     []v1.EndpointPort{{Name: "dubbo", Port: 20880}},
+		}},
+	})
+
+	c, err := NewTLBController(&TLBControllerConfig{
+		KubeClient:   kubeClient,
+		TLBLabelName: "ke-tlb/owner",
+		Namespace:    "ns",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.sliceClient != nil {
+		t.Fatal("expected endpoints to be used")
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c.Run(stopCh)
+	waitForTLBSync(t, c)
+
+	if addr, err := c.ConvertAddr("10.0.0.1:20880"); addr != "192.168.0.100:30000" {
+		t.Errorf("expected 192.168.0.100:30000, got %q, %v", addr, err)
+	}
+}
+
+func waitForTLBSync(t *testing.T, c *TLBController) {
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return c.HasSynced(), nil
+	}); err != nil {
+		t.Fatal("tlb mapper not synced")
+	}
+}
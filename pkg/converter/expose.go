@@ -0,0 +1,196 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+type ServiceExposeControllerConfig struct {
+	KubeConfig *rest.Config
+	// KubeClient is used instead of creating a client from KubeConfig when set
+	KubeClient   kubernetes.Interface
+	ResyncPeriod time.Duration
+	Namespace    string
+	// Converters maps the ExposeKey annotation values to their converters
+	Converters map[string]AddrConverterInterface
+	// Default is the ExposeKey value of services without the annotation
+	Default string
+	// InformerFactory is shared with the Converters when set
+	InformerFactory informers.SharedInformerFactory
+}
+
+// ServiceExposeController picks the converter of a pod address from the
+// ExposeKey annotation of the services selecting the pod.
+type ServiceExposeController struct {
+	config            *ServiceExposeControllerConfig
+	kubeClient        kubernetes.Interface
+	informerFactory   informers.SharedInformerFactory
+	serviceLister     listerv1.ServiceLister
+	serviceSynced     cache.InformerSynced
+	endpointsInformer cache.SharedIndexInformer
+}
+
+func NewServiceExposeController(config *ServiceExposeControllerConfig) (*ServiceExposeController, error) {
+	if _, ok := config.Converters[config.Default]; !ok {
+		return nil, fmt.Errorf("no converter for default expose %q", config.Default)
+	}
+	kubeClient, err := newKubeClient(config.KubeConfig, config.KubeClient)
+	if err != nil {
+		return nil, err
+	}
+
+	informerFactory := config.InformerFactory
+	if informerFactory == nil {
+		informerFactory = informers.NewSharedInformerFactory(kubeClient, config.ResyncPeriod)
+	}
+	serviceInformer := informerFactory.Core().V1().Services()
+	endpointsInformer := informerFactory.Core().V1().Endpoints().Informer()
+	if err := addIndexers(endpointsInformer, cache.Indexers{
+		readyAddrIndex:    endpointsAddrIndexFunc(true),
+		notReadyAddrIndex: endpointsAddrIndexFunc(false),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &ServiceExposeController{
+		config:            config,
+		kubeClient:        kubeClient,
+		informerFactory:   informerFactory,
+		serviceLister:     serviceInformer.Lister(),
+		serviceSynced:     serviceInformer.Informer().HasSynced,
+		endpointsInformer: endpointsInformer,
+	}, nil
+}
+
+func (c *ServiceExposeController) SetChangeHandler(handler func()) {
+	converters := make([]AddrConverterInterface, 0, len(c.config.Converters))
+	for _, converter := range c.config.Converters {
+		converters = append(converters, converter)
+	}
+	setChangeHandler(converters, handler)
+}
+
+func (c *ServiceExposeController) Run(stopCh <-chan struct{}) {
+	c.informerFactory.Start(stopCh)
+	for _, converter := range c.config.Converters {
+		go converter.Run(stopCh)
+	}
+}
+
+func (c *ServiceExposeController) HasSynced() bool {
+	if !c.serviceSynced() || !c.endpointsInformer.HasSynced() {
+		return false
+	}
+	for _, converter := range c.config.Converters {
+		if !HasSynced(converter) {
+			return false
+		}
+	}
+	return true
+}
+
+// servicesOfAddr returns the services selecting podAddr, sorted by
+// namespace/name so the choice among them is stable.
+func (c *ServiceExposeController) servicesOfAddr(podAddr string) ([]*v1.Service, error) {
+	endpoints := make([]*v1.Endpoints, 0)
+	for _, index := range []string{readyAddrIndex, notReadyAddrIndex} {
+		objs, err := c.endpointsInformer.GetIndexer().ByIndex(index, podAddr)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			ep, ok := obj.(*v1.Endpoints)
+			if !ok || (c.config.Namespace != "" && ep.Namespace != c.config.Namespace) {
+				continue
+			}
+			endpoints = append(endpoints, ep)
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Namespace != endpoints[j].Namespace {
+			return endpoints[i].Namespace < endpoints[j].Namespace
+		}
+		return endpoints[i].Name < endpoints[j].Name
+	})
+
+	services := make([]*v1.Service, 0, len(endpoints))
+	for _, ep := range endpoints {
+		svc, err := c.serviceLister.Services(ep.Namespace).Get(ep.Name)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, svc)
+	}
+	return services, nil
+}
+
+// exposeOfAddr returns the ExposeKey annotation of the first service
+// selecting podAddr that has one.
+func (c *ServiceExposeController) exposeOfAddr(podAddr string) (string, error) {
+	services, err := c.servicesOfAddr(podAddr)
+	if err != nil {
+		return "", err
+	}
+	for _, svc := range services {
+		if expose, ok := svc.Annotations[ExposeKey]; ok {
+			return expose, nil
+		}
+	}
+	return c.config.Default, nil
+}
+
+// ServiceOfAddr returns the first service selecting podAddr, and falls back
+// to the converters locating services for the addrs missing from the
+// endpoints.
+func (c *ServiceExposeController) ServiceOfAddr(podAddr string) (*v1.Service, bool) {
+	services, err := c.servicesOfAddr(podAddr)
+	if err == nil && len(services) > 0 {
+		return services[0], true
+	}
+	exposes := make([]string, 0, len(c.config.Converters))
+	for expose := range c.config.Converters {
+		exposes = append(exposes, expose)
+	}
+	sort.Strings(exposes)
+	for _, expose := range exposes {
+		if locator, ok := c.config.Converters[expose].(ServiceLocator); ok {
+			if svc, ok := locator.ServiceOfAddr(podAddr); ok {
+				return svc, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (c *ServiceExposeController) ConvertAddr(podAddr string) (string, error) {
+	expose, err := c.exposeOfAddr(podAddr)
+	if err != nil {
+		glog.Errorf("get expose of %s error, err: %v", podAddr, err)
+		return "", err
+	}
+	return c.ConvertAddrAs(podAddr, expose)
+}
+
+// ConvertAddrAs converts podAddr by the converter of expose, whatever the
+// annotations of its services.
+func (c *ServiceExposeController) ConvertAddrAs(podAddr string, expose string) (string, error) {
+	converter, ok := c.config.Converters[expose]
+	if !ok {
+		glog.Errorf("unsupported expose %q of %s", expose, podAddr)
+		return "", fmt.Errorf("unsupported expose %q", expose)
+	}
+	return converter.ConvertAddr(podAddr)
+}
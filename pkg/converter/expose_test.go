@@ -0,0 +1,129 @@
+package converter
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+
+	dxtesting "github.com/whypro/dxinkube/pkg/testing"
+)
+
+func newTestEndpoints(namespace, name string, port int32, ips ...string) *v1.Endpoints {
+	addrs := make([]v1.EndpointAddress, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, v1.EndpointAddress{IP: ip})
+	}
+	return &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Subsets: []v1.EndpointSubset{{
+			Addresses: addrs,
+			Ports:     []v1.EndpointPort{{Port: port}},
+		}},
+	}
+}
+
+func TestServiceExposeSharedInformers(t *testing.T) {
+	// neither service carries the tlb label, their annotation selects them
+	nodePortService := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "np",
+			Annotations: map[string]string{ExposeKey: ExposeNodePort},
+		},
+		Spec: v1.ServiceSpec{
+			Type:  v1.ServiceTypeNodePort,
+			Ports: []v1.ServicePort{{Port: 20880, NodePort: 30880}},
+		},
+	}
+	tlbService := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "lb",
+			Annotations: map[string]string{ExposeKey: ExposeLoadBalancer},
+		},
+		Spec: v1.ServiceSpec{
+			Type:  v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{{Port: 20880}},
+		},
+		Status: v1.ServiceStatus{LoadBalancer: v1.LoadBalancerStatus{
+			Ingress: []v1.LoadBalancerIngress{{IP: "192.168.0.100"}},
+		}},
+	}
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node"},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+			Addresses:  []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "192.168.1.1"}},
+		},
+	}
+	kubeClient := dxtesting.NewFakeKubeClient(
+		nodePortService, newTestEndpoints("default", "np", 20880, "10.0.0.1"),
+		tlbService, newTestEndpoints("default", "lb", 20880, "10.0.0.2"),
+		node,
+	)
+
+	informerFactory := informers.NewSharedInformerFactory(kubeClient, 0)
+	tlbController, err := NewTLBController(&TLBControllerConfig{
+		KubeClient:      kubeClient,
+		TLBLabelName:    "ke-tlb/owner",
+		InformerFactory: informerFactory,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodePortController, err := NewNodePortController(&NodePortControllerConfig{
+		KubeClient:       kubeClient,
+		ServiceLabelName: "ke-tlb/owner",
+		InformerFactory:  informerFactory,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	directController, err := NewDirectController(&DirectControllerConfig{
+		KubeClient:      kubeClient,
+		InformerFactory: informerFactory,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewServiceExposeController(&ServiceExposeControllerConfig{
+		KubeClient: kubeClient,
+		Converters: map[string]AddrConverterInterface{
+			ExposeLoadBalancer: tlbController,
+			ExposeNodePort:     nodePortController,
+			ExposeDirect:       directController,
+		},
+		Default:         ExposeDirect,
+		InformerFactory: informerFactory,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, c.HasSynced) {
+		t.Fatal("caches not synced")
+	}
+
+	expected := map[string]string{
+		"10.0.0.1:20880": "192.168.1.1:30880",
+		"10.0.0.2:20880": "192.168.0.100:20880",
+	}
+	for podAddr, addr := range expected {
+		var converted string
+		err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+			converted, _ = c.ConvertAddr(podAddr)
+			return converted == addr, nil
+		})
+		if err != nil {
+			t.Errorf("expected %s converted to %s, got %q", podAddr, addr, converted)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package converter
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	informersv1 "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+type HostPortControllerConfig struct {
+	KubeConfig *rest.Config
+	// KubeClient is used instead of creating a client from KubeConfig when set
+	KubeClient   kubernetes.Interface
+	ResyncPeriod time.Duration
+	Namespace    string
+	// AllPods converts the pods with host ports whether they are marked with
+	// dxinkube/expose=hostport or not, for services selecting the converter
+	AllPods bool
+	// InformerFactory is shared with the other converters when set
+	InformerFactory informers.SharedInformerFactory
+}
+
+// HostPortController maps the addresses of pods labelled or annotated with
+// dxinkube/expose=hostport to hostIP:hostPort. Pods on the host network are
+// reachable on their own address. No service is involved.
+type HostPortController struct {
+	changeNotifier
+
+	config      *HostPortControllerConfig
+	kubeClient  kubernetes.Interface
+	podInformer cache.SharedIndexInformer
+}
+
+func NewHostPortController(config *HostPortControllerConfig) (*HostPortController, error) {
+	kubeClient, err := newKubeClient(config.KubeConfig, config.KubeClient)
+	if err != nil {
+		return nil, err
+	}
+
+	indexers := cache.Indexers{PodIPIndex: PodIPIndexFunc}
+	var podInformer cache.SharedIndexInformer
+	if config.InformerFactory != nil {
+		podInformer = config.InformerFactory.Core().V1().Pods().Informer()
+		if err := addIndexers(podInformer, indexers); err != nil {
+			return nil, err
+		}
+	} else {
+		podInformer = informersv1.NewPodInformer(kubeClient, config.Namespace, config.ResyncPeriod, indexers)
+	}
+
+	c := &HostPortController{
+		config:      config,
+		kubeClient:  kubeClient,
+		podInformer: podInformer,
+	}
+	podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: c.onPodUpdate,
+		DeleteFunc: func(obj interface{}) { c.notifyChange() },
+	})
+	return c, nil
+}
+
+// onPodUpdate notifies when a pod stops being ready, terminating included.
+func (c *HostPortController) onPodUpdate(oldObj, newObj interface{}) {
+	oldPod, ok := oldObj.(*v1.Pod)
+	if !ok {
+		return
+	}
+	newPod, ok := newObj.(*v1.Pod)
+	if !ok {
+		return
+	}
+	if isPodReady(oldPod) && !isPodReady(newPod) {
+		c.notifyChange()
+	}
+}
+
+func (c *HostPortController) Run(stopCh <-chan struct{}) {
+	if c.config.InformerFactory != nil {
+		c.config.InformerFactory.Start(stopCh)
+		return
+	}
+	go c.podInformer.Run(stopCh)
+}
+
+func (c *HostPortController) HasSynced() bool {
+	return c.podInformer.HasSynced()
+}
+
+func (c *HostPortController) ConvertAddr(podAddr string) (string, error) {
+	ip, portStr, err := net.SplitHostPort(podAddr)
+	if err != nil {
+		return "", err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", err
+	}
+
+	objs, err := c.podInformer.GetIndexer().ByIndex(PodIPIndex, ip)
+	if err != nil {
+		return "", err
+	}
+	// host network pods on the same node share their ip, the port tells them apart
+	for _, obj := range objs {
+		pod, ok := obj.(*v1.Pod)
+		if !ok || (c.config.Namespace != "" && pod.Namespace != c.config.Namespace) {
+			continue
+		}
+		if !c.config.AllPods && exposeOf(pod.Labels, pod.Annotations) != ExposeHostPort {
+			continue
+		}
+		hostPort, ok := findHostPort(pod, int32(port))
+		if !ok {
+			continue
+		}
+		if !isPodReady(pod) {
+			glog.V(4).Infof("pod %s/%s of %s is not ready", pod.Namespace, pod.Name, podAddr)
+			return "", ErrNotReady
+		}
+		return fmt.Sprintf("%s:%d", pod.Status.HostIP, hostPort), nil
+	}
+	return "", ErrNotManaged
+}
+
+// findHostPort returns the host port serving containerPort of pod. Host
+// network pods serve their declared ports as they are, any port when they
+// declare none.
+func findHostPort(pod *v1.Pod, containerPort int32) (int32, bool) {
+	declared := false
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			declared = true
+			if port.ContainerPort != containerPort {
+				continue
+			}
+			if pod.Spec.HostNetwork {
+				return containerPort, true
+			}
+			if port.HostPort != 0 {
+				return port.HostPort, true
+			}
+		}
+	}
+	if pod.Spec.HostNetwork && !declared {
+		return containerPort, true
+	}
+	return 0, false
+}
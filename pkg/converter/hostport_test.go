@@ -0,0 +1,131 @@
+package converter
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// staticConverter converts the addrs it maps, the others are not managed.
+type staticConverter map[string]string
+
+func (c staticConverter) ConvertAddr(podAddr string) (string, error) {
+	if addr, ok := c[podAddr]; ok {
+		return addr, nil
+	}
+	return "", ErrNotManaged
+}
+
+func (c staticConverter) Run(stopCh <-chan struct{}) {}
+
+func newHostPortTestPod(namespace, name, podIP string, expose bool, ready bool, ports ...v1.ContainerPort) *v1.Pod {
+	pod := newResolveTestPod(name, v1.PodRunning, ready)
+	pod.Namespace = namespace
+	pod.Status.PodIP = podIP
+	pod.Status.HostIP = "192.168.1.11"
+	pod.Spec.Containers = []v1.Container{{Name: "dubbo", Ports: ports}}
+	if expose {
+		pod.Labels[ExposeKey] = ExposeHostPort
+	}
+	return pod
+}
+
+func newHostNetworkTestPod(name string, ports ...v1.ContainerPort) *v1.Pod {
+	pod := newHostPortTestPod("a", name, "192.168.1.10", true, true, ports...)
+	pod.Spec.HostNetwork = true
+	pod.Status.HostIP = "192.168.1.10"
+	return pod
+}
+
+func TestHostPortConvertAddr(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(
+		newHostNetworkTestPod("hostnet-1", v1.ContainerPort{ContainerPort: 20880}),
+		newHostNetworkTestPod("hostnet-2", v1.ContainerPort{ContainerPort: 20881}),
+		newHostPortTestPod("a", "mapped", "10.0.0.1", true, true, v1.ContainerPort{ContainerPort: 20880, HostPort: 30880}),
+		newHostPortTestPod("a", "unready", "10.0.0.2", true, false, v1.ContainerPort{ContainerPort: 20880, HostPort: 30881}),
+		newHostPortTestPod("a", "unmarked", "10.0.0.3", false, true, v1.ContainerPort{ContainerPort: 20880, HostPort: 30882}),
+		newHostPortTestPod("b", "other", "10.0.0.4", true, true, v1.ContainerPort{ContainerPort: 20880, HostPort: 30883}),
+	)
+	tests := []struct {
+		name     string
+		allPods  bool
+		podAddr  string
+		expected string
+		err      error
+	}{
+		{name: "host network", podAddr: "192.168.1.10:20880", expected: "192.168.1.10:20880"},
+		{name: "host network told apart by port", podAddr: "192.168.1.10:20881", expected: "192.168.1.10:20881"},
+		{name: "host network undeclared port", podAddr: "192.168.1.10:20882", err: ErrNotManaged},
+		{name: "host port", podAddr: "10.0.0.1:20880", expected: "192.168.1.11:30880"},
+		{name: "no host port", podAddr: "10.0.0.1:20881", err: ErrNotManaged},
+		{name: "not ready", podAddr: "10.0.0.2:20880", err: ErrNotReady},
+		{name: "unmarked", podAddr: "10.0.0.3:20880", err: ErrNotManaged},
+		{name: "unmarked all pods", allPods: true, podAddr: "10.0.0.3:20880", expected: "192.168.1.11:30882"},
+		{name: "other namespace", podAddr: "10.0.0.4:20880", err: ErrNotManaged},
+		{name: "unknown", podAddr: "10.0.0.9:20880", err: ErrNotManaged},
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	for _, test := range tests {
+		c, err := NewHostPortController(&HostPortControllerConfig{KubeClient: kubeClient, Namespace: "a", AllPods: test.allPods})
+		if err != nil {
+			t.Fatalf("new hostport controller error, err: %v", err)
+		}
+		c.Run(stopCh)
+		if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+			return c.HasSynced(), nil
+		}); err != nil {
+			t.Fatal("hostport caches not synced")
+		}
+		addr, err := c.ConvertAddr(test.podAddr)
+		if addr != test.expected || err != test.err {
+			t.Errorf("%s: expected %q, %v, got %q, %v", test.name, test.expected, test.err, addr, err)
+		}
+	}
+}
+
+func TestChainFallThrough(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(
+		newHostPortTestPod("a", "mapped", "10.0.0.1", true, true, v1.ContainerPort{ContainerPort: 20880, HostPort: 30880}),
+		newHostPortTestPod("a", "unready", "10.0.0.2", true, false, v1.ContainerPort{ContainerPort: 20880, HostPort: 30881}),
+	)
+	hostPort, err := NewHostPortController(&HostPortControllerConfig{KubeClient: kubeClient})
+	if err != nil {
+		t.Fatalf("new hostport controller error, err: %v", err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	hostPort.Run(stopCh)
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return hostPort.HasSynced(), nil
+	}); err != nil {
+		t.Fatal("hostport caches not synced")
+	}
+	chain := NewChain(hostPort, staticConverter{
+		"10.0.0.1:20880": "1.1.1.1:20880",
+		"10.0.0.2:20880": "1.1.1.2:20880",
+		"10.0.0.3:20880": "1.1.1.3:20880",
+	})
+
+	tests := []struct {
+		podAddr  string
+		expected string
+		err      error
+	}{
+		// the first converter managing the addr wins
+		{podAddr: "10.0.0.1:20880", expected: "192.168.1.11:30880"},
+		// not ready is not passed on
+		{podAddr: "10.0.0.2:20880", err: ErrNotReady},
+		{podAddr: "10.0.0.3:20880", expected: "1.1.1.3:20880"},
+		{podAddr: "10.0.0.9:20880", err: ErrNotManaged},
+	}
+	for _, test := range tests {
+		addr, err := chain.ConvertAddr(test.podAddr)
+		if addr != test.expected || err != test.err {
+			t.Errorf("%s: expected %q, %v, got %q, %v", test.podAddr, test.expected, test.err, addr, err)
+		}
+	}
+}
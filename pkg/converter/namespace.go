@@ -0,0 +1,144 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	informersv1 "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// namespaceInformers holds the informers of one watched namespace, or of
+// every namespace under metav1.NamespaceAll.
+type namespaceInformers struct {
+	serviceInformer cache.SharedIndexInformer
+	serviceLister   listersv1.ServiceLister
+	endpoints       endpointsSource
+	// podInformer indexes the pods by ip
+	podInformer cache.SharedIndexInformer
+	stopCh      chan struct{}
+
+	// factory started the shared informers, the endpoints are shared unless
+	// read from EndpointSlices
+	factory         informers.SharedInformerFactory
+	endpointsShared bool
+}
+
+func newNamespaceInformers(kubeClient kubernetes.Interface, sliceClient dynamic.Interface, namespace string, resyncPeriod time.Duration) *namespaceInformers {
+	serviceInformer := informersv1.NewServiceInformer(kubeClient, namespace, resyncPeriod, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+	return &namespaceInformers{
+		serviceInformer: serviceInformer,
+		serviceLister:   listersv1.NewServiceLister(serviceInformer.GetIndexer()),
+		endpoints:       newEndpointsSource(kubeClient, sliceClient, namespace, resyncPeriod),
+		podInformer: informersv1.NewPodInformer(kubeClient, namespace, resyncPeriod, cache.Indexers{
+			PodIPIndex: PodIPIndexFunc,
+		}),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// newSharedNamespaceInformers returns the informers of every namespace from
+// factory.
+func newSharedNamespaceInformers(factory informers.SharedInformerFactory, sliceClient dynamic.Interface, resyncPeriod time.Duration) (*namespaceInformers, error) {
+	serviceInformer := factory.Core().V1().Services()
+	i := &namespaceInformers{
+		serviceInformer: serviceInformer.Informer(),
+		serviceLister:   serviceInformer.Lister(),
+		stopCh:          make(chan struct{}),
+		factory:         factory,
+	}
+	if sliceClient == nil {
+		endpointsInformer := factory.Core().V1().Endpoints()
+		i.endpoints = &coreEndpointsSource{
+			informer: endpointsInformer.Informer(),
+			lister:   endpointsInformer.Lister(),
+		}
+		i.endpointsShared = true
+	} else {
+		i.endpoints = newEndpointSliceSource(sliceClient, metav1.NamespaceAll, resyncPeriod)
+	}
+	i.podInformer = factory.Core().V1().Pods().Informer()
+	if err := addIndexers(i.podInformer, cache.Indexers{PodIPIndex: PodIPIndexFunc}); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+func (i *namespaceInformers) Run() {
+	if i.factory != nil {
+		i.factory.Start(i.stopCh)
+	} else {
+		go i.serviceInformer.Run(i.stopCh)
+		go i.podInformer.Run(i.stopCh)
+	}
+	if !i.endpointsShared {
+		go i.endpoints.Run(i.stopCh)
+	}
+}
+
+func (i *namespaceInformers) HasSynced() bool {
+	return i.serviceInformer.HasSynced() && i.podInformer.HasSynced() && i.endpoints.HasSynced()
+}
+
+func (i *namespaceInformers) Stop() {
+	close(i.stopCh)
+}
+
+// namespacesOf returns the namespaces watched alone, namespace is kept for
+// compatibility and merged into namespaces. It is an error to give both
+// namespaces and a namespace selector, with neither every namespace is
+// watched.
+func namespacesOf(namespace string, namespaces []string, namespaceSelector string) ([]string, labels.Selector, error) {
+	names := make([]string, 0, len(namespaces)+1)
+	seen := make(map[string]bool)
+	for _, ns := range append([]string{namespace}, namespaces...) {
+		if ns == "" || seen[ns] {
+			continue
+		}
+		seen[ns] = true
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+	if namespaceSelector == "" {
+		return names, nil, nil
+	}
+	if len(names) > 0 {
+		return nil, nil, fmt.Errorf("namespaces and namespace selector are exclusive")
+	}
+	selector, err := labels.Parse(namespaceSelector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid namespace selector %q, %v", namespaceSelector, err)
+	}
+	return names, selector, nil
+}
+
+// newNamespaceInformer returns an informer of the namespaces matching selector.
+func newNamespaceInformer(kubeClient kubernetes.Interface, selector labels.Selector, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				options.LabelSelector = selector.String()
+				return kubeClient.CoreV1().Namespaces().List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.LabelSelector = selector.String()
+				return kubeClient.CoreV1().Namespaces().Watch(options)
+			},
+		},
+		&v1.Namespace{},
+		resyncPeriod,
+		cache.Indexers{},
+	)
+}
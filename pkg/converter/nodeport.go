@@ -0,0 +1,339 @@
+package converter
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+type NodePortControllerConfig struct {
+	KubeConfig *rest.Config
+	// KubeClient is used instead of creating a client from KubeConfig when set
+	KubeClient kubernetes.Interface
+	// ServiceLabelName selects the services bridged through their node ports
+	// by the label existing, unless TLBSelector is set
+	ServiceLabelName string
+	// TLBSelector selects the services bridged through their node ports, the
+	// tlb services
+	TLBSelector  *TLBSelector
+	ResyncPeriod time.Duration
+	Namespace    string
+	// NodeAddressType is the node address published, InternalIP by default
+	NodeAddressType v1.NodeAddressType
+	// NodeSelector restricts the nodes published, all nodes when empty
+	NodeSelector string
+	// InformerFactory is shared with the other converters when set
+	InformerFactory informers.SharedInformerFactory
+}
+
+// NodePortController maps pod addresses to nodeIP:nodePort of the NodePort
+// service selecting them. Pods are spread over the ready nodes by a hash of
+// their address, so a pod keeps its node as long as the node set is stable.
+// The nodes of services with the Local external traffic policy are those
+// hosting a ready endpoint, the others drop the traffic.
+type NodePortController struct {
+	changeNotifier
+
+	config       *NodePortControllerConfig
+	kubeClient   kubernetes.Interface
+	nodeSelector labels.Selector
+
+	mapper   map[string]string
+	notReady sets.String
+	// noNode are the addrs mapped to no node, no ready node hosting their
+	// service endpoints
+	noNode sets.String
+	// mapperSynced is set once the mapper is built from synced caches
+	mapperSynced bool
+	lock         sync.RWMutex
+	queue        chan struct{}
+
+	informerFactory informers.SharedInformerFactory
+	serviceLister   listersv1.ServiceLister
+	endpointsLister listersv1.EndpointsLister
+	nodeLister      listersv1.NodeLister
+	informersSynced []cache.InformerSynced
+}
+
+func NewNodePortController(config *NodePortControllerConfig) (*NodePortController, error) {
+	switch config.NodeAddressType {
+	case "":
+		config.NodeAddressType = v1.NodeInternalIP
+	case v1.NodeInternalIP, v1.NodeExternalIP:
+	default:
+		return nil, fmt.Errorf("unsupported node address type %q", config.NodeAddressType)
+	}
+	nodeSelector, err := labels.Parse(config.NodeSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid node selector %q, %v", config.NodeSelector, err)
+	}
+
+	kubeClient, err := newKubeClient(config.KubeConfig, config.KubeClient)
+	if err != nil {
+		return nil, err
+	}
+
+	informerFactory := config.InformerFactory
+	if informerFactory == nil {
+		informerFactory = informers.NewSharedInformerFactory(kubeClient, config.ResyncPeriod)
+	}
+	serviceInformer := informerFactory.Core().V1().Services()
+	endpointsInformer := informerFactory.Core().V1().Endpoints()
+	nodeInformer := informerFactory.Core().V1().Nodes()
+
+	c := &NodePortController{
+		config:       config,
+		kubeClient:   kubeClient,
+		nodeSelector: nodeSelector,
+
+		mapper:   make(map[string]string),
+		notReady: sets.NewString(),
+		noNode:   sets.NewString(),
+		queue:    make(chan struct{}, 1),
+
+		informerFactory: informerFactory,
+		serviceLister:   serviceInformer.Lister(),
+		endpointsLister: endpointsInformer.Lister(),
+		nodeLister:      nodeInformer.Lister(),
+		informersSynced: []cache.InformerSynced{
+			serviceInformer.Informer().HasSynced,
+			endpointsInformer.Informer().HasSynced,
+			nodeInformer.Informer().HasSynced,
+		},
+	}
+
+	// any change may move pods between nodes, the whole mapper is rebuilt
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueue() },
+		UpdateFunc: func(oldObj, newObj interface{}) { c.enqueue() },
+		DeleteFunc: func(obj interface{}) { c.enqueue() },
+	}
+	serviceInformer.Informer().AddEventHandler(handler)
+	endpointsInformer.Informer().AddEventHandler(handler)
+	nodeInformer.Informer().AddEventHandler(handler)
+
+	return c, nil
+}
+
+func (c *NodePortController) enqueue() {
+	select {
+	case c.queue <- struct{}{}:
+	default:
+	}
+}
+
+func (c *NodePortController) Run(stopCh <-chan struct{}) {
+	c.informerFactory.Start(stopCh)
+	// a mapper built from partial caches would withdraw the pods not listed yet
+	if !cache.WaitForCacheSync(stopCh, c.informersSynced...) {
+		glog.Errorf("wait for nodeport caches to sync error")
+		return
+	}
+	go func() {
+		for {
+			select {
+			case <-c.queue:
+				c.Refresh()
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	go wait.Until(c.Refresh, 10*time.Second, stopCh)
+}
+
+func (c *NodePortController) HasSynced() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.mapperSynced
+}
+
+func isNodeReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// nodeAddrs returns the addresses of the ready nodes matching the node
+// selector, by node name.
+func (c *NodePortController) nodeAddrs() (map[string]string, error) {
+	nodes, err := c.nodeLister.List(c.nodeSelector)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make(map[string]string)
+	for _, node := range nodes {
+		if !isNodeReady(node) {
+			continue
+		}
+		for _, addr := range node.Status.Addresses {
+			if addr.Type == c.config.NodeAddressType {
+				addrs[node.Name] = addr.Address
+				break
+			}
+		}
+	}
+	return addrs, nil
+}
+
+// serviceNodeAddrs returns the addresses of the nodes svc is reached
+// through, sorted. With the Local external traffic policy they are those
+// hosting a ready endpoint of ep.
+func serviceNodeAddrs(svc *v1.Service, ep *v1.Endpoints, nodeAddrs map[string]string) []string {
+	addrs := sets.NewString()
+	if svc.Spec.ExternalTrafficPolicy != v1.ServiceExternalTrafficPolicyTypeLocal {
+		for _, addr := range nodeAddrs {
+			addrs.Insert(addr)
+		}
+		return addrs.List()
+	}
+	for _, subset := range ep.Subsets {
+		for _, addr := range subset.Addresses {
+			if addr.NodeName == nil {
+				continue
+			}
+			if nodeAddr, ok := nodeAddrs[*addr.NodeName]; ok {
+				addrs.Insert(nodeAddr)
+			}
+		}
+	}
+	return addrs.List()
+}
+
+// pickNodeAddr picks the node of podAddr by rendezvous hashing, the node
+// with the highest weight wins, so a node joining or leaving only moves the
+// pod addrs it wins or won.
+func pickNodeAddr(nodeAddrs []string, podAddr string) string {
+	picked := ""
+	var pickedWeight uint64
+	for _, nodeAddr := range nodeAddrs {
+		h := fnv.New64a()
+		h.Write([]byte(nodeAddr))
+		h.Write([]byte{0})
+		h.Write([]byte(podAddr))
+		weight := h.Sum64()
+		if picked == "" || weight > pickedWeight || (weight == pickedWeight && nodeAddr < picked) {
+			picked = nodeAddr
+			pickedWeight = weight
+		}
+	}
+	return picked
+}
+
+func (c *NodePortController) Refresh() {
+	nodeAddrs, err := c.nodeAddrs()
+	if err != nil {
+		glog.Errorf("list nodes error, err: %v", err)
+		return
+	}
+	if len(nodeAddrs) == 0 {
+		glog.Warningf("no ready node with %s address", c.config.NodeAddressType)
+	}
+
+	services, err := c.serviceLister.Services(c.config.Namespace).List(labels.Everything())
+	if err != nil {
+		glog.Errorf("list services error, err: %v", err)
+		return
+	}
+
+	mapper := make(map[string]string)
+	notReady := sets.NewString()
+	noNode := sets.NewString()
+	for _, svc := range services {
+		if !c.isNodePortService(svc) {
+			continue
+		}
+		if svc.Spec.Type != v1.ServiceTypeNodePort && svc.Spec.Type != v1.ServiceTypeLoadBalancer {
+			glog.V(7).Infof("skip service without node ports, ns: %s, name: %s", svc.Namespace, svc.Name)
+			continue
+		}
+		ep, err := c.endpointsLister.Endpoints(svc.Namespace).Get(svc.Name)
+		if err != nil {
+			glog.V(4).Infof("get endpoints of service error, ns: %s, name: %s, err: %v", svc.Namespace, svc.Name, err)
+			continue
+		}
+		notReady.Insert(getNotReadyPodAddrsFromEndpoints(ep).List()...)
+		svcNodeAddrs := serviceNodeAddrs(svc, ep, nodeAddrs)
+		for _, subset := range ep.Subsets {
+			for _, epPort := range subset.Ports {
+				svcPort, ok := findServicePort(svc, epPort)
+				if !ok || svcPort.NodePort == 0 {
+					continue
+				}
+				for _, addr := range subset.Addresses {
+					podAddr := fmt.Sprintf("%s:%d", addr.IP, epPort.Port)
+					if len(svcNodeAddrs) == 0 {
+						noNode.Insert(podAddr)
+						continue
+					}
+					mapper[podAddr] = fmt.Sprintf("%s:%d", pickNodeAddr(svcNodeAddrs, podAddr), svcPort.NodePort)
+				}
+			}
+		}
+	}
+
+	glog.V(4).Infof("refresh nodeport mapper, %d addrs", len(mapper))
+	c.lock.Lock()
+	withdrawn := false
+	for podAddr := range c.mapper {
+		if _, ok := mapper[podAddr]; !ok {
+			withdrawn = true
+			break
+		}
+	}
+	c.mapper = mapper
+	c.notReady = notReady.Difference(sets.StringKeySet(mapper))
+	c.noNode = noNode.Difference(sets.StringKeySet(mapper))
+	c.mapperSynced = true
+	c.lock.Unlock()
+
+	if withdrawn {
+		c.notifyChange()
+	}
+}
+
+// isNodePortService tells whether svc is bridged through its node ports, by
+// its labels or its dxinkube/expose annotation.
+func (c *NodePortController) isNodePortService(svc *v1.Service) bool {
+	if c.config.TLBSelector != nil {
+		if c.config.TLBSelector.Matches(svc) {
+			return true
+		}
+	} else if _, ok := svc.Labels[c.config.ServiceLabelName]; ok {
+		return true
+	}
+	return svc.Annotations[ExposeKey] == ExposeNodePort
+}
+
+func (c *NodePortController) ConvertAddr(podAddr string) (string, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	addr, ok := c.mapper[podAddr]
+	if !ok && c.notReady.Has(podAddr) {
+		glog.V(4).Infof("podIP %s is not ready", podAddr)
+		return "", ErrNotReady
+	}
+	if !ok && c.noNode.Has(podAddr) {
+		return "", &ConvertError{Reason: ReasonNoReadyNode, Addr: podAddr, Message: "no ready node hosts an endpoint of its nodeport service"}
+	}
+	if !ok {
+		glog.Errorf("podIP %s is not in nodeport mapper", podAddr)
+		return "", &ConvertError{Reason: ReasonNotInMapper, Addr: podAddr, Message: "no nodeport service endpoint has the addr"}
+	}
+	return addr, nil
+}
@@ -0,0 +1,153 @@
+package converter
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestPickNodeAddr(t *testing.T) {
+	nodeAddrs := []string{"192.168.0.1", "192.168.0.2", "192.168.0.3", "192.168.0.4"}
+	podAddrs := make([]string, 0, 200)
+	for i := 0; i < 200; i++ {
+		podAddrs = append(podAddrs, fmt.Sprintf("10.0.%d.%d:20880", i/250, i%250))
+	}
+	picked := make(map[string]string)
+	counts := make(map[string]int)
+	for _, podAddr := range podAddrs {
+		picked[podAddr] = pickNodeAddr(nodeAddrs, podAddr)
+		counts[picked[podAddr]]++
+	}
+	for _, nodeAddr := range nodeAddrs {
+		if counts[nodeAddr] == 0 {
+			t.Errorf("expected pod addrs on node %s", nodeAddr)
+		}
+	}
+
+	// the order of the nodes does not matter
+	reversed := []string{"192.168.0.4", "192.168.0.3", "192.168.0.2", "192.168.0.1"}
+	for _, podAddr := range podAddrs {
+		if nodeAddr := pickNodeAddr(reversed, podAddr); nodeAddr != picked[podAddr] {
+			t.Errorf("expected %s on %s whatever the order, got %s", podAddr, picked[podAddr], nodeAddr)
+		}
+	}
+
+	// a node leaving only moves its own pod addrs
+	left := []string{"192.168.0.1", "192.168.0.2", "192.168.0.4"}
+	for _, podAddr := range podAddrs {
+		nodeAddr := pickNodeAddr(left, podAddr)
+		if picked[podAddr] != "192.168.0.3" && nodeAddr != picked[podAddr] {
+			t.Errorf("expected %s to stay on %s, got %s", podAddr, picked[podAddr], nodeAddr)
+		}
+	}
+
+	// a node joining only takes pod addrs
+	joined := append([]string{"192.168.0.5"}, nodeAddrs...)
+	for _, podAddr := range podAddrs {
+		nodeAddr := pickNodeAddr(joined, podAddr)
+		if nodeAddr != "192.168.0.5" && nodeAddr != picked[podAddr] {
+			t.Errorf("expected %s to stay on %s, got %s", podAddr, picked[podAddr], nodeAddr)
+		}
+	}
+}
+
+func TestIsNodePortService(t *testing.T) {
+	selector, err := NewTLBSelector("ke-tlb/owner", "tlb=true", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		selector    *TLBSelector
+		labels      map[string]string
+		annotations map[string]string
+		expected    bool
+	}{
+		{name: "label", labels: map[string]string{"ke-tlb/owner": "x"}, expected: true},
+		{name: "annotation", annotations: map[string]string{ExposeKey: ExposeNodePort}, expected: true},
+		{name: "unselected", labels: map[string]string{"app": "x"}, expected: false},
+		{name: "selector", selector: selector, labels: map[string]string{"tlb": "true"}, expected: true},
+		{name: "selector overrides label", selector: selector, labels: map[string]string{"ke-tlb/owner": "x"}, expected: false},
+		{name: "selector and annotation", selector: selector, annotations: map[string]string{ExposeKey: ExposeNodePort}, expected: true},
+	}
+	for _, test := range tests {
+		c := &NodePortController{config: &NodePortControllerConfig{ServiceLabelName: "ke-tlb/owner", TLBSelector: test.selector}}
+		svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Labels: test.labels, Annotations: test.annotations}}
+		if got := c.isNodePortService(svc); got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+}
+
+func newNodePortTestNode(name string, addr string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+			Addresses:  []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: addr}},
+		},
+	}
+}
+
+func TestNodePortConvertAddr(t *testing.T) {
+	nodeName := "node-2"
+	goneNode := "node-gone"
+	newService := func(name string, policy v1.ServiceExternalTrafficPolicyType) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "ns",
+				Name:        name,
+				Annotations: map[string]string{ExposeKey: ExposeNodePort},
+			},
+			Spec: v1.ServiceSpec{
+				Type:                  v1.ServiceTypeNodePort,
+				ExternalTrafficPolicy: policy,
+				Ports:                 []v1.ServicePort{{Name: "dubbo", Port: 20880, NodePort: 30880}},
+			},
+		}
+	}
+	newEndpoints := func(name string, ip string, node *string) *v1.Endpoints {
+		return &v1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name},
+			Subsets: []v1.EndpointSubset{{
+				Addresses: []v1.EndpointAddress{{IP: ip, NodeName: node}},
+				Ports:     []v1.EndpointPort{{Name: "dubbo", Port: 20880}},
+			}},
+		}
+	}
+	kubeClient := fake.NewSimpleClientset(
+		newNodePortTestNode("node-1", "192.168.0.1"),
+		newNodePortTestNode("node-2", "192.168.0.2"),
+		newNodePortTestNode("node-3", "192.168.0.3"),
+		newService("local", v1.ServiceExternalTrafficPolicyTypeLocal),
+		newEndpoints("local", "10.0.0.1", &nodeName),
+		newService("gone", v1.ServiceExternalTrafficPolicyTypeLocal),
+		newEndpoints("gone", "10.0.0.2", &goneNode),
+	)
+	c, err := NewNodePortController(&NodePortControllerConfig{KubeClient: kubeClient})
+	if err != nil {
+		t.Fatalf("new nodeport controller error, err: %v", err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c.informerFactory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, c.informersSynced...) {
+		t.Fatal("wait for caches to sync error")
+	}
+	c.Refresh()
+
+	// the Local policy publishes the node hosting the endpoint
+	if addr, err := c.ConvertAddr("10.0.0.1:20880"); err != nil || addr != "192.168.0.2:30880" {
+		t.Errorf("expected 192.168.0.2:30880, got %q, err: %v", addr, err)
+	}
+	if _, err := c.ConvertAddr("10.0.0.2:20880"); ReasonOf(err) != ReasonNoReadyNode {
+		t.Errorf("expected the reason %s, got %v", ReasonNoReadyNode, err)
+	}
+	if _, err := c.ConvertAddr("10.0.0.3:20880"); ReasonOf(err) != ReasonNotInMapper {
+		t.Errorf("expected the reason %s, got %v", ReasonNotInMapper, err)
+	}
+}
@@ -0,0 +1,40 @@
+package converter
+
+import (
+	"k8s.io/api/core/v1"
+)
+
+const PodIPIndex = "podIP"
+
+// PodIPIndexFunc indexes pods by status.podIP. Terminated pods are left out,
+// their ip may be given to another pod already.
+func PodIPIndexFunc(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok || pod.Status.PodIP == "" {
+		return []string{}, nil
+	}
+	if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return []string{}, nil
+	}
+	return []string{pod.Status.PodIP}, nil
+}
+
+func isPodReady(pod *v1.Pod) bool {
+	if pod.Status.Phase != v1.PodRunning || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// exposeOf returns the ExposeKey label of obj, or its annotation.
+func exposeOf(labels map[string]string, annotations map[string]string) string {
+	if expose, ok := labels[ExposeKey]; ok {
+		return expose
+	}
+	return annotations[ExposeKey]
+}
@@ -0,0 +1,81 @@
+package converter
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// resolveTimeout bounds a lookup, the mapper is rebuilt while it waits
+const resolveTimeout = 2 * time.Second
+
+type resolvedHost struct {
+	// ips are empty while the host was never resolved
+	ips        []string
+	resolvedAt time.Time
+}
+
+// hostnameResolver resolves load balancer hostnames, caching the result for
+// interval. A failed lookup keeps serving the previous result, and is not
+// tried again before interval either, as lookups block the informer event
+// handlers.
+type hostnameResolver struct {
+	interval time.Duration
+	timeout  time.Duration
+	lookup   func(ctx context.Context, host string) ([]string, error)
+
+	lock  sync.Mutex
+	hosts map[string]*resolvedHost
+}
+
+func newHostnameResolver(interval time.Duration) *hostnameResolver {
+	return &hostnameResolver{
+		interval: interval,
+		timeout:  resolveTimeout,
+		lookup:   net.DefaultResolver.LookupHost,
+		hosts:    make(map[string]*resolvedHost),
+	}
+}
+
+// Resolve returns the lowest ip of host, or "" if it was never resolved.
+func (r *hostnameResolver) Resolve(host string) string {
+	r.lock.Lock()
+	resolved, ok := r.hosts[host]
+	r.lock.Unlock()
+	if ok && time.Since(resolved.resolvedAt) < r.interval {
+		return firstIP(resolved.ips)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	ips, err := r.lookup(ctx, host)
+	if err == nil && len(ips) == 0 {
+		err = &net.DNSError{Err: "no addresses", Name: host}
+	}
+	if err != nil {
+		glog.Warningf("resolve tlb hostname %s error, err: %v", host, err)
+		ips = nil
+		if ok {
+			ips = resolved.ips
+		}
+	} else {
+		sort.Strings(ips)
+		glog.V(4).Infof("resolved tlb hostname %s to %v", host, ips)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.hosts[host] = &resolvedHost{ips: ips, resolvedAt: time.Now()}
+	return firstIP(ips)
+}
+
+func firstIP(ips []string) string {
+	if len(ips) == 0 {
+		return ""
+	}
+	return ips[0]
+}
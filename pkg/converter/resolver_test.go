@@ -0,0 +1,53 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHostnameResolver(t *testing.T) {
+	r := newHostnameResolver(time.Hour)
+	r.timeout = 10 * time.Millisecond
+	results := map[string][]string{"lb.example.com": {"1.1.1.2", "1.1.1.1"}}
+	r.lookup = func(ctx context.Context, host string) ([]string, error) {
+		if ips, ok := results[host]; ok {
+			return ips, nil
+		}
+		// lookups hang until they time out
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	if ip := r.Resolve("lb.example.com"); ip != "1.1.1.1" {
+		t.Errorf("expected 1.1.1.1, got %q", ip)
+	}
+	start := time.Now()
+	if ip := r.Resolve("hang.example.com"); ip != "" {
+		t.Errorf("expected no ip, got %q", ip)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the lookup to time out, it took %v", elapsed)
+	}
+
+	// the failure is cached until the interval ends
+	lookups := 0
+	lookup := r.lookup
+	r.lookup = func(ctx context.Context, host string) ([]string, error) {
+		lookups++
+		return lookup(ctx, host)
+	}
+	if ip := r.Resolve("hang.example.com"); ip != "" || lookups != 0 {
+		t.Errorf("expected no ip nor lookup, got %q after %d lookups", ip, lookups)
+	}
+
+	// a failed lookup keeps serving the previous result
+	r.interval = 0
+	r.lookup = func(ctx context.Context, host string) ([]string, error) {
+		return nil, errors.New("no such host")
+	}
+	if ip := r.Resolve("lb.example.com"); ip != "1.1.1.1" {
+		t.Errorf("expected 1.1.1.1, got %q", ip)
+	}
+}
@@ -2,154 +2,435 @@ package converter
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/golang/glog"
-	"github.com/pkg/errors"
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/informers"
-	informersv1 "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
-	listersv1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 )
 
-// podAddr -> tlbAddr
-type TLBMapper map[string]string
-
-func (m TLBMapper) Update(podAddrs sets.String, tlbAddr string) {
-	if podAddrs.Len() == 0 || tlbAddr == "" {
-		return
-	}
-	glog.V(4).Infof("update tlb mapper, podAddrs: %s, tlbAddr: %s", podAddrs, tlbAddr)
-	for podAddr := range podAddrs {
-		m[podAddr] = tlbAddr
-	}
-}
-
-func (m TLBMapper) Delete(podAddrs sets.String) {
-	if podAddrs.Len() == 0 {
-		return
-	}
-	glog.V(4).Infof("delete tlb mapper, podAddrs: %s", podAddrs)
-	for podAddr := range podAddrs {
-		delete(m, podAddr)
-	}
-}
+const (
+	// IngressHostnamePublish publishes load balancer hostnames as they are
+	IngressHostnamePublish = "publish"
+	// IngressHostnameResolve resolves load balancer hostnames to ips
+	IngressHostnameResolve = "resolve"
+)
 
 type TLBControllerConfig struct {
-	KubeConfig   *rest.Config
+	KubeConfig *rest.Config
+	// KubeClient is used instead of creating a client from KubeConfig when set
+	KubeClient kubernetes.Interface
+	// TLBLabelName selects the tlb services by the label existing, unless
+	// TLBSelector is set
 	TLBLabelName string
-	ResyncPeriod time.Duration
-	Namespace    string
+	// TLBSelector is the label selector of the tlb services
+	TLBSelector string
+	// TLBAnnotation is required on the tlb services when set, as key or
+	// key=value
+	TLBAnnotation string
+	ResyncPeriod  time.Duration
+	// Namespace is watched along with Namespaces, kept for compatibility
+	Namespace string
+	// Namespaces lists the namespaces watched, every namespace is watched
+	// when it is empty and NamespaceSelector is not set
+	Namespaces []string
+	// NamespaceSelector watches the namespaces matching the label selector,
+	// it is exclusive with Namespaces
+	NamespaceSelector string
+	// IngressHostnamePolicy decides how ingress hostnames are published,
+	// IngressHostnamePublish by default
+	IngressHostnamePolicy string
+	// HostnameResolveInterval is how long resolved hostnames are cached
+	HostnameResolveInterval time.Duration
+	// EndpointSliceClient is a discovery.k8s.io/v1 client used instead of
+	// creating one from KubeConfig when set. EndpointSlices are consumed
+	// when the server serves them, Endpoints otherwise.
+	EndpointSliceClient dynamic.Interface
+	// ResolvePods converts the addrs missing from the mapper from their pod
+	// and the tlb services selecting it, and tells why when it can not. The
+	// pods are watched either way to locate the service of an addr.
+	ResolvePods bool
+	// InformerFactory is shared with the other converters when set, it is
+	// only used when every namespace is watched
+	InformerFactory informers.SharedInformerFactory
 }
 
 type TLBController struct {
-	config     *TLBControllerConfig
-	kubeClient *kubernetes.Clientset
-
-	tlbMapper TLBMapper
-	lock      sync.RWMutex
+	changeNotifier
 
-	endpointsLister   listersv1.EndpointsLister
-	serviceLister     listersv1.ServiceLister
-	endpointsInformer informersv1.EndpointsInformer
-	serviceInformer   informersv1.ServiceInformer
+	config     *TLBControllerConfig
+	kubeClient kubernetes.Interface
+
+	// tlbMapper also holds the not ready and terminating pod addrs of tlb
+	// endpoints, they are withheld with ErrNotReady
+	tlbMapper *TLBMapper
+	// mapperSynced is set once the mapper is built from synced caches
+	mapperSynced bool
+	lock         sync.RWMutex
+	resolver     *hostnameResolver
+	tlbSelector  *TLBSelector
+
+	sliceClient       dynamic.Interface
+	namespaceSelector labels.Selector
+	namespaceInformer cache.SharedIndexInformer
+	// informers holds the informers per watched namespace, or a single one
+	// under metav1.NamespaceAll
+	informers     map[string]*namespaceInformers
+	informersLock sync.RWMutex
+	stopCh        <-chan struct{}
 }
 
 func NewTLBController(config *TLBControllerConfig) (*TLBController, error) {
+	switch config.IngressHostnamePolicy {
+	case "", IngressHostnamePublish, IngressHostnameResolve:
+	default:
+		return nil, fmt.Errorf("unknown ingress hostname policy %q", config.IngressHostnamePolicy)
+	}
 
-	kubeClient, err := kubernetes.NewForConfig(config.KubeConfig)
+	tlbSelector, err := NewTLBSelector(config.TLBLabelName, config.TLBSelector, config.TLBAnnotation)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create kubernetes client")
+		return nil, err
 	}
 
-	informerFactory := informers.NewSharedInformerFactory(kubeClient, config.ResyncPeriod)
+	kubeClient, err := newKubeClient(config.KubeConfig, config.KubeClient)
+	if err != nil {
+		return nil, err
+	}
 
-	endpointsInformer := informerFactory.Core().V1().Endpoints()
-	serviceInformer := informerFactory.Core().V1().Services()
-	endpointsLister := endpointsInformer.Lister()
-	serviceLister := serviceInformer.Lister()
+	namespaces, namespaceSelector, err := namespacesOf(config.Namespace, config.Namespaces, config.NamespaceSelector)
+	if err != nil {
+		return nil, err
+	}
 
 	tlbController := &TLBController{
 		config:     config,
 		kubeClient: kubeClient,
 
-		tlbMapper: make(TLBMapper),
+		tlbMapper:   NewTLBMapper(),
+		resolver:    newHostnameResolver(config.HostnameResolveInterval),
+		tlbSelector: tlbSelector,
 
-		endpointsLister:   endpointsLister,
-		serviceLister:     serviceLister,
-		endpointsInformer: endpointsInformer,
-		serviceInformer:   serviceInformer,
+		sliceClient:       endpointSliceClientOf(kubeClient, config.KubeConfig, config.EndpointSliceClient),
+		namespaceSelector: namespaceSelector,
+		informers:         make(map[string]*namespaceInformers),
 	}
 
-	endpointsInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc:    tlbController.onEndpointsAdd,
-		UpdateFunc: tlbController.onEndpointsUpdate,
-		DeleteFunc: tlbController.onEndpointsDelete,
-	})
-	serviceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc:    nil,
-		UpdateFunc: tlbController.onServiceUpdate,
-		DeleteFunc: nil,
-	})
+	switch {
+	case namespaceSelector != nil:
+		// informers are added and removed as namespaces match the selector
+		tlbController.namespaceInformer = newNamespaceInformer(kubeClient, namespaceSelector, config.ResyncPeriod)
+		tlbController.namespaceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    tlbController.onNamespaceAdd,
+			UpdateFunc: tlbController.onNamespaceUpdate,
+			DeleteFunc: tlbController.onNamespaceDelete,
+		})
+	case len(namespaces) == 0 && config.InformerFactory != nil:
+		informers, err := newSharedNamespaceInformers(config.InformerFactory, tlbController.sliceClient, config.ResyncPeriod)
+		if err != nil {
+			return nil, err
+		}
+		tlbController.watchNamespace(metav1.NamespaceAll, informers)
+	case len(namespaces) == 0:
+		tlbController.addNamespace(metav1.NamespaceAll)
+	default:
+		for _, namespace := range namespaces {
+			tlbController.addNamespace(namespace)
+		}
+	}
 
 	return tlbController, nil
 }
 
 func (c *TLBController) Run(stopCh <-chan struct{}) {
-	go c.endpointsInformer.Informer().Run(stopCh)
-	go c.serviceInformer.Informer().Run(stopCh)
-	go wait.Until(c.RefreshTLBMapper, 10*time.Second, stopCh)
+	c.informersLock.Lock()
+	c.stopCh = stopCh
+	for _, informers := range c.informers {
+		informers.Run()
+	}
+	c.informersLock.Unlock()
+
+	if c.namespaceInformer != nil {
+		go c.namespaceInformer.Run(stopCh)
+	}
+	go func() {
+		<-stopCh
+		c.informersLock.Lock()
+		defer c.informersLock.Unlock()
+		for namespace, informers := range c.informers {
+			informers.Stop()
+			delete(c.informers, namespace)
+		}
+	}()
+	go func() {
+		// a mapper built from partial caches would withdraw the pods not
+		// listed yet
+		if !cache.WaitForCacheSync(stopCh, c.informersSynced) {
+			glog.Errorf("wait for tlb caches to sync error")
+			return
+		}
+		wait.Until(c.RefreshTLBMapper, 10*time.Second, stopCh)
+	}()
 }
 
-func (c *TLBController) RefreshTLBMapper() {
-	// list tlb services
-	glog.V(4).Infof("list tlb services")
-	selector := labels.NewSelector()
-	r, err := labels.NewRequirement(c.config.TLBLabelName, selection.Exists, nil)
+// informersSynced tells whether the informers of every watched namespace
+// have synced.
+func (c *TLBController) informersSynced() bool {
+	if c.namespaceInformer != nil && !c.namespaceInformer.HasSynced() {
+		return false
+	}
+	c.informersLock.RLock()
+	defer c.informersLock.RUnlock()
+	for _, informers := range c.informers {
+		if !informers.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// HasSynced tells whether the mapper was built once from synced caches.
+func (c *TLBController) HasSynced() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.mapperSynced
+}
+
+// addNamespace starts watching the services and endpoints of namespace.
+func (c *TLBController) addNamespace(namespace string) {
+	c.informersLock.RLock()
+	_, ok := c.informers[namespace]
+	c.informersLock.RUnlock()
+	if ok {
+		return
+	}
+	c.watchNamespace(namespace, newNamespaceInformers(c.kubeClient, c.sliceClient, namespace, c.config.ResyncPeriod))
+}
+
+func (c *TLBController) watchNamespace(namespace string, informers *namespaceInformers) {
+	c.informersLock.Lock()
+	defer c.informersLock.Unlock()
+	if _, ok := c.informers[namespace]; ok {
+		return
+	}
+	glog.V(4).Infof("watch namespace %q", namespace)
+	// the mapping of a service is rebuilt on any change of the service or
+	// its endpoints
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.onObjectChange,
+		UpdateFunc: func(oldObj, newObj interface{}) { c.onObjectChange(newObj) },
+		DeleteFunc: c.onObjectChange,
+	}
+	informers.endpoints.AddEventHandler(handler)
+	informers.serviceInformer.AddEventHandler(handler)
+	c.informers[namespace] = informers
+	if c.stopCh != nil {
+		informers.Run()
+	}
+}
+
+// removeNamespace stops watching namespace and drops its mappings.
+func (c *TLBController) removeNamespace(namespace string) {
+	c.informersLock.Lock()
+	informers, ok := c.informers[namespace]
+	if ok {
+		informers.Stop()
+		delete(c.informers, namespace)
+	}
+	c.informersLock.Unlock()
+	if !ok {
+		return
+	}
+	glog.V(4).Infof("stop watching namespace %q", namespace)
+
+	c.lock.Lock()
+	withdrawn := c.tlbMapper.DeleteNamespace(namespace)
+	c.lock.Unlock()
+	if withdrawn {
+		c.notifyChange()
+	}
+}
+
+func (c *TLBController) onNamespaceAdd(obj interface{}) {
+	ns, ok := obj.(*v1.Namespace)
+	if !ok {
+		glog.Errorf("invalid obj type: %T", obj)
+		return
+	}
+	if c.namespaceSelector.Matches(labels.Set(ns.Labels)) {
+		c.addNamespace(ns.Name)
+	}
+}
+
+func (c *TLBController) onNamespaceUpdate(oldObj, newObj interface{}) {
+	ns, ok := newObj.(*v1.Namespace)
+	if !ok {
+		glog.Errorf("invalid obj type: %T", newObj)
+		return
+	}
+	if c.namespaceSelector.Matches(labels.Set(ns.Labels)) {
+		c.addNamespace(ns.Name)
+	} else {
+		c.removeNamespace(ns.Name)
+	}
+}
+
+func (c *TLBController) onNamespaceDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	ns, ok := obj.(*v1.Namespace)
+	if !ok {
+		glog.Errorf("invalid obj type: %T", obj)
+		return
+	}
+	c.removeNamespace(ns.Name)
+}
+
+// informersOf returns the informers watching namespace, nil if it is not watched.
+func (c *TLBController) informersOf(namespace string) *namespaceInformers {
+	c.informersLock.RLock()
+	defer c.informersLock.RUnlock()
+	if informers, ok := c.informers[metav1.NamespaceAll]; ok {
+		return informers
+	}
+	return c.informers[namespace]
+}
+
+func (c *TLBController) getService(namespace string, name string) (*v1.Service, error) {
+	informers := c.informersOf(namespace)
+	if informers == nil {
+		return nil, errors.NewNotFound(v1.Resource("services"), name)
+	}
+	return informers.serviceLister.Services(namespace).Get(name)
+}
+
+func (c *TLBController) getEndpoints(namespace string, name string) (*v1.Endpoints, error) {
+	informers := c.informersOf(namespace)
+	if informers == nil {
+		return nil, errors.NewNotFound(v1.Resource("endpoints"), name)
+	}
+	return informers.endpoints.Get(namespace, name)
+}
+
+// listServices lists the services of every watched namespace.
+func (c *TLBController) listServices(selector labels.Selector) ([]*v1.Service, error) {
+	c.informersLock.RLock()
+	defer c.informersLock.RUnlock()
+	services := make([]*v1.Service, 0)
+	for _, informers := range c.informers {
+		list, err := informers.serviceLister.List(selector)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, list...)
+	}
+	return services, nil
+}
+
+// onObjectChange syncs the service of a changed service or endpoints.
+func (c *TLBController) onObjectChange(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
 	if err != nil {
-		glog.Errorf("create requirement error, err: %v", err)
+		glog.Errorf("get key of %T error, err: %v", obj, err)
 		return
 	}
-	selector.Add(*r)
-	services, err := c.serviceLister.Services(c.config.Namespace).List(selector)
+	c.syncService(key)
+}
+
+// syncService rebuilds the mapping of one service from its current state,
+// a deleted, non-tlb or unprovisioned service owns no addrs.
+func (c *TLBController) syncService(key string) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		glog.Errorf("split key %s error, err: %v", key, err)
+		return
+	}
+
+	addrs := make(map[string]string)
+	notReady := sets.NewString()
+	svc, err := c.getService(namespace, name)
+	switch {
+	case errors.IsNotFound(err):
+		glog.V(4).Infof("service deleted, ns: %s, name: %s", namespace, name)
+	case err != nil:
+		glog.Errorf("get service error, ns: %s, name: %s, err: %v", namespace, name, err)
+		return
+	case !c.isTLBService(svc):
+		glog.V(7).Infof("skip non-tlb service, ns: %s, name: %s", namespace, name)
+	default:
+		ingressAddr := c.getTLBIngressAddr(svc)
+		if ingressAddr == "" {
+			glog.V(4).Infof("tlb service not initialized yet, ns: %s, name: %s", namespace, name)
+			break
+		}
+		ep, err := c.getEndpoints(namespace, name)
+		if errors.IsNotFound(err) {
+			glog.V(4).Infof("tlb service has no endpoints, ns: %s, name: %s", namespace, name)
+			break
+		}
+		if err != nil {
+			glog.Errorf("get endpoints of service error, ns: %s, name: %s, err: %v", namespace, name, err)
+			return
+		}
+		addrs = getTLBAddrsFromEndpoints(ingressAddr, svc, ep)
+		notReady = getNotReadyPodAddrsFromEndpoints(ep)
+	}
+
+	c.lock.Lock()
+	withdrawn := c.tlbMapper.Set(key, addrs, notReady)
+	c.lock.Unlock()
+
+	// pods turning not ready or terminating are unregistered right away
+	if withdrawn {
+		c.notifyChange()
+	}
+}
+
+// RefreshTLBMapper syncs every tlb service, and drops the services mapped
+// but not listed anymore in case a delete event was missed.
+func (c *TLBController) RefreshTLBMapper() {
+	glog.V(4).Infof("list tlb services")
+	services, err := c.listServices(labels.Everything())
 	if err != nil {
 		glog.Errorf("list services error, err: %v", err)
 		return
 	}
 
-	// get tlb address
+	keys := sets.NewString()
 	for _, svc := range services {
-		if !c.isTLBService(svc) {
-			glog.V(7).Infof("skip non-tlb service, ns: %s, name: %s", svc.Namespace, svc.Name)
+		if !c.matchesTLB(svc) {
 			continue
 		}
-		tlbAddr := getTLBAddrFromService(svc)
-		if tlbAddr == "" {
-			glog.V(4).Infof("tlb service not initialized yet, ns: %s, name: %s", svc.Namespace, svc.Name)
-			continue
-		}
-		// get endpoints of the service
-		ep, err := c.endpointsLister.Endpoints(svc.Namespace).Get(svc.Name)
+		key, err := cache.MetaNamespaceKeyFunc(svc)
 		if err != nil {
-			glog.Warningf("get endpoints of service error, ns: %s, name: %s, err: %v", svc.Namespace, svc.Name, err)
 			continue
 		}
-		glog.V(4).Infof("got valid service, ns: %s, name: %s", svc.Namespace, svc.Name)
-		podAddrs := getPodAddrsFromEndpoints(ep)
-		c.lock.Lock()
-		c.tlbMapper.Update(podAddrs, tlbAddr)
-		c.lock.Unlock()
+		keys.Insert(key)
+		c.syncService(key)
+	}
+
+	c.lock.RLock()
+	stale := c.tlbMapper.ServiceKeys().Difference(keys)
+	c.lock.RUnlock()
+	for key := range stale {
+		c.syncService(key)
 	}
 
-	return
+	c.lock.Lock()
+	c.mapperSynced = true
+	c.lock.Unlock()
 }
 
 func getPodAddrsFromEndpoints(ep *v1.Endpoints) sets.String {
@@ -165,141 +446,176 @@ func getPodAddrsFromEndpoints(ep *v1.Endpoints) sets.String {
 	return podAddrs
 }
 
-func diffAddrs(oldAddrs sets.String, newAddrs sets.String) (sets.String, sets.String) {
-	deletedAddrs := oldAddrs.Difference(newAddrs)
-	createdAddrs := newAddrs.Difference(oldAddrs)
-	return deletedAddrs, createdAddrs
+func getNotReadyPodAddrsFromEndpoints(ep *v1.Endpoints) sets.String {
+	podAddrs := sets.NewString()
+	for _, subset := range ep.Subsets {
+		for _, ip := range subset.NotReadyAddresses {
+			for _, port := range subset.Ports {
+				podAddr := fmt.Sprintf("%s:%d", ip.IP, port.Port)
+				podAddrs.Insert(podAddr)
+			}
+		}
+	}
+	return podAddrs
 }
 
-func (c *TLBController) onEndpointsAdd(obj interface{}) {
-	ep, ok := obj.(*v1.Endpoints)
-	if !ok {
-		glog.Errorf("invalid obj type: %T", obj)
-		return
-	}
-	if !c.isTLBEndpoints(ep) {
-		glog.V(7).Infof("skip endpoints, ns: %s, name: %s", ep.Namespace, ep.Name)
-		return
+func protocolOf(protocol v1.Protocol) v1.Protocol {
+	if protocol == "" {
+		return v1.ProtocolTCP
 	}
-	addrs := getPodAddrsFromEndpoints(ep)
-	c.lock.Lock()
-	defer c.lock.Unlock()
-	c.tlbMapper.Update(addrs, "")
+	return protocol
 }
 
-func (c *TLBController) isTLBEndpoints(ep *v1.Endpoints) bool {
-	if ep.Namespace != c.config.Namespace {
-		return false
+// findServicePort returns the service port an endpoint port belongs to.
+// The endpoints controller names endpoint ports after their service port,
+// unnamed ports (single port services) are paired by target port.
+func findServicePort(svc *v1.Service, epPort v1.EndpointPort) (v1.ServicePort, bool) {
+	for _, port := range svc.Spec.Ports {
+		if epPort.Name != "" && port.Name == epPort.Name && protocolOf(port.Protocol) == protocolOf(epPort.Protocol) {
+			return port, true
+		}
+	}
+	// the target port may be named after a container port, the only port of
+	// the protocol is the one whatever its target port
+	if epPort.Name == "" {
+		matching := make([]v1.ServicePort, 0, 1)
+		for _, port := range svc.Spec.Ports {
+			if protocolOf(port.Protocol) == protocolOf(epPort.Protocol) {
+				matching = append(matching, port)
+			}
+		}
+		if len(matching) == 1 {
+			return matching[0], true
+		}
 	}
-	for k := range ep.Labels {
-		if c.config.TLBLabelName == k {
-			return true
+	for _, port := range svc.Spec.Ports {
+		if protocolOf(port.Protocol) != protocolOf(epPort.Protocol) {
+			continue
+		}
+		targetPort := port.TargetPort
+		if targetPort.Type == intstr.Int && targetPort.IntVal == 0 {
+			// target port defaults to port
+			targetPort = intstr.FromInt(int(port.Port))
+		}
+		if targetPort.Type == intstr.Int && targetPort.IntVal == epPort.Port {
+			return port, true
 		}
 	}
-	return false
+	return v1.ServicePort{}, false
 }
 
-func (c *TLBController) isTLBService(svc *v1.Service) bool {
-	if svc.Namespace != c.config.Namespace {
-		return false
+// getTLBAddrsFromEndpoints returns podAddr -> tlbAddr of every endpoint
+// port, each mapped to the load balancer address of its own service port.
+func getTLBAddrsFromEndpoints(ingressAddr string, svc *v1.Service, ep *v1.Endpoints) map[string]string {
+	addrs := make(map[string]string)
+	if ingressAddr == "" {
+		return addrs
 	}
-	for k := range svc.Labels {
-		if c.config.TLBLabelName == k {
-			return true
+	for _, subset := range ep.Subsets {
+		for _, epPort := range subset.Ports {
+			svcPort, ok := findServicePort(svc, epPort)
+			if !ok {
+				glog.V(4).Infof("no service port for endpoint port %s/%d, ns: %s, name: %s", epPort.Name, epPort.Port, ep.Namespace, ep.Name)
+				continue
+			}
+			tlbAddr := fmt.Sprintf("%s:%d", ingressAddr, svcPort.Port)
+			for _, ip := range subset.Addresses {
+				addrs[fmt.Sprintf("%s:%d", ip.IP, epPort.Port)] = tlbAddr
+			}
 		}
 	}
-	return false
+	return addrs
 }
 
-func (c *TLBController) onEndpointsUpdate(oldObj, newObj interface{}) {
-	oldEp, ok := oldObj.(*v1.Endpoints)
-	if !ok {
-		glog.Errorf("invalid obj type: %T", oldObj)
-		return
-	}
-	if !c.isTLBEndpoints(oldEp) {
-		glog.V(7).Infof("skip endpoints, ns: %s, name: %s", oldEp.Namespace, oldEp.Name)
-		return
-	}
-	newEp, ok := newObj.(*v1.Endpoints)
-	if !ok {
-		glog.Errorf("invalid obj type: %T", newObj)
-		return
+func (c *TLBController) isTLBService(svc *v1.Service) bool {
+	if c.informersOf(svc.Namespace) == nil {
+		return false
 	}
-	deletedAddrs, createdAddrs := diffAddrs(getPodAddrsFromEndpoints(oldEp), getPodAddrsFromEndpoints(newEp))
-	c.lock.Lock()
-	defer c.lock.Unlock()
-	c.tlbMapper.Delete(deletedAddrs)
-	c.tlbMapper.Update(createdAddrs, "")
+	return c.matchesTLB(svc)
 }
 
-func (c *TLBController) onEndpointsDelete(obj interface{}) {
-	ep, ok := obj.(*v1.Endpoints)
-	if !ok {
-		glog.Errorf("invalid obj type: %T", obj)
-		return
-	}
-	if !c.isTLBEndpoints(ep) {
-		glog.V(7).Infof("skip endpoints, ns: %s, name: %s", ep.Namespace, ep.Name)
-		return
-	}
-	addrs := getPodAddrsFromEndpoints(ep)
-	c.lock.Lock()
-	defer c.lock.Unlock()
-	c.tlbMapper.Delete(addrs)
+// matchesTLB tells whether svc is a tlb service, by the tlb selector or its
+// dxinkube/expose annotation.
+func (c *TLBController) matchesTLB(svc *v1.Service) bool {
+	return c.tlbSelector.Matches(svc) || svc.Annotations[ExposeKey] == ExposeLoadBalancer
 }
 
-func getTLBAddrFromService(svc *v1.Service) string {
-	// assert one service just has one ingress ip
-	var tlbAddr string
+// getTLBIngressAddr returns the load balancer address of svc, or "" if it is
+// not provisioned yet. With several ingress entries the lowest ip is chosen,
+// then the lowest hostname, so the choice does not depend on their order.
+func (c *TLBController) getTLBIngressAddr(svc *v1.Service) string {
+	ips := make([]string, 0)
+	hostnames := make([]string, 0)
 	for _, ingress := range svc.Status.LoadBalancer.Ingress {
-		for _, port := range svc.Spec.Ports {
-			tlbAddr = fmt.Sprintf("%s:%d", ingress.IP, port.Port)
-			// break
+		if ingress.IP != "" {
+			ips = append(ips, ingress.IP)
+		} else if ingress.Hostname != "" {
+			hostnames = append(hostnames, ingress.Hostname)
 		}
 	}
-	return tlbAddr
+	if len(ips) > 0 {
+		sort.Strings(ips)
+		return ips[0]
+	}
+	if len(hostnames) == 0 {
+		return ""
+	}
+	sort.Strings(hostnames)
+	if c.config.IngressHostnamePolicy == IngressHostnameResolve {
+		return c.resolver.Resolve(hostnames[0])
+	}
+	return hostnames[0]
 }
 
-func (c *TLBController) onServiceUpdate(oldObj, newObj interface{}) {
-	oldSvc, ok := oldObj.(*v1.Service)
-	if !ok {
-		glog.Errorf("invalid obj type: %T", oldObj)
-		return
+func (c *TLBController) ConvertAddr(podAddr string) (string, error) {
+	c.lock.RLock()
+	tlbAddr, ok := c.tlbMapper.Get(podAddr)
+	notReady := c.tlbMapper.IsNotReady(podAddr)
+	c.lock.RUnlock()
+	if !ok && notReady {
+		glog.V(4).Infof("podIP %s is not ready", podAddr)
+		return "", ErrNotReady
 	}
-	if !c.isTLBService(oldSvc) {
-		glog.V(7).Infof("skip service, ns: %s, name: %s", oldSvc.Namespace, oldSvc.Name)
-		return
+	if ok {
+		return tlbAddr, nil
 	}
-	newSvc, ok := newObj.(*v1.Service)
-	if !ok {
-		glog.Errorf("invalid obj type: %T", newObj)
-		return
+	if !c.config.ResolvePods {
+		glog.Errorf("podIP %s is not in tlbMapper", podAddr)
+		return "", &ConvertError{Reason: ReasonNotInMapper, Addr: podAddr, Message: "podIP is not in tlbMapper"}
 	}
-
-	tlbAddr := getTLBAddrFromService(newSvc)
-	if tlbAddr != "" && getTLBAddrFromService(oldSvc) == "" {
-		// get endpoints of the service
-		ep, err := c.endpointsLister.Endpoints(newSvc.Namespace).Get(newSvc.Name)
-		if err != nil {
-			glog.Errorf("get endpoints of service error, ns: %s, name: %s, err: %v", newSvc.Namespace, newSvc.Name, err)
-			return
-		}
-		podAddrs := getPodAddrsFromEndpoints(ep)
-		c.lock.Lock()
-		defer c.lock.Unlock()
-		c.tlbMapper.Update(podAddrs, tlbAddr)
+	tlbAddr, _, err := c.resolvePodAddr(podAddr)
+	if err == ErrNotReady {
+		glog.V(4).Infof("pod of %s is not ready", podAddr)
+		return "", err
 	}
-	return
+	if err != nil {
+		glog.Errorf("resolve pod of %s error, err: %v", podAddr, err)
+		return "", err
+	}
+	glog.V(4).Infof("podIP %s is not in tlbMapper, resolved from its pod to %s", podAddr, tlbAddr)
+	return tlbAddr, nil
 }
 
-func (c *TLBController) ConvertAddr(podAddr string) (string, error) {
+// ServiceOfAddr returns the tlb service selecting the pod of podAddr. The
+// pod is looked up first as the addrs failing to convert are missing from
+// the mapper, the mapper covers the endpoints without a pod.
+func (c *TLBController) ServiceOfAddr(podAddr string) (*v1.Service, bool) {
+	if svc := c.serviceOfPod(podAddr); svc != nil {
+		return svc, true
+	}
 	c.lock.RLock()
-	defer c.lock.RUnlock()
-	tlbAddr, ok := c.tlbMapper[podAddr]
+	serviceKey, ok := c.tlbMapper.Owner(podAddr)
+	c.lock.RUnlock()
 	if !ok {
-		glog.Errorf("podIP %s is not in tlbMapper", podAddr)
-		return "", fmt.Errorf("podIP is not in tlbMapper")
+		return nil, false
 	}
-	return tlbAddr, nil
+	namespace, name, err := cache.SplitMetaNamespaceKey(serviceKey)
+	if err != nil {
+		return nil, false
+	}
+	svc, err := c.getService(namespace, name)
+	if err != nil {
+		return nil, false
+	}
+	return svc, true
 }
@@ -0,0 +1,75 @@
+package converter
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestFindServicePort(t *testing.T) {
+	tests := []struct {
+		name     string
+		ports    []v1.ServicePort
+		epPort   v1.EndpointPort
+		expected int32
+		found    bool
+	}{
+		{
+			name: "named",
+			ports: []v1.ServicePort{
+				{Name: "dubbo", Port: 20880, TargetPort: intstr.FromInt(20880)},
+				{Name: "rest", Port: 80, TargetPort: intstr.FromInt(8080)},
+			},
+			epPort:   v1.EndpointPort{Name: "rest", Port: 8080},
+			expected: 80,
+			found:    true,
+		},
+		{
+			name:     "unnamed target port",
+			ports:    []v1.ServicePort{{Port: 80, TargetPort: intstr.FromInt(20880)}},
+			epPort:   v1.EndpointPort{Port: 20880},
+			expected: 80,
+			found:    true,
+		},
+		{
+			name:     "unnamed default target port",
+			ports:    []v1.ServicePort{{Port: 20880}},
+			epPort:   v1.EndpointPort{Port: 20880},
+			expected: 20880,
+			found:    true,
+		},
+		{
+			name:     "unnamed named target port",
+			ports:    []v1.ServicePort{{Port: 80, TargetPort: intstr.FromString("dubbo")}},
+			epPort:   v1.EndpointPort{Port: 20880},
+			expected: 80,
+			found:    true,
+		},
+		{
+			name: "unnamed named target port of the protocol",
+			ports: []v1.ServicePort{
+				{Port: 80, TargetPort: intstr.FromString("dubbo")},
+				{Port: 53, Protocol: v1.ProtocolUDP, TargetPort: intstr.FromInt(5353)},
+			},
+			epPort:   v1.EndpointPort{Port: 20880, Protocol: v1.ProtocolTCP},
+			expected: 80,
+			found:    true,
+		},
+		{
+			name:   "other protocol",
+			ports:  []v1.ServicePort{{Port: 80, TargetPort: intstr.FromString("dubbo")}},
+			epPort: v1.EndpointPort{Port: 20880, Protocol: v1.ProtocolUDP},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &v1.Service{Spec: v1.ServiceSpec{Ports: test.ports}}
+			port, found := findServicePort(svc, test.epPort)
+			if found != test.found || port.Port != test.expected {
+				t.Errorf("expected port %d found %v, got %d found %v", test.expected, test.found, port.Port, found)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package converter
+
+import (
+	"strings"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// TLBMapper maps pod addrs to tlb addrs. Each tlb service owns the addrs of
+// its endpoints, keyed by namespace/name, so they are replaced or removed
+// exactly when the service or its endpoints change.
+type TLBMapper struct {
+	// serviceKey -> podAddr -> tlbAddr
+	services map[string]map[string]string
+	// serviceKey -> not ready podAddrs
+	notReady map[string]sets.String
+
+	// podAddr -> serviceKeys
+	owners         map[string]sets.String
+	notReadyOwners map[string]sets.String
+}
+
+func NewTLBMapper() *TLBMapper {
+	return &TLBMapper{
+		services:       make(map[string]map[string]string),
+		notReady:       make(map[string]sets.String),
+		owners:         make(map[string]sets.String),
+		notReadyOwners: make(map[string]sets.String),
+	}
+}
+
+func addOwner(owners map[string]sets.String, podAddr string, serviceKey string) {
+	if owners[podAddr] == nil {
+		owners[podAddr] = sets.NewString()
+	}
+	owners[podAddr].Insert(serviceKey)
+}
+
+func removeOwner(owners map[string]sets.String, podAddr string, serviceKey string) {
+	owners[podAddr].Delete(serviceKey)
+	if owners[podAddr].Len() == 0 {
+		delete(owners, podAddr)
+	}
+}
+
+// Set replaces the addrs of a service. It returns whether a pod addr mapped
+// before is removed or mapped to another tlb addr.
+func (m *TLBMapper) Set(serviceKey string, addrs map[string]string, notReady sets.String) bool {
+	oldAddrs := m.services[serviceKey]
+	m.Delete(serviceKey)
+	if len(addrs) > 0 {
+		glog.V(4).Infof("update tlb mapper, service: %s, addrs: %v", serviceKey, addrs)
+		m.services[serviceKey] = addrs
+		for podAddr := range addrs {
+			addOwner(m.owners, podAddr, serviceKey)
+		}
+	}
+	if notReady.Len() > 0 {
+		m.notReady[serviceKey] = notReady
+		for podAddr := range notReady {
+			addOwner(m.notReadyOwners, podAddr, serviceKey)
+		}
+	}
+	for podAddr, tlbAddr := range oldAddrs {
+		if addrs[podAddr] != tlbAddr {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete removes the addrs of a service, it returns whether any was mapped.
+func (m *TLBMapper) Delete(serviceKey string) bool {
+	addrs, ok := m.services[serviceKey]
+	for podAddr := range addrs {
+		removeOwner(m.owners, podAddr, serviceKey)
+	}
+	for podAddr := range m.notReady[serviceKey] {
+		removeOwner(m.notReadyOwners, podAddr, serviceKey)
+	}
+	delete(m.services, serviceKey)
+	delete(m.notReady, serviceKey)
+	if ok {
+		glog.V(4).Infof("delete tlb mapper, service: %s", serviceKey)
+	}
+	return ok && len(addrs) > 0
+}
+
+// DeleteNamespace removes the addrs of every service of namespace.
+func (m *TLBMapper) DeleteNamespace(namespace string) bool {
+	withdrawn := false
+	for _, serviceKey := range m.ServiceKeys().List() {
+		if strings.HasPrefix(serviceKey, namespace+"/") && m.Delete(serviceKey) {
+			withdrawn = true
+		}
+	}
+	return withdrawn
+}
+
+// ServiceKeys returns the keys of the services holding addrs.
+func (m *TLBMapper) ServiceKeys() sets.String {
+	keys := sets.StringKeySet(m.services)
+	return keys.Union(sets.StringKeySet(m.notReady))
+}
+
+// Get returns the tlb addr of podAddr. An addr selected by several services,
+// host network pods for instance, resolves through the lowest service key.
+func (m *TLBMapper) Get(podAddr string) (string, bool) {
+	owners, ok := m.owners[podAddr]
+	if !ok {
+		return "", false
+	}
+	return m.services[owners.List()[0]][podAddr], true
+}
+
+// Owner returns the key of the service a pod addr, ready or not, resolves
+// through.
+func (m *TLBMapper) Owner(podAddr string) (string, bool) {
+	owners, ok := m.owners[podAddr]
+	if !ok {
+		owners, ok = m.notReadyOwners[podAddr]
+	}
+	if !ok {
+		return "", false
+	}
+	return owners.List()[0], true
+}
+
+// IsNotReady tells whether podAddr is a not ready endpoint of a service.
+func (m *TLBMapper) IsNotReady(podAddr string) bool {
+	_, ok := m.notReadyOwners[podAddr]
+	return ok
+}
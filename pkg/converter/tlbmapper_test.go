@@ -0,0 +1,146 @@
+package converter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	dxtesting "github.com/whypro/dxinkube/pkg/testing"
+)
+
+func newMapperTestService(name string, ingressIP string, port int32) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name, Labels: map[string]string{"ke-tlb/owner": "x"}},
+		Spec:       v1.ServiceSpec{Ports: []v1.ServicePort{{Name: "dubbo", Port: port}}},
+		Status: v1.ServiceStatus{LoadBalancer: v1.LoadBalancerStatus{
+			Ingress: []v1.LoadBalancerIngress{{IP: ingressIP}},
+		}},
+	}
+}
+
+func newMapperTestEndpoints(name string, ready []string, notReady []string) *v1.Endpoints {
+	subset := v1.EndpointSubset{Ports: []v1.EndpointPort{{Name: "dubbo", Port: 20880}}}
+	for _, ip := range ready {
+		subset.Addresses = append(subset.Addresses, v1.EndpointAddress{IP: ip})
+	}
+	for _, ip := range notReady {
+		subset.NotReadyAddresses = append(subset.NotReadyAddresses, v1.EndpointAddress{IP: ip})
+	}
+	return &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name},
+		Subsets:    []v1.EndpointSubset{subset},
+	}
+}
+
+// mapperContents returns the addrs and the not ready addrs of each service
+// mapped.
+func mapperContents(c *TLBController) (map[string]map[string]string, map[string][]string) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	services := make(map[string]map[string]string)
+	for key, addrs := range c.tlbMapper.services {
+		services[key] = make(map[string]string)
+		for podAddr, tlbAddr := range addrs {
+			services[key][podAddr] = tlbAddr
+		}
+	}
+	notReady := make(map[string][]string)
+	for key, podAddrs := range c.tlbMapper.notReady {
+		notReady[key] = podAddrs.List()
+	}
+	return services, notReady
+}
+
+func expectMapper(t *testing.T, step string, c *TLBController, services map[string]map[string]string, notReady map[string][]string) {
+	var gotServices map[string]map[string]string
+	var gotNotReady map[string][]string
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		gotServices, gotNotReady = mapperContents(c)
+		return reflect.DeepEqual(gotServices, services) && reflect.DeepEqual(gotNotReady, notReady), nil
+	})
+	if err != nil {
+		t.Fatalf("%s: expected mapper %v, not ready %v, got %v, not ready %v", step, services, notReady, gotServices, gotNotReady)
+	}
+}
+
+func TestTLBMapperFollowsEvents(t *testing.T) {
+	kubeClient := dxtesting.NewFakeKubeClient(
+		newMapperTestService("a", "192.168.0.1", 30000),
+		newMapperTestEndpoints("a", []string{"10.0.0.1", "10.0.0.2"}, nil),
+	)
+	c, err := NewTLBController(&TLBControllerConfig{
+		KubeClient:   kubeClient,
+		TLBLabelName: "ke-tlb/owner",
+		Namespace:    "ns",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c.Run(stopCh)
+	waitForTLBSync(t, c)
+
+	expectMapper(t, "sync", c, map[string]map[string]string{
+		"ns/a": {"10.0.0.1:20880": "192.168.0.1:30000", "10.0.0.2:20880": "192.168.0.1:30000"},
+	}, map[string][]string{})
+
+	if _, err := kubeClient.CoreV1().Endpoints("ns").Create(newMapperTestEndpoints("b", []string{"10.0.1.1"}, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kubeClient.CoreV1().Services("ns").Create(newMapperTestService("b", "192.168.0.2", 30000)); err != nil {
+		t.Fatal(err)
+	}
+	expectMapper(t, "service add", c, map[string]map[string]string{
+		"ns/a": {"10.0.0.1:20880": "192.168.0.1:30000", "10.0.0.2:20880": "192.168.0.1:30000"},
+		"ns/b": {"10.0.1.1:20880": "192.168.0.2:30000"},
+	}, map[string][]string{})
+
+	if _, err := kubeClient.CoreV1().Services("ns").Update(newMapperTestService("a", "192.168.0.3", 31000)); err != nil {
+		t.Fatal(err)
+	}
+	expectMapper(t, "service update", c, map[string]map[string]string{
+		"ns/a": {"10.0.0.1:20880": "192.168.0.3:31000", "10.0.0.2:20880": "192.168.0.3:31000"},
+		"ns/b": {"10.0.1.1:20880": "192.168.0.2:30000"},
+	}, map[string][]string{})
+
+	if _, err := kubeClient.CoreV1().Endpoints("ns").Update(newMapperTestEndpoints("a", []string{"10.0.0.1"}, []string{"10.0.0.3"})); err != nil {
+		t.Fatal(err)
+	}
+	expectMapper(t, "endpoints update", c, map[string]map[string]string{
+		"ns/a": {"10.0.0.1:20880": "192.168.0.3:31000"},
+		"ns/b": {"10.0.1.1:20880": "192.168.0.2:30000"},
+	}, map[string][]string{
+		"ns/a": {"10.0.0.3:20880"},
+	})
+
+	if err := kubeClient.CoreV1().Services("ns").Delete("b", &metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expectMapper(t, "service delete", c, map[string]map[string]string{
+		"ns/a": {"10.0.0.1:20880": "192.168.0.3:31000"},
+	}, map[string][]string{
+		"ns/a": {"10.0.0.3:20880"},
+	})
+
+	// a delete missed by the informer is caught up by the full refresh
+	informers := c.informersOf("ns")
+	obj, exists, err := informers.serviceInformer.GetStore().GetByKey("ns/a")
+	if err != nil || !exists {
+		t.Fatalf("expected service ns/a in the store, %v", err)
+	}
+	if err := informers.serviceInformer.GetStore().Delete(obj); err != nil {
+		t.Fatal(err)
+	}
+	expectMapper(t, "missed delete", c, map[string]map[string]string{
+		"ns/a": {"10.0.0.1:20880": "192.168.0.3:31000"},
+	}, map[string][]string{
+		"ns/a": {"10.0.0.3:20880"},
+	})
+	c.RefreshTLBMapper()
+	expectMapper(t, "refresh", c, map[string]map[string]string{}, map[string][]string{})
+}
@@ -0,0 +1,224 @@
+package converter
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Reasons an addr is not converted by the tlb and nodeport converters.
+const (
+	// ReasonNotInMapper: no tlb service endpoint has the addr
+	ReasonNotInMapper = "NotInMapper"
+	// ReasonPodNotFound: no pod of the watched namespaces has the ip
+	ReasonPodNotFound = "PodNotFound"
+	// ReasonNoTLBService: no tlb service selects the pod
+	ReasonNoTLBService = "NoTLBService"
+	// ReasonTLBNotProvisioned: the tlb service has no load balancer ingress
+	ReasonTLBNotProvisioned = "TLBNotProvisioned"
+	// ReasonPortNotExposed: the tlb service does not expose the port
+	ReasonPortNotExposed = "PortNotExposed"
+	// ReasonNoReadyNode: no ready node hosts an endpoint of the nodeport
+	// service
+	ReasonNoReadyNode = "NoReadyNode"
+)
+
+// ConvertError tells why an addr is not converted.
+type ConvertError struct {
+	Reason  string
+	Addr    string
+	Message string
+}
+
+func (e *ConvertError) Error() string {
+	return fmt.Sprintf("%s: %s, %s", e.Reason, e.Addr, e.Message)
+}
+
+// ReasonOf returns the reason of a ConvertError, empty for other errors.
+func ReasonOf(err error) string {
+	if e, ok := err.(*ConvertError); ok {
+		return e.Reason
+	}
+	return ""
+}
+
+// podsOfAddr returns the pods with the ip of podAddr, several for host
+// network pods.
+func (c *TLBController) podsOfAddr(ip string) ([]*v1.Pod, error) {
+	c.informersLock.RLock()
+	defer c.informersLock.RUnlock()
+	pods := make([]*v1.Pod, 0)
+	for _, informers := range c.informers {
+		objs, err := informers.podInformer.GetIndexer().ByIndex(PodIPIndex, ip)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			if pod, ok := obj.(*v1.Pod); ok {
+				pods = append(pods, pod)
+			}
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		if pods[i].Namespace != pods[j].Namespace {
+			return pods[i].Namespace < pods[j].Namespace
+		}
+		return pods[i].Name < pods[j].Name
+	})
+	return pods, nil
+}
+
+// tlbServicesOfPod returns the tlb services selecting pod, sorted by name.
+func (c *TLBController) tlbServicesOfPod(pod *v1.Pod) ([]*v1.Service, error) {
+	informers := c.informersOf(pod.Namespace)
+	if informers == nil {
+		return nil, nil
+	}
+	services, err := informers.serviceLister.Services(pod.Namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	selected := make([]*v1.Service, 0)
+	for _, svc := range services {
+		if len(svc.Spec.Selector) == 0 || !c.matchesTLB(svc) {
+			continue
+		}
+		if labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(pod.Labels)) {
+			selected = append(selected, svc)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Name < selected[j].Name })
+	return selected, nil
+}
+
+// findPodServicePort returns the service port targeting containerPort of pod.
+func findPodServicePort(svc *v1.Service, pod *v1.Pod, containerPort int32) (v1.ServicePort, bool) {
+	for _, port := range svc.Spec.Ports {
+		if protocolOf(port.Protocol) != v1.ProtocolTCP {
+			continue
+		}
+		targetPort := port.TargetPort
+		switch {
+		case targetPort.Type == intstr.Int && targetPort.IntVal == 0:
+			// target port defaults to port
+			if port.Port == containerPort {
+				return port, true
+			}
+		case targetPort.Type == intstr.Int:
+			if targetPort.IntVal == containerPort {
+				return port, true
+			}
+		default:
+			for _, container := range pod.Spec.Containers {
+				for _, p := range container.Ports {
+					if p.Name == targetPort.StrVal && p.ContainerPort == containerPort {
+						return port, true
+					}
+				}
+			}
+		}
+	}
+	return v1.ServicePort{}, false
+}
+
+// serviceOfPod returns the tlb service selecting the pod of podAddr, one
+// exposing its port if any, nil when no tlb service selects it.
+func (c *TLBController) serviceOfPod(podAddr string) *v1.Service {
+	ip, portStr, err := net.SplitHostPort(podAddr)
+	if err != nil {
+		return nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil
+	}
+	pods, err := c.podsOfAddr(ip)
+	if err != nil {
+		glog.Errorf("get pods of %s error, err: %v", podAddr, err)
+		return nil
+	}
+	var selecting *v1.Service
+	for _, pod := range pods {
+		services, err := c.tlbServicesOfPod(pod)
+		if err != nil {
+			glog.Errorf("get tlb services of pod %s/%s error, err: %v", pod.Namespace, pod.Name, err)
+			return nil
+		}
+		for _, svc := range services {
+			if _, ok := findPodServicePort(svc, pod, int32(port)); ok {
+				return svc
+			}
+			if selecting == nil {
+				selecting = svc
+			}
+		}
+	}
+	return selecting
+}
+
+// resolvePodAddr converts podAddr from its pod and the tlb services selecting
+// it, for addrs not in the mapper yet, while the endpoints are not synced
+// for instance. It returns the service resolved through along with the
+// error when the conversion fails past the service lookup.
+func (c *TLBController) resolvePodAddr(podAddr string) (string, *v1.Service, error) {
+	ip, portStr, err := net.SplitHostPort(podAddr)
+	if err != nil {
+		return "", nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", nil, err
+	}
+	pods, err := c.podsOfAddr(ip)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(pods) == 0 {
+		return "", nil, &ConvertError{Reason: ReasonPodNotFound, Addr: podAddr, Message: "no pod has the ip"}
+	}
+
+	convertErr := &ConvertError{Reason: ReasonNoTLBService, Addr: podAddr, Message: fmt.Sprintf("no tlb service selects pod %s/%s", pods[0].Namespace, pods[0].Name)}
+	var convertService *v1.Service
+	// a not ready pod does not end the scan, another pod with the ip, a
+	// host network one for instance, may be ready
+	var notReadyService *v1.Service
+	for _, pod := range pods {
+		services, err := c.tlbServicesOfPod(pod)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, svc := range services {
+			svcPort, ok := findPodServicePort(svc, pod, int32(port))
+			if !ok {
+				if convertErr.Reason == ReasonNoTLBService {
+					convertService = svc
+					convertErr = &ConvertError{Reason: ReasonPortNotExposed, Addr: podAddr, Message: fmt.Sprintf("tlb service %s/%s does not expose the port", svc.Namespace, svc.Name)}
+				}
+				continue
+			}
+			if !isPodReady(pod) {
+				if notReadyService == nil {
+					notReadyService = svc
+				}
+				continue
+			}
+			ingressAddr := c.getTLBIngressAddr(svc)
+			if ingressAddr == "" {
+				convertService = svc
+				convertErr = &ConvertError{Reason: ReasonTLBNotProvisioned, Addr: podAddr, Message: fmt.Sprintf("tlb service %s/%s has no load balancer ingress", svc.Namespace, svc.Name)}
+				continue
+			}
+			return fmt.Sprintf("%s:%d", ingressAddr, svcPort.Port), svc, nil
+		}
+	}
+	if notReadyService != nil {
+		return "", notReadyService, ErrNotReady
+	}
+	return "", convertService, convertErr
+}
@@ -0,0 +1,123 @@
+package converter
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	dxtesting "github.com/whypro/dxinkube/pkg/testing"
+)
+
+func TestTLBControllerServiceOfAddr(t *testing.T) {
+	svc := newMapperTestService("a", "", 20880)
+	svc.Spec.Selector = map[string]string{"app": "a"}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "a-0", Labels: map[string]string{"app": "a"}},
+		Status:     v1.PodStatus{PodIP: "10.0.0.1"},
+	}
+	// the endpoints miss the pod, its addr is not in the mapper
+	kubeClient := dxtesting.NewFakeKubeClient(svc, pod, newMapperTestEndpoints("a", nil, nil))
+	c, err := NewTLBController(&TLBControllerConfig{
+		KubeClient:   kubeClient,
+		TLBLabelName: "ke-tlb/owner",
+		Namespace:    "ns",
+	})
+	if err != nil {
+		t.Fatalf("new tlb controller error, err: %v", err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c.Run(stopCh)
+	waitForTLBSync(t, c)
+
+	if _, err := c.ConvertAddr("10.0.0.1:20880"); err == nil {
+		t.Fatal("expected the addr missing from the mapper to fail to convert")
+	}
+	got, ok := c.ServiceOfAddr("10.0.0.1:20880")
+	if !ok || got.Name != "a" {
+		t.Errorf("expected service ns/a, got %v", got)
+	}
+	if got, ok := c.ServiceOfAddr("10.0.0.9:20880"); ok {
+		t.Errorf("expected no service of an unknown addr, got %v", got)
+	}
+}
+
+func newResolveTestPod(name string, phase v1.PodPhase, ready bool) *v1.Pod {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name, Labels: map[string]string{"app": "a"}},
+		Status: v1.PodStatus{
+			Phase:      phase,
+			PodIP:      "10.0.0.1",
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: status}},
+		},
+	}
+}
+
+func TestPodIPIndexFunc(t *testing.T) {
+	for _, phase := range []v1.PodPhase{v1.PodPending, v1.PodRunning} {
+		if ips, _ := PodIPIndexFunc(newResolveTestPod("a", phase, false)); len(ips) != 1 {
+			t.Errorf("expected a %s pod indexed, got %v", phase, ips)
+		}
+	}
+	for _, phase := range []v1.PodPhase{v1.PodSucceeded, v1.PodFailed} {
+		if ips, _ := PodIPIndexFunc(newResolveTestPod("a", phase, false)); len(ips) != 0 {
+			t.Errorf("expected a %s pod left out, got %v", phase, ips)
+		}
+	}
+}
+
+func TestTLBControllerResolvePodAddr(t *testing.T) {
+	svc := newMapperTestService("a", "192.168.0.1", 20880)
+	svc.Spec.Selector = map[string]string{"app": "a"}
+	tests := []struct {
+		name     string
+		pods     []*v1.Pod
+		expected string
+		err      error
+	}{
+		{
+			name:     "ready pod after a not ready one",
+			pods:     []*v1.Pod{newResolveTestPod("a-0", v1.PodRunning, false), newResolveTestPod("a-1", v1.PodRunning, true)},
+			expected: "192.168.0.1:20880",
+		},
+		{
+			name: "not ready pod",
+			pods: []*v1.Pod{newResolveTestPod("a-0", v1.PodRunning, false)},
+			err:  ErrNotReady,
+		},
+		{
+			name:     "terminated pod with the ip",
+			pods:     []*v1.Pod{newResolveTestPod("a-0", v1.PodFailed, false), newResolveTestPod("a-1", v1.PodRunning, true)},
+			expected: "192.168.0.1:20880",
+		},
+	}
+	for _, test := range tests {
+		objects := []runtime.Object{svc, newMapperTestEndpoints("a", nil, nil)}
+		for _, pod := range test.pods {
+			objects = append(objects, pod)
+		}
+		c, err := NewTLBController(&TLBControllerConfig{
+			KubeClient:   dxtesting.NewFakeKubeClient(objects...),
+			TLBLabelName: "ke-tlb/owner",
+			Namespace:    "ns",
+			ResolvePods:  true,
+		})
+		if err != nil {
+			t.Fatalf("%s: new tlb controller error, err: %v", test.name, err)
+		}
+		stopCh := make(chan struct{})
+		c.Run(stopCh)
+		waitForTLBSync(t, c)
+		got, err := c.ConvertAddr("10.0.0.1:20880")
+		close(stopCh)
+		if got != test.expected || err != test.err {
+			t.Errorf("%s: expected %q, %v, got %q, %v", test.name, test.expected, test.err, got, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// TLBSelector decides which services are tlb services, by a label selector
+// and optionally an annotation.
+type TLBSelector struct {
+	Labels labels.Selector
+	// AnnotationKey is required when set, with AnnotationValue when
+	// hasAnnotationValue
+	AnnotationKey      string
+	AnnotationValue    string
+	hasAnnotationValue bool
+}
+
+// NewTLBSelector parses a label selector, labelName existing when it is
+// empty, and an annotation given as key or key=value.
+func NewTLBSelector(labelName string, selector string, annotation string) (*TLBSelector, error) {
+	s := &TLBSelector{}
+	switch {
+	case selector != "":
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tlb selector %q, %v", selector, err)
+		}
+		if parsed.Empty() {
+			return nil, fmt.Errorf("tlb selector %q selects every service", selector)
+		}
+		s.Labels = parsed
+	case labelName != "":
+		r, err := labels.NewRequirement(labelName, selection.Exists, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tlb label name %q, %v", labelName, err)
+		}
+		s.Labels = labels.NewSelector().Add(*r)
+	default:
+		return nil, fmt.Errorf("tlb label name or selector is required")
+	}
+
+	if annotation != "" {
+		parts := strings.SplitN(annotation, "=", 2)
+		s.AnnotationKey = strings.TrimSpace(parts[0])
+		if errs := validation.IsQualifiedName(s.AnnotationKey); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid tlb annotation %q, %s", annotation, strings.Join(errs, ", "))
+		}
+		if len(parts) == 2 {
+			s.AnnotationValue = strings.TrimSpace(parts[1])
+			s.hasAnnotationValue = true
+		}
+	}
+	return s, nil
+}
+
+func (s *TLBSelector) Matches(svc *v1.Service) bool {
+	if !s.Labels.Matches(labels.Set(svc.Labels)) {
+		return false
+	}
+	if s.AnnotationKey == "" {
+		return true
+	}
+	value, ok := svc.Annotations[s.AnnotationKey]
+	return ok && (!s.hasAnnotationValue || value == s.AnnotationValue)
+}
+
+func (s *TLBSelector) String() string {
+	if s.AnnotationKey == "" {
+		return s.Labels.String()
+	}
+	annotation := s.AnnotationKey
+	if s.hasAnnotationValue {
+		annotation += "=" + s.AnnotationValue
+	}
+	return fmt.Sprintf("%s, annotation %s", s.Labels.String(), annotation)
+}
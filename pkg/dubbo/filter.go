@@ -0,0 +1,48 @@
+package dubbo
+
+import (
+	"path"
+)
+
+// ServiceFilter selects dubbo services (interface names) by glob patterns,
+// e.g. "com.example.*". An empty Include selects every service.
+type ServiceFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// MatchAny reports whether service matches one of the glob patterns.
+func MatchAny(patterns []string, service string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, service); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether service is selected, a nil filter selects every service.
+func (f *ServiceFilter) Match(service string) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Include) > 0 && !MatchAny(f.Include, service) {
+		return false
+	}
+	return !MatchAny(f.Exclude, service)
+}
+
+// Validate checks that every pattern is well formed.
+func (f *ServiceFilter) Validate() error {
+	if f == nil {
+		return nil
+	}
+	for _, patterns := range [][]string{f.Include, f.Exclude} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
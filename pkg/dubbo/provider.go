@@ -48,6 +48,14 @@ func (p *Provider) SetTimestamp() {
 	p.params["timestamp"] = ts
 }
 
+func (p *Provider) Param(key string) string {
+	return p.params[key]
+}
+
+func (p *Provider) SetParam(key string, value string) {
+	p.params[key] = value
+}
+
 func (p *Provider) Key() string {
 	return p.Url()
 }
@@ -60,13 +68,14 @@ func (p *Provider) Parse(url string) error {
 	// TODO: use RE
 	schemeAndOther := strings.Split(unescapedURL, "://")
 	p.scheme = schemeAndOther[0]
-	urlAndPath := strings.Split(schemeAndOther[1], "/")
+	// parameter values may hold slashes, the bridge key for instance
+	urlAndPath := strings.SplitN(schemeAndOther[1], "/", 2)
 	p.Addr = urlAndPath[0]
-	pathAndParams := strings.Split(urlAndPath[1], "?")
+	pathAndParams := strings.SplitN(urlAndPath[1], "?", 2)
 	p.Service = pathAndParams[0]
 	params := strings.Split(pathAndParams[1], "&")
 	for _, param := range params {
-		pSlice := strings.Split(param, "=")
+		pSlice := strings.SplitN(param, "=", 2)
 		k, v := pSlice[0], pSlice[1]
 		p.params[k] = v
 	}
@@ -0,0 +1,437 @@
+package provisioner
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	listersextensionsv1beta1 "k8s.io/client-go/listers/extensions/v1beta1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/whypro/dxinkube/pkg/converter"
+)
+
+const (
+	// ProvisionKey is the annotation of a Deployment or a Service asking for
+	// a load balancer service bridged by the tlb converter
+	ProvisionKey = "dxinkube/provision-tlb"
+	// ProvisionPortsKey lists the port names or numbers exposed, the ports
+	// named dubbo or numbered 20880 by default
+	ProvisionPortsKey = "dxinkube/provision-ports"
+	// ProvisionedLabel marks the services created by the provisioner
+	ProvisionedLabel = "dxinkube/provisioned"
+
+	defaultDubboPortName = "dubbo"
+	defaultDubboPort     = 20880
+	defaultNamePrefix    = "t-"
+)
+
+var (
+	deploymentKind = extensionsv1beta1.SchemeGroupVersion.WithKind("Deployment")
+	serviceKind    = v1.SchemeGroupVersion.WithKind("Service")
+)
+
+type ProvisionerConfig struct {
+	KubeConfig *rest.Config
+	// KubeClient is used instead of creating a client from KubeConfig when set
+	KubeClient   kubernetes.Interface
+	ResyncPeriod time.Duration
+	Namespace    string
+	// TLBLabelName labels the provisioned services so the tlb converter
+	// picks them up
+	TLBLabelName string
+	// TLBSelector selects the hand written tlb services, which are never
+	// sources. Services labelled TLBLabelName are skipped either way.
+	TLBSelector *converter.TLBSelector
+	// NamePrefix prefixes the name of the source in the provisioned
+	// services, "t-" by default
+	NamePrefix string
+}
+
+// Provisioner creates, updates and deletes the load balancer services of
+// the Deployments and Services annotated with ProvisionKey. The services are
+// owned by their source, so they are garbage collected with it.
+type Provisioner struct {
+	config     *ProvisionerConfig
+	kubeClient kubernetes.Interface
+	queue      chan struct{}
+	lock       sync.Mutex
+
+	informerFactory  informers.SharedInformerFactory
+	deploymentLister listersextensionsv1beta1.DeploymentLister
+	serviceLister    listersv1.ServiceLister
+	informersSynced  []cache.InformerSynced
+}
+
+func NewProvisioner(config *ProvisionerConfig) (*Provisioner, error) {
+	if config.TLBLabelName == "" {
+		return nil, fmt.Errorf("tlb label name is required")
+	}
+	if config.NamePrefix == "" {
+		config.NamePrefix = defaultNamePrefix
+	}
+
+	kubeClient := config.KubeClient
+	if kubeClient == nil {
+		var err error
+		kubeClient, err = kubernetes.NewForConfig(config.KubeConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create kubernetes client")
+		}
+	}
+
+	informerFactory := informers.NewSharedInformerFactory(kubeClient, config.ResyncPeriod)
+	deploymentInformer := informerFactory.Extensions().V1beta1().Deployments()
+	serviceInformer := informerFactory.Core().V1().Services()
+
+	p := &Provisioner{
+		config:     config,
+		kubeClient: kubeClient,
+		queue:      make(chan struct{}, 1),
+
+		informerFactory:  informerFactory,
+		deploymentLister: deploymentInformer.Lister(),
+		serviceLister:    serviceInformer.Lister(),
+		informersSynced: []cache.InformerSynced{
+			deploymentInformer.Informer().HasSynced,
+			serviceInformer.Informer().HasSynced,
+		},
+	}
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { p.enqueue() },
+		UpdateFunc: func(oldObj, newObj interface{}) { p.enqueue() },
+		DeleteFunc: func(obj interface{}) { p.enqueue() },
+	}
+	deploymentInformer.Informer().AddEventHandler(handler)
+	serviceInformer.Informer().AddEventHandler(handler)
+
+	return p, nil
+}
+
+func (p *Provisioner) enqueue() {
+	select {
+	case p.queue <- struct{}{}:
+	default:
+	}
+}
+
+func (p *Provisioner) Run(stopCh <-chan struct{}) {
+	p.informerFactory.Start(stopCh)
+	// services missing from partial caches would be created again, and
+	// sources missing would have their services deleted
+	if !cache.WaitForCacheSync(stopCh, p.informersSynced...) {
+		glog.Errorf("wait for provisioner caches to sync error")
+		return
+	}
+	go func() {
+		for {
+			select {
+			case <-p.queue:
+				p.Refresh()
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	go wait.Until(p.Refresh, 30*time.Second, stopCh)
+}
+
+func wantsProvision(annotations map[string]string) bool {
+	provision, _ := strconv.ParseBool(annotations[ProvisionKey])
+	return provision
+}
+
+// portSelector tells which ports are exposed from the ProvisionPortsKey
+// annotation.
+func portSelector(annotations map[string]string) func(name string, port int32) bool {
+	value := strings.TrimSpace(annotations[ProvisionPortsKey])
+	if value == "" {
+		return func(name string, port int32) bool {
+			return name == defaultDubboPortName || port == defaultDubboPort
+		}
+	}
+	wanted := make(map[string]bool)
+	for _, p := range strings.Split(value, ",") {
+		wanted[strings.TrimSpace(p)] = true
+	}
+	return func(name string, port int32) bool {
+		return (name != "" && wanted[name]) || wanted[strconv.Itoa(int(port))]
+	}
+}
+
+func (p *Provisioner) newService(owner metav1.Object, gvk schema.GroupVersionKind, selector map[string]string, ports []v1.ServicePort) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: owner.GetNamespace(),
+			Name:      p.config.NamePrefix + owner.GetName(),
+			Labels: map[string]string{
+				p.config.TLBLabelName: owner.GetName(),
+				ProvisionedLabel:      "true",
+			},
+			// the tlb converter takes it for a tlb service whatever its
+			// selector
+			Annotations: map[string]string{
+				converter.ExposeKey: converter.ExposeLoadBalancer,
+			},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(owner, gvk)},
+		},
+		Spec: v1.ServiceSpec{
+			Type:                  v1.ServiceTypeLoadBalancer,
+			ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyTypeCluster,
+			Selector:              selector,
+			Ports:                 ports,
+		},
+	}
+}
+
+// serviceOfDeployment returns the service of an annotated deployment, nil if
+// it can not be expressed as a service selector or exposes no port.
+func (p *Provisioner) serviceOfDeployment(d *extensionsv1beta1.Deployment) *v1.Service {
+	if d.Spec.Selector == nil || len(d.Spec.Selector.MatchExpressions) > 0 || len(d.Spec.Selector.MatchLabels) == 0 {
+		glog.Warningf("deployment selector can not be used by a service, ns: %s, name: %s", d.Namespace, d.Name)
+		return nil
+	}
+	match := portSelector(d.Annotations)
+	ports := make([]v1.ServicePort, 0)
+	seen := make(map[int32]bool)
+	for _, container := range d.Spec.Template.Spec.Containers {
+		for _, port := range container.Ports {
+			if !match(port.Name, port.ContainerPort) || seen[port.ContainerPort] {
+				continue
+			}
+			seen[port.ContainerPort] = true
+			ports = append(ports, v1.ServicePort{
+				Name:       port.Name,
+				Protocol:   port.Protocol,
+				Port:       port.ContainerPort,
+				TargetPort: intstr.FromInt(int(port.ContainerPort)),
+			})
+		}
+	}
+	if len(ports) == 0 {
+		glog.Warningf("deployment exposes no dubbo port, ns: %s, name: %s", d.Namespace, d.Name)
+		return nil
+	}
+	return p.newService(d, deploymentKind, d.Spec.Selector.MatchLabels, ports)
+}
+
+// serviceOfService returns the load balancer copy of an annotated service.
+func (p *Provisioner) serviceOfService(svc *v1.Service) *v1.Service {
+	if len(svc.Spec.Selector) == 0 {
+		glog.Warningf("service has no selector, ns: %s, name: %s", svc.Namespace, svc.Name)
+		return nil
+	}
+	match := portSelector(svc.Annotations)
+	ports := make([]v1.ServicePort, 0)
+	for _, port := range svc.Spec.Ports {
+		if !match(port.Name, port.Port) {
+			continue
+		}
+		ports = append(ports, v1.ServicePort{
+			Name:       port.Name,
+			Protocol:   port.Protocol,
+			Port:       port.Port,
+			TargetPort: port.TargetPort,
+		})
+	}
+	if len(ports) == 0 {
+		glog.Warningf("service exposes no dubbo port, ns: %s, name: %s", svc.Namespace, svc.Name)
+		return nil
+	}
+	return p.newService(svc, serviceKind, svc.Spec.Selector, ports)
+}
+
+// desiredServices returns the provisioned services by namespace/name.
+// Sources are visited in order, the first one wins a name conflict.
+func (p *Provisioner) desiredServices() (map[string]*v1.Service, error) {
+	desired := make(map[string]*v1.Service)
+	add := func(svc *v1.Service) {
+		if svc == nil {
+			return
+		}
+		key := svc.Namespace + "/" + svc.Name
+		if _, ok := desired[key]; ok {
+			glog.Warningf("provisioned service name conflict, ns: %s, name: %s", svc.Namespace, svc.Name)
+			return
+		}
+		desired[key] = svc
+	}
+
+	deployments, err := p.deploymentLister.Deployments(p.config.Namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(deployments, func(i, j int) bool {
+		return deployments[i].Namespace+"/"+deployments[i].Name < deployments[j].Namespace+"/"+deployments[j].Name
+	})
+	for _, d := range deployments {
+		if wantsProvision(d.Annotations) && d.DeletionTimestamp == nil {
+			add(p.serviceOfDeployment(d))
+		}
+	}
+
+	services, err := p.serviceLister.Services(p.config.Namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Namespace+"/"+services[i].Name < services[j].Namespace+"/"+services[j].Name
+	})
+	for _, svc := range services {
+		// provisioned and hand written tlb services are never sources
+		if p.isTLBService(svc) {
+			continue
+		}
+		if wantsProvision(svc.Annotations) && svc.DeletionTimestamp == nil {
+			add(p.serviceOfService(svc))
+		}
+	}
+	return desired, nil
+}
+
+func (p *Provisioner) isTLBService(svc *v1.Service) bool {
+	if _, ok := svc.Labels[p.config.TLBLabelName]; ok {
+		return true
+	}
+	return p.config.TLBSelector != nil && p.config.TLBSelector.Matches(svc)
+}
+
+// mergeService returns current updated to desired, keeping the fields set by
+// the api server, or nil when there is nothing to update.
+func mergeService(current *v1.Service, desired *v1.Service) *v1.Service {
+	nodePorts := make(map[string]int32)
+	for _, port := range current.Spec.Ports {
+		nodePorts[port.Name+"/"+strconv.Itoa(int(port.Port))] = port.NodePort
+	}
+	ports := make([]v1.ServicePort, 0, len(desired.Spec.Ports))
+	for _, port := range desired.Spec.Ports {
+		port.NodePort = nodePorts[port.Name+"/"+strconv.Itoa(int(port.Port))]
+		if port.Protocol == "" {
+			port.Protocol = v1.ProtocolTCP
+		}
+		ports = append(ports, port)
+	}
+
+	annotated := true
+	for k, v := range desired.Annotations {
+		if current.Annotations[k] != v {
+			annotated = false
+		}
+	}
+	if annotated &&
+		reflect.DeepEqual(current.Spec.Selector, desired.Spec.Selector) &&
+		reflect.DeepEqual(current.Spec.Ports, ports) &&
+		current.Spec.Type == desired.Spec.Type &&
+		current.Spec.ExternalTrafficPolicy == desired.Spec.ExternalTrafficPolicy &&
+		reflect.DeepEqual(current.Labels, desired.Labels) {
+		return nil
+	}
+	updated := current.DeepCopy()
+	updated.Labels = desired.Labels
+	if updated.Annotations == nil {
+		updated.Annotations = make(map[string]string)
+	}
+	for k, v := range desired.Annotations {
+		updated.Annotations[k] = v
+	}
+	updated.Spec.Type = desired.Spec.Type
+	if updated.Spec.ExternalTrafficPolicy != desired.Spec.ExternalTrafficPolicy {
+		updated.Spec.ExternalTrafficPolicy = desired.Spec.ExternalTrafficPolicy
+		// the health check node port is only allocated for the Local policy
+		if desired.Spec.ExternalTrafficPolicy != v1.ServiceExternalTrafficPolicyTypeLocal {
+			updated.Spec.HealthCheckNodePort = 0
+		}
+	}
+	updated.Spec.Selector = desired.Spec.Selector
+	updated.Spec.Ports = ports
+	return updated
+}
+
+func (p *Provisioner) Refresh() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	desired, err := p.desiredServices()
+	if err != nil {
+		glog.Errorf("list provision sources error, err: %v", err)
+		return
+	}
+
+	selector := labels.SelectorFromSet(labels.Set{ProvisionedLabel: "true"})
+	provisioned, err := p.serviceLister.Services(p.config.Namespace).List(selector)
+	if err != nil {
+		glog.Errorf("list provisioned services error, err: %v", err)
+		return
+	}
+	current := make(map[string]*v1.Service)
+	for _, svc := range provisioned {
+		current[svc.Namespace+"/"+svc.Name] = svc
+	}
+
+	for key, svc := range desired {
+		existing, ok := current[key]
+		if !ok {
+			existing, err = p.serviceLister.Services(svc.Namespace).Get(svc.Name)
+			if err == nil {
+				glog.Warningf("service exists and is not provisioned, ns: %s, name: %s", svc.Namespace, svc.Name)
+				continue
+			}
+			if !apierrors.IsNotFound(err) {
+				glog.Errorf("get service error, ns: %s, name: %s, err: %v", svc.Namespace, svc.Name, err)
+				continue
+			}
+			glog.Infof("create provisioned service, ns: %s, name: %s", svc.Namespace, svc.Name)
+			if _, err := p.kubeClient.CoreV1().Services(svc.Namespace).Create(svc); err != nil {
+				glog.Errorf("create provisioned service error, ns: %s, name: %s, err: %v", svc.Namespace, svc.Name, err)
+			}
+			continue
+		}
+		if ref := metav1.GetControllerOf(existing); ref == nil || ref.UID != svc.OwnerReferences[0].UID {
+			glog.Warningf("provisioned service is owned by another source, ns: %s, name: %s", svc.Namespace, svc.Name)
+			continue
+		}
+		updated := mergeService(existing, svc)
+		if updated == nil {
+			continue
+		}
+		glog.Infof("update provisioned service, ns: %s, name: %s", svc.Namespace, svc.Name)
+		if _, err := p.kubeClient.CoreV1().Services(svc.Namespace).Update(updated); err != nil {
+			glog.Errorf("update provisioned service error, ns: %s, name: %s, err: %v", svc.Namespace, svc.Name, err)
+		}
+	}
+
+	// services whose source is deleted are garbage collected by kubernetes,
+	// those whose source dropped the annotation are deleted here
+	for key, svc := range current {
+		if _, ok := desired[key]; ok {
+			continue
+		}
+		if metav1.GetControllerOf(svc) == nil {
+			continue
+		}
+		glog.Infof("delete provisioned service, ns: %s, name: %s", svc.Namespace, svc.Name)
+		err := p.kubeClient.CoreV1().Services(svc.Namespace).Delete(svc.Name, &metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			glog.Errorf("delete provisioned service error, ns: %s, name: %s, err: %v", svc.Namespace, svc.Name, err)
+		}
+	}
+}
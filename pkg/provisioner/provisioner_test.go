@@ -0,0 +1,95 @@
+package provisioner
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/whypro/dxinkube/pkg/converter"
+)
+
+func TestMergeService(t *testing.T) {
+	desired := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "ns",
+			Name:      "t-dp",
+			Labels:    map[string]string{"ke-tlb/owner": "dp", ProvisionedLabel: "true"},
+			Annotations: map[string]string{
+				converter.ExposeKey: converter.ExposeLoadBalancer,
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Type:                  v1.ServiceTypeLoadBalancer,
+			ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyTypeCluster,
+			Selector:              map[string]string{"app": "dp"},
+			Ports:                 []v1.ServicePort{{Name: "dubbo", Port: 20880, TargetPort: intstr.FromInt(20880)}},
+		},
+	}
+	// current is desired as written back by the api server
+	current := desired.DeepCopy()
+	current.ResourceVersion = "1"
+	current.Spec.ClusterIP = "10.96.0.10"
+	current.Spec.Ports[0].Protocol = v1.ProtocolTCP
+	current.Spec.Ports[0].NodePort = 30880
+
+	if updated := mergeService(current, desired); updated != nil {
+		t.Errorf("expected no update, got %+v", updated.Spec)
+	}
+
+	local := current.DeepCopy()
+	local.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+	local.Spec.HealthCheckNodePort = 31000
+	updated := mergeService(local, desired)
+	if updated == nil {
+		t.Fatal("expected the external traffic policy to be updated")
+	}
+	if !reflect.DeepEqual(updated, current) {
+		t.Errorf("expected %+v, got %+v", current.Spec, updated.Spec)
+	}
+
+	// services provisioned before they were annotated get the expose
+	// annotation, the others are kept
+	unannotated := current.DeepCopy()
+	unannotated.Annotations = map[string]string{"owner": "team"}
+	updated = mergeService(unannotated, desired)
+	if updated == nil {
+		t.Fatal("expected the expose annotation to be added")
+	}
+	expected := map[string]string{"owner": "team", converter.ExposeKey: converter.ExposeLoadBalancer}
+	if !reflect.DeepEqual(updated.Annotations, expected) {
+		t.Errorf("expected annotations %v, got %v", expected, updated.Annotations)
+	}
+
+	ports := current.DeepCopy()
+	ports.Spec.Ports[0].Port = 20881
+	updated = mergeService(ports, desired)
+	if updated == nil || updated.Spec.Ports[0].Port != 20880 || updated.Spec.Ports[0].NodePort != 0 {
+		t.Errorf("expected the port updated with a new node port, got %+v", updated)
+	}
+}
+
+func TestIsTLBService(t *testing.T) {
+	selector, err := converter.NewTLBSelector("ke-tlb/owner", "tlb=true", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Provisioner{config: &ProvisionerConfig{TLBLabelName: "ke-tlb/owner", TLBSelector: selector}}
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		expected bool
+	}{
+		{name: "provisioned", labels: map[string]string{"ke-tlb/owner": "dp"}, expected: true},
+		{name: "selected", labels: map[string]string{"tlb": "true"}, expected: true},
+		{name: "source", labels: map[string]string{"app": "dp"}, expected: false},
+	}
+	for _, test := range tests {
+		svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Labels: test.labels}}
+		if got := p.isTLBService(svc); got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package registry
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/whypro/dxinkube/pkg/dubbo"
+)
+
+// DryRunRecord is a mutation that would have been applied to a registry.
+type DryRunRecord struct {
+	URL       string    `json:"url"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Count     int       `json:"count"`
+}
+
+type DryRunSummary struct {
+	Created []DryRunRecord `json:"created"`
+	Deleted []DryRunRecord `json:"deleted"`
+}
+
+// DryRunRegistry wraps a registry, listing is delegated while Register and
+// UnRegister are only recorded. Since nothing is applied the same mutations
+// are attempted on every reconcile, records not attempted again within
+// expiry are dropped from the summary.
+type DryRunRegistry struct {
+	delegate Interface
+	expiry   time.Duration
+
+	lock    sync.Mutex
+	created map[string]*DryRunRecord
+	deleted map[string]*DryRunRecord
+	// now is replaced in tests
+	now func() time.Time
+}
+
+func NewDryRunRegistry(delegate Interface, expiry time.Duration) *DryRunRegistry {
+	return &DryRunRegistry{
+		delegate: delegate,
+		expiry:   expiry,
+		created:  make(map[string]*DryRunRecord),
+		deleted:  make(map[string]*DryRunRecord),
+		now:      time.Now,
+	}
+}
+
+func (r *DryRunRegistry) record(records map[string]*DryRunRecord, provider *dubbo.Provider) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := r.now()
+	record, ok := records[provider.Key()]
+	if !ok {
+		record = &DryRunRecord{FirstSeen: now}
+		records[provider.Key()] = record
+	}
+	record.URL = provider.String()
+	record.LastSeen = now
+	record.Count++
+}
+
+func (r *DryRunRegistry) Register(provider *dubbo.Provider) error {
+	glog.V(4).Infof("[dry-run] register provider %s", provider)
+	r.record(r.created, provider)
+	return nil
+}
+
+func (r *DryRunRegistry) UnRegister(provider *dubbo.Provider) error {
+	glog.V(4).Infof("[dry-run] unregister provider %s", provider)
+	r.record(r.deleted, provider)
+	return nil
+}
+
+func (r *DryRunRegistry) ListProviders() ([]string, error) {
+	return r.delegate.ListProviders()
+}
+
+func (r *DryRunRegistry) summarize(records map[string]*DryRunRecord, now time.Time) []DryRunRecord {
+	summary := make([]DryRunRecord, 0, len(records))
+	for key, record := range records {
+		if now.Sub(record.LastSeen) > r.expiry {
+			delete(records, key)
+			continue
+		}
+		summary = append(summary, *record)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		return summary[i].URL < summary[j].URL
+	})
+	return summary
+}
+
+func (r *DryRunRegistry) Summary() DryRunSummary {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := r.now()
+	return DryRunSummary{
+		Created: r.summarize(r.created, now),
+		Deleted: r.summarize(r.deleted, now),
+	}
+}
@@ -0,0 +1,67 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/whypro/dxinkube/pkg/dubbo"
+	dxtesting "github.com/whypro/dxinkube/pkg/testing"
+)
+
+func newDryRunTestProvider(t *testing.T, url string) *dubbo.Provider {
+	provider := dubbo.NewProvider()
+	if err := provider.Parse(url); err != nil {
+		t.Fatalf("parse provider error, err: %v", err)
+	}
+	return provider
+}
+
+func TestDryRunRegistry(t *testing.T) {
+	delegate := dxtesting.NewFakeRegistry("dubbo://2.2.2.2:20880/com.foo.Gone?anyhost=true")
+	r := NewDryRunRegistry(delegate, time.Minute)
+	start := time.Date(2018, 5, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	r.now = func() time.Time { return now }
+
+	created := newDryRunTestProvider(t, "dubbo://2.2.2.1:20880/com.foo.Bar?anyhost=true")
+	deleted := newDryRunTestProvider(t, "dubbo://2.2.2.2:20880/com.foo.Gone?anyhost=true")
+	for i := 0; i < 2; i++ {
+		if err := r.Register(created); err != nil {
+			t.Fatalf("register error, err: %v", err)
+		}
+		if err := r.UnRegister(deleted); err != nil {
+			t.Fatalf("unregister error, err: %v", err)
+		}
+		now = now.Add(10 * time.Second)
+	}
+
+	// listing is delegated, mutations never are
+	urls, err := r.ListProviders()
+	if err != nil || len(urls) != 1 {
+		t.Errorf("expected the delegate providers listed, got %v, err: %v", urls, err)
+	}
+	if actions := delegate.Actions(); len(actions) != 1 || actions[0].Verb != dxtesting.VerbList {
+		t.Errorf("expected only the list action on the delegate, got %+v", actions)
+	}
+
+	expected := DryRunSummary{
+		Created: []DryRunRecord{{URL: created.String(), FirstSeen: start, LastSeen: start.Add(10 * time.Second), Count: 2}},
+		Deleted: []DryRunRecord{{URL: deleted.String(), FirstSeen: start, LastSeen: start.Add(10 * time.Second), Count: 2}},
+	}
+	if summary := r.Summary(); !reflect.DeepEqual(summary, expected) {
+		t.Errorf("expected summary %+v, got %+v", expected, summary)
+	}
+
+	// records not attempted again within the expiry are dropped
+	now = start.Add(time.Minute + 15*time.Second)
+	r.Register(created)
+	summary := r.Summary()
+	if len(summary.Created) != 1 || len(summary.Deleted) != 0 {
+		t.Errorf("expected only the created record kept, got %+v", summary)
+	}
+	now = now.Add(time.Minute + time.Second)
+	if summary := r.Summary(); len(summary.Created) != 0 || len(summary.Deleted) != 0 {
+		t.Errorf("expected every record expired, got %+v", summary)
+	}
+}
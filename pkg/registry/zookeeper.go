@@ -17,11 +17,23 @@ type ZookeeperConfig struct {
 	DubboProviderCategory     string
 	DubboConfiguratorCategory string
 	ConnectionTimeout         time.Duration
+	// AuthScheme and AuthCredential are passed to AddAuth after connecting,
+	// e.g. "digest" and "user:password"
+	AuthScheme     string
+	AuthCredential string
+}
+
+// ZKConn is the subset of *zk.Conn used by ZookeeperRegistry.
+type ZKConn interface {
+	Exists(path string) (bool, *zk.Stat, error)
+	Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+	Delete(path string, version int32) error
+	Children(path string) ([]string, *zk.Stat, error)
 }
 
 type ZookeeperRegistry struct {
 	config *ZookeeperConfig
-	conn   *zk.Conn
+	conn   ZKConn
 }
 
 func NewZookeeperRegistry(config *ZookeeperConfig) (*ZookeeperRegistry, error) {
@@ -30,12 +42,25 @@ func NewZookeeperRegistry(config *ZookeeperConfig) (*ZookeeperRegistry, error) {
 		glog.Errorf("connect to zk error, addrs: %+v, err: %v", config.ServerAddrs, err)
 		return nil, err
 	}
+	if config.AuthScheme != "" {
+		err = conn.AddAuth(config.AuthScheme, []byte(config.AuthCredential))
+		if err != nil {
+			glog.Errorf("add zk auth error, addrs: %+v, scheme: %s, err: %v", config.ServerAddrs, config.AuthScheme, err)
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return NewZookeeperRegistryWithConn(config, conn), nil
+}
 
-	registry := &ZookeeperRegistry{
+// NewZookeeperRegistryWithConn creates a registry on top of an established
+// connection, config.ServerAddrs and config.ConnectionTimeout are ignored.
+func NewZookeeperRegistryWithConn(config *ZookeeperConfig, conn ZKConn) *ZookeeperRegistry {
+	return &ZookeeperRegistry{
 		config: config,
 		conn:   conn,
 	}
-	return registry, nil
 }
 
 func (r *ZookeeperRegistry) ensurePath(path string) error {
@@ -54,7 +79,8 @@ func (r *ZookeeperRegistry) ensurePath(path string) error {
 		}
 		if exists == false {
 			_, err := r.conn.Create(currentPath, []byte(""), 0, zk.WorldACL(zk.PermAll))
-			if err != nil {
+			// the path may be created concurrently by another writer
+			if err != nil && err != zk.ErrNodeExists {
 				glog.Errorf("create path %s error, %v", currentPath, err)
 				return err
 			}
@@ -0,0 +1,47 @@
+package testing
+
+import (
+	"fmt"
+	"sync"
+)
+
+// FakeAddrConverter is a converter.AddrConverterInterface backed by a static
+// podAddr -> addr map.
+type FakeAddrConverter struct {
+	lock  sync.RWMutex
+	addrs map[string]string
+}
+
+func NewFakeAddrConverter(addrs map[string]string) *FakeAddrConverter {
+	c := &FakeAddrConverter{
+		addrs: make(map[string]string),
+	}
+	for podAddr, addr := range addrs {
+		c.addrs[podAddr] = addr
+	}
+	return c
+}
+
+func (c *FakeAddrConverter) Set(podAddr string, addr string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.addrs[podAddr] = addr
+}
+
+func (c *FakeAddrConverter) Delete(podAddr string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.addrs, podAddr)
+}
+
+func (c *FakeAddrConverter) ConvertAddr(podAddr string) (string, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	addr, ok := c.addrs[podAddr]
+	if !ok {
+		return "", fmt.Errorf("podAddr %s is not in fake converter", podAddr)
+	}
+	return addr, nil
+}
+
+func (c *FakeAddrConverter) Run(stopCh <-chan struct{}) {}
@@ -0,0 +1,4 @@
+// Package testing provides in-memory fakes of the registry and address
+// converter interfaces, so controllers can be exercised without live
+// ZooKeeper or Kubernetes connections.
+package testing
@@ -0,0 +1,210 @@
+// Package harness drives the bridge end to end on a fake clientset and
+// in-memory ZooKeeper stand-ins, with scripted scenarios asserting on the
+// remote registry.
+package harness
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/whypro/dxinkube/pkg/controller"
+	"github.com/whypro/dxinkube/pkg/converter"
+	"github.com/whypro/dxinkube/pkg/dubbo"
+	"github.com/whypro/dxinkube/pkg/registry"
+	dxtesting "github.com/whypro/dxinkube/pkg/testing"
+)
+
+const (
+	TLBLabelName        = "ke-tlb/owner"
+	harnessPollInterval = 50 * time.Millisecond
+	harnessPollTimeout  = 5 * time.Second
+)
+
+// Harness wires a TLBController on a fake clientset and two
+// ZookeeperRegistry instances on in-memory ZooKeeper stand-ins into a
+// ProviderManager, so the whole bridge can be driven end to end.
+type Harness struct {
+	Namespace string
+
+	KubeClient     *dxtesting.FakeKubeClient
+	LocalZK        *dxtesting.FakeZKConn
+	RemoteZK       *dxtesting.FakeZKConn
+	LocalRegistry  *registry.ZookeeperRegistry
+	RemoteRegistry *registry.ZookeeperRegistry
+	Converter      *converter.TLBController
+	Manager        *controller.ProviderManager
+
+	stopCh chan struct{}
+}
+
+func newHarnessZKConfig() *registry.ZookeeperConfig {
+	return &registry.ZookeeperConfig{
+		DubboRootPath:             "/dubbo",
+		DubboProviderCategory:     "providers",
+		DubboConfiguratorCategory: "configurators",
+	}
+}
+
+func NewHarness(namespace string, objects ...runtime.Object) (*Harness, error) {
+	kubeClient := dxtesting.NewFakeKubeClient(objects...)
+	tlbController, err := converter.NewTLBController(&converter.TLBControllerConfig{
+		KubeClient:   kubeClient,
+		TLBLabelName: TLBLabelName,
+		ResyncPeriod: 0,
+		Namespace:    namespace,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	localZK := dxtesting.NewFakeZKConn()
+	remoteZK := dxtesting.NewFakeZKConn()
+	localRegistry := registry.NewZookeeperRegistryWithConn(newHarnessZKConfig(), localZK)
+	remoteRegistry := registry.NewZookeeperRegistryWithConn(newHarnessZKConfig(), remoteZK)
+	// the dubbo root path always exists on a real registry
+	for _, conn := range []*dxtesting.FakeZKConn{localZK, remoteZK} {
+		if _, err := conn.Create("/dubbo", nil, 0, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Harness{
+		Namespace:      namespace,
+		KubeClient:     kubeClient,
+		LocalZK:        localZK,
+		RemoteZK:       remoteZK,
+		LocalRegistry:  localRegistry,
+		RemoteRegistry: remoteRegistry,
+		Converter:      tlbController,
+		Manager:        controller.NewProviderManager("", tlbController, localRegistry, controller.NewRemoteRegistry("remote", remoteRegistry, nil)),
+		stopCh:         make(chan struct{}),
+	}, nil
+}
+
+// Start runs the converter informers. The ProviderManager is not started,
+// reconciles are driven by Sync so that scenarios stay deterministic.
+func (h *Harness) Start() {
+	h.Converter.Run(h.stopCh)
+}
+
+func (h *Harness) Stop() {
+	close(h.stopCh)
+}
+
+func (h *Harness) Sync() {
+	h.Converter.RefreshTLBMapper()
+	h.Manager.Refresh()
+}
+
+func (h *Harness) RegisterLocal(url string) error {
+	provider := dubbo.NewProvider()
+	if err := provider.Parse(url); err != nil {
+		return err
+	}
+	return h.LocalRegistry.Register(provider)
+}
+
+func (h *Harness) UnRegisterLocal(url string) error {
+	provider := dubbo.NewProvider()
+	if err := provider.Parse(url); err != nil {
+		return err
+	}
+	return h.LocalRegistry.UnRegister(provider)
+}
+
+// RemoteKeys returns the provider keys currently in the remote registry, sorted.
+func (h *Harness) RemoteKeys() ([]string, error) {
+	urls, err := h.RemoteRegistry.ListProviders()
+	if err != nil {
+		return nil, err
+	}
+	return dxtesting.ProviderKeys(urls), nil
+}
+
+// ExpectRemote syncs until the remote registry holds exactly keys, informers
+// catch up asynchronously so a single sync is not enough.
+func (h *Harness) ExpectRemote(keys ...string) error {
+	expected := append([]string{}, keys...)
+	sort.Strings(expected)
+	var actual []string
+	err := wait.Poll(harnessPollInterval, harnessPollTimeout, func() (bool, error) {
+		h.Sync()
+		var err error
+		actual, err = h.RemoteKeys()
+		if err != nil {
+			return false, nil
+		}
+		return reflect.DeepEqual(actual, expected), nil
+	})
+	if err != nil {
+		return fmt.Errorf("remote registry mismatch, expected: %v, actual: %v", expected, actual)
+	}
+	h.RemoteZK.ClearDeleted()
+	return nil
+}
+
+// ExpectNoRemoteDeletion checks that no remote provider was deleted since
+// the remote registry last matched, a provider deleted and registered again
+// in between would otherwise go unnoticed.
+func (h *Harness) ExpectNoRemoteDeletion() error {
+	deleted := make([]string, 0)
+	for _, path := range h.RemoteZK.Deleted() {
+		if strings.Contains(path, "/providers/") {
+			deleted = append(deleted, path)
+		}
+	}
+	if len(deleted) > 0 {
+		return fmt.Errorf("remote providers deleted, %v", deleted)
+	}
+	return nil
+}
+
+// NewTLBService returns a LoadBalancer service labelled as a TLB service,
+// ingressIP may be empty for a load balancer that is not provisioned yet.
+func NewTLBService(namespace, name string, port int32, ingressIP string) *v1.Service {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    map[string]string{TLBLabelName: name},
+		},
+		Spec: v1.ServiceSpec{
+			Type:  v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{{Name: "dubbo", Port: port}},
+		},
+	}
+	if ingressIP != "" {
+		svc.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: ingressIP}}
+	}
+	return svc
+}
+
+// NewTLBEndpoints returns the endpoints of a TLB service with podIPs ready.
+func NewTLBEndpoints(namespace, name string, port int32, podIPs ...string) *v1.Endpoints {
+	ep := &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    map[string]string{TLBLabelName: name},
+		},
+	}
+	if len(podIPs) == 0 {
+		return ep
+	}
+	subset := v1.EndpointSubset{
+		Ports: []v1.EndpointPort{{Name: "dubbo", Port: port}},
+	}
+	for _, ip := range podIPs {
+		subset.Addresses = append(subset.Addresses, v1.EndpointAddress{IP: ip})
+	}
+	ep.Subsets = []v1.EndpointSubset{subset}
+	return ep
+}
@@ -0,0 +1,14 @@
+package harness
+
+import "testing"
+
+func TestScenarios(t *testing.T) {
+	for _, scenario := range Scenarios() {
+		scenario := scenario
+		t.Run(scenario.Name, func(t *testing.T) {
+			if err := scenario.Run(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
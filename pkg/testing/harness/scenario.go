@@ -0,0 +1,197 @@
+package harness
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	scenarioNamespace = "default"
+	scenarioService   = "t-dubbo-provider"
+	scenarioInterface = "com.example.DemoService"
+	scenarioPort      = 20880
+	scenarioTLBIP     = "192.168.0.100"
+)
+
+// Step is a single scripted action of a Scenario.
+type Step struct {
+	Name string
+	Run  func(h *Harness) error
+}
+
+// Scenario is a scripted sequence of cluster and registry changes, each
+// followed by assertions on the remote registry.
+type Scenario struct {
+	Name    string
+	Objects []runtime.Object
+	Steps   []Step
+}
+
+// Run executes the scenario on a fresh harness.
+func (s Scenario) Run() error {
+	h, err := NewHarness(scenarioNamespace, s.Objects...)
+	if err != nil {
+		return err
+	}
+	h.Start()
+	defer h.Stop()
+
+	for _, step := range s.Steps {
+		if err := step.Run(h); err != nil {
+			return fmt.Errorf("scenario %q step %q failed: %v", s.Name, step.Name, err)
+		}
+	}
+	return nil
+}
+
+func scenarioProviderURL(podIP string) string {
+	return fmt.Sprintf("dubbo://%s:%d/%s?anyhost=true&application=demo&interface=%s", podIP, scenarioPort, scenarioInterface, scenarioInterface)
+}
+
+func scenarioRemoteKey() string {
+	return fmt.Sprintf("dubbo://%s:%d/%s", scenarioTLBIP, scenarioPort, scenarioInterface)
+}
+
+func registerLocal(podIP string) Step {
+	return Step{
+		Name: "register local provider " + podIP,
+		Run: func(h *Harness) error {
+			return h.RegisterLocal(scenarioProviderURL(podIP))
+		},
+	}
+}
+
+func unRegisterLocal(podIP string) Step {
+	return Step{
+		Name: "unregister local provider " + podIP,
+		Run: func(h *Harness) error {
+			return h.UnRegisterLocal(scenarioProviderURL(podIP))
+		},
+	}
+}
+
+func setEndpoints(podIPs ...string) Step {
+	return Step{
+		Name: fmt.Sprintf("set endpoints %v", podIPs),
+		Run: func(h *Harness) error {
+			ep := NewTLBEndpoints(scenarioNamespace, scenarioService, scenarioPort, podIPs...)
+			_, err := h.KubeClient.CoreV1().Endpoints(scenarioNamespace).Update(ep)
+			return err
+		},
+	}
+}
+
+func setIngress(ip string) Step {
+	return Step{
+		Name: "set load balancer ingress " + ip,
+		Run: func(h *Harness) error {
+			svc := NewTLBService(scenarioNamespace, scenarioService, scenarioPort, ip)
+			_, err := h.KubeClient.CoreV1().Services(scenarioNamespace).Update(svc)
+			return err
+		},
+	}
+}
+
+func deleteService() Step {
+	return Step{
+		Name: "delete service",
+		Run: func(h *Harness) error {
+			err := h.KubeClient.CoreV1().Services(scenarioNamespace).Delete(scenarioService, &metav1.DeleteOptions{})
+			if err != nil {
+				return err
+			}
+			return h.KubeClient.CoreV1().Endpoints(scenarioNamespace).Delete(scenarioService, &metav1.DeleteOptions{})
+		},
+	}
+}
+
+func expectRemote(keys ...string) Step {
+	return Step{
+		Name: fmt.Sprintf("expect remote %v", keys),
+		Run: func(h *Harness) error {
+			return h.ExpectRemote(keys...)
+		},
+	}
+}
+
+// expectRemoteKept expects the remote registry to hold keys, none of them
+// deleted since it last matched.
+func expectRemoteKept(keys ...string) Step {
+	return Step{
+		Name: fmt.Sprintf("expect remote %v kept", keys),
+		Run: func(h *Harness) error {
+			if err := h.ExpectRemote(keys...); err != nil {
+				return err
+			}
+			return h.ExpectNoRemoteDeletion()
+		},
+	}
+}
+
+// Scenarios returns the built-in end to end scenarios.
+func Scenarios() []Scenario {
+	return []Scenario{
+		{
+			Name: "scale up",
+			Objects: []runtime.Object{
+				NewTLBService(scenarioNamespace, scenarioService, scenarioPort, scenarioTLBIP),
+				NewTLBEndpoints(scenarioNamespace, scenarioService, scenarioPort),
+			},
+			Steps: []Step{
+				expectRemote(),
+				setEndpoints("10.0.0.1"),
+				registerLocal("10.0.0.1"),
+				expectRemote(scenarioRemoteKey()),
+				setEndpoints("10.0.0.1", "10.0.0.2"),
+				registerLocal("10.0.0.2"),
+				expectRemoteKept(scenarioRemoteKey()),
+			},
+		},
+		{
+			Name: "scale down",
+			Objects: []runtime.Object{
+				NewTLBService(scenarioNamespace, scenarioService, scenarioPort, scenarioTLBIP),
+				NewTLBEndpoints(scenarioNamespace, scenarioService, scenarioPort, "10.0.0.1", "10.0.0.2"),
+			},
+			Steps: []Step{
+				registerLocal("10.0.0.1"),
+				registerLocal("10.0.0.2"),
+				expectRemote(scenarioRemoteKey()),
+				setEndpoints("10.0.0.1"),
+				unRegisterLocal("10.0.0.2"),
+				expectRemoteKept(scenarioRemoteKey()),
+				setEndpoints(),
+				unRegisterLocal("10.0.0.1"),
+				expectRemote(),
+			},
+		},
+		{
+			Name: "load balancer ip assigned late",
+			Objects: []runtime.Object{
+				NewTLBService(scenarioNamespace, scenarioService, scenarioPort, ""),
+				NewTLBEndpoints(scenarioNamespace, scenarioService, scenarioPort, "10.0.0.1"),
+			},
+			Steps: []Step{
+				registerLocal("10.0.0.1"),
+				expectRemote(),
+				setIngress(scenarioTLBIP),
+				expectRemote(scenarioRemoteKey()),
+			},
+		},
+		{
+			Name: "service deleted",
+			Objects: []runtime.Object{
+				NewTLBService(scenarioNamespace, scenarioService, scenarioPort, scenarioTLBIP),
+				NewTLBEndpoints(scenarioNamespace, scenarioService, scenarioPort, "10.0.0.1"),
+			},
+			Steps: []Step{
+				registerLocal("10.0.0.1"),
+				expectRemote(scenarioRemoteKey()),
+				deleteService(),
+				expectRemote(),
+			},
+		},
+	}
+}
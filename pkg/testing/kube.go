@@ -0,0 +1,145 @@
+package testing
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	kubetesting "k8s.io/client-go/testing"
+)
+
+type fakeWatcher struct {
+	namespace string
+	selector  labels.Selector
+	watcher   *watch.RaceFreeFakeWatcher
+}
+
+// FakeKubeClient is a fake clientset whose writes are delivered to watchers.
+// The plain fake clientset answers every watch with a watcher that never
+// fires, so informers built on it only ever see the initial list.
+type FakeKubeClient struct {
+	*fake.Clientset
+
+	tracker  kubetesting.ObjectTracker
+	lock     sync.Mutex
+	watchers map[string][]*fakeWatcher
+}
+
+func NewFakeKubeClient(objects ...runtime.Object) *FakeKubeClient {
+	tracker := kubetesting.NewObjectTracker(scheme.Scheme, scheme.Codecs.UniversalDecoder())
+	for _, obj := range objects {
+		if err := tracker.Add(obj); err != nil {
+			panic(err)
+		}
+	}
+
+	c := &FakeKubeClient{
+		Clientset: fake.NewSimpleClientset(),
+		tracker:   tracker,
+		watchers:  make(map[string][]*fakeWatcher),
+	}
+	c.PrependReactor("*", "*", c.react)
+	c.PrependWatchReactor("*", c.watch)
+	return c
+}
+
+func (c *FakeKubeClient) watch(action kubetesting.Action) (bool, watch.Interface, error) {
+	selector := labels.Everything()
+	if watchAction, ok := action.(kubetesting.WatchAction); ok && watchAction.GetWatchRestrictions().Labels != nil {
+		selector = watchAction.GetWatchRestrictions().Labels
+	}
+	w := &fakeWatcher{
+		namespace: action.GetNamespace(),
+		selector:  selector,
+		watcher:   watch.NewRaceFreeFake(),
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	resource := action.GetResource().Resource
+	c.watchers[resource] = append(c.watchers[resource], w)
+	return true, w.watcher, nil
+}
+
+func (c *FakeKubeClient) react(action kubetesting.Action) (bool, runtime.Object, error) {
+	var last runtime.Object
+	if deleteAction, ok := action.(kubetesting.DeleteAction); ok {
+		last, _ = c.tracker.Get(action.GetResource(), action.GetNamespace(), deleteAction.GetName())
+	}
+
+	if patchAction, ok := action.(kubetesting.PatchActionImpl); ok {
+		obj, err := c.patch(patchAction)
+		if err != nil {
+			return true, nil, err
+		}
+		c.dispatch(action, watch.Modified, obj)
+		return true, obj, nil
+	}
+
+	handled, obj, err := kubetesting.ObjectReaction(c.tracker)(action)
+	if err != nil {
+		return handled, obj, err
+	}
+
+	switch action.(type) {
+	case kubetesting.CreateActionImpl:
+		c.dispatch(action, watch.Added, obj)
+	case kubetesting.UpdateActionImpl:
+		c.dispatch(action, watch.Modified, obj)
+	case kubetesting.DeleteActionImpl:
+		c.dispatch(action, watch.Deleted, last)
+	}
+	return handled, obj, err
+}
+
+// patch applies json merge patches, the object tracker does not support
+// them. Unlike strategic merge patches they replace lists as a whole.
+func (c *FakeKubeClient) patch(action kubetesting.PatchActionImpl) (runtime.Object, error) {
+	obj, err := c.tracker.Get(action.GetResource(), action.GetNamespace(), action.GetName())
+	if err != nil {
+		return nil, err
+	}
+	original, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := jsonpatch.MergePatch(original, action.Patch)
+	if err != nil {
+		return nil, err
+	}
+	obj = reflect.New(reflect.TypeOf(obj).Elem()).Interface().(runtime.Object)
+	if err := json.Unmarshal(patched, obj); err != nil {
+		return nil, err
+	}
+	if err := c.tracker.Update(action.GetResource(), obj, action.GetNamespace()); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (c *FakeKubeClient) dispatch(action kubetesting.Action, eventType watch.EventType, obj runtime.Object) {
+	if obj == nil {
+		return
+	}
+	objMeta, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, w := range c.watchers[action.GetResource().Resource] {
+		if w.namespace != "" && w.namespace != objMeta.GetNamespace() {
+			continue
+		}
+		if !w.selector.Matches(labels.Set(objMeta.GetLabels())) {
+			continue
+		}
+		w.watcher.Action(eventType, obj)
+	}
+}
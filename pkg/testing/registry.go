@@ -0,0 +1,177 @@
+package testing
+
+import (
+	"fmt"
+	neturl "net/url"
+	"sort"
+	"sync"
+
+	"github.com/whypro/dxinkube/pkg/dubbo"
+)
+
+const (
+	VerbRegister   = "register"
+	VerbUnRegister = "unregister"
+	VerbList       = "list"
+)
+
+// Action is a single call recorded by FakeRegistry.
+type Action struct {
+	Verb string
+	URL  string
+}
+
+// FakeRegistry is an in-memory registry.Interface. It stores providers the
+// same way ZookeeperRegistry does (one escaped url per provider), records
+// every call and can be told to fail a given verb.
+type FakeRegistry struct {
+	lock      sync.Mutex
+	providers map[string]struct{}
+	actions   []Action
+	errors    map[string]error
+}
+
+func NewFakeRegistry(urls ...string) *FakeRegistry {
+	r := &FakeRegistry{
+		providers: make(map[string]struct{}),
+		errors:    make(map[string]error),
+	}
+	for _, url := range urls {
+		r.providers[neturl.QueryEscape(url)] = struct{}{}
+	}
+	return r
+}
+
+// AddNodes stores nodes as they are, unlike NewFakeRegistry it does not
+// escape them, so nodes a real registry could hold malformed can be listed.
+func (r *FakeRegistry) AddNodes(nodes ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, node := range nodes {
+		r.providers[node] = struct{}{}
+	}
+}
+
+// SetError makes every following call of verb fail with err, a nil err
+// clears the injected error.
+func (r *FakeRegistry) SetError(verb string, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err == nil {
+		delete(r.errors, verb)
+		return
+	}
+	r.errors[verb] = err
+}
+
+func (r *FakeRegistry) record(verb string, url string) error {
+	r.actions = append(r.actions, Action{Verb: verb, URL: url})
+	return r.errors[verb]
+}
+
+func (r *FakeRegistry) Register(provider *dubbo.Provider) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	url := provider.String()
+	if err := r.record(VerbRegister, url); err != nil {
+		return err
+	}
+	node := neturl.QueryEscape(url)
+	if _, ok := r.providers[node]; ok {
+		return fmt.Errorf("provider already exists, %s", url)
+	}
+	r.providers[node] = struct{}{}
+	return nil
+}
+
+func (r *FakeRegistry) UnRegister(provider *dubbo.Provider) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	url := provider.String()
+	if err := r.record(VerbUnRegister, url); err != nil {
+		return err
+	}
+	node := neturl.QueryEscape(url)
+	if _, ok := r.providers[node]; !ok {
+		return fmt.Errorf("provider is not exists, %s", url)
+	}
+	delete(r.providers, node)
+	return nil
+}
+
+func (r *FakeRegistry) ListProviders() ([]string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err := r.record(VerbList, ""); err != nil {
+		return nil, err
+	}
+	nodes := make([]string, 0, len(r.providers))
+	for node := range r.providers {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes, nil
+}
+
+// Providers returns the unescaped urls currently stored, sorted.
+func (r *FakeRegistry) Providers() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	urls := make([]string, 0, len(r.providers))
+	for node := range r.providers {
+		url, err := neturl.QueryUnescape(node)
+		if err != nil {
+			url = node
+		}
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// Keys returns the provider keys (url without parameters) currently stored,
+// sorted. Unlike Providers it is not affected by timestamps.
+func (r *FakeRegistry) Keys() []string {
+	return ProviderKeys(r.Providers())
+}
+
+// ProviderKeys parses urls and returns their provider keys, sorted.
+func ProviderKeys(urls []string) []string {
+	keys := make([]string, 0, len(urls))
+	for _, url := range urls {
+		provider := dubbo.NewProvider()
+		if err := provider.Parse(url); err != nil {
+			continue
+		}
+		keys = append(keys, provider.Key())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (r *FakeRegistry) Actions() []Action {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	actions := make([]Action, len(r.actions))
+	copy(actions, r.actions)
+	return actions
+}
+
+// ActionsFor returns the recorded urls of verb, in call order.
+func (r *FakeRegistry) ActionsFor(verb string) []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	urls := make([]string, 0)
+	for _, action := range r.actions {
+		if action.Verb == verb {
+			urls = append(urls, action.URL)
+		}
+	}
+	return urls
+}
+
+func (r *FakeRegistry) ClearActions() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.actions = nil
+}
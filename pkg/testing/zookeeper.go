@@ -0,0 +1,121 @@
+package testing
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// FakeZKConn is a pure-Go stand-in for a ZooKeeper server, implementing
+// registry.ZKConn on top of an in-memory tree with the same error semantics
+// as *zk.Conn for the operations the registry uses.
+type FakeZKConn struct {
+	lock  sync.RWMutex
+	nodes map[string][]byte
+	// deleted are the nodes deleted since the last ClearDeleted
+	deleted []string
+}
+
+func NewFakeZKConn() *FakeZKConn {
+	return &FakeZKConn{
+		nodes: map[string][]byte{"/": nil},
+	}
+}
+
+func parentPath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+func (c *FakeZKConn) children(path string) []string {
+	prefix := path + "/"
+	if path == "/" {
+		prefix = "/"
+	}
+	children := make([]string, 0)
+	for node := range c.nodes {
+		if node == "/" || !strings.HasPrefix(node, prefix) {
+			continue
+		}
+		child := node[len(prefix):]
+		if strings.Contains(child, "/") {
+			continue
+		}
+		children = append(children, child)
+	}
+	sort.Strings(children)
+	return children
+}
+
+func (c *FakeZKConn) Exists(path string) (bool, *zk.Stat, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	_, ok := c.nodes[path]
+	return ok, &zk.Stat{}, nil
+}
+
+func (c *FakeZKConn) Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.nodes[path]; ok {
+		return "", zk.ErrNodeExists
+	}
+	if _, ok := c.nodes[parentPath(path)]; !ok {
+		return "", zk.ErrNoNode
+	}
+	c.nodes[path] = data
+	return path, nil
+}
+
+func (c *FakeZKConn) Delete(path string, version int32) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.nodes[path]; !ok {
+		return zk.ErrNoNode
+	}
+	if len(c.children(path)) > 0 {
+		return zk.ErrNotEmpty
+	}
+	delete(c.nodes, path)
+	c.deleted = append(c.deleted, path)
+	return nil
+}
+
+func (c *FakeZKConn) Children(path string) ([]string, *zk.Stat, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if _, ok := c.nodes[path]; !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	return c.children(path), &zk.Stat{}, nil
+}
+
+// Paths returns every node currently in the tree, sorted.
+func (c *FakeZKConn) Paths() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	paths := make([]string, 0, len(c.nodes))
+	for node := range c.nodes {
+		paths = append(paths, node)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Deleted returns the nodes deleted since the last ClearDeleted, in order.
+func (c *FakeZKConn) Deleted() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return append([]string{}, c.deleted...)
+}
+
+func (c *FakeZKConn) ClearDeleted() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.deleted = nil
+}